@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"go.uber.org/config"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+
+	"github.com/bdreece/herobrian"
+	"github.com/bdreece/herobrian/internal/logger"
+	"github.com/bdreece/herobrian/internal/router"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/email"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/bdreece/herobrian/pkg/linode"
+	"github.com/bdreece/herobrian/pkg/mojang"
+	"github.com/bdreece/herobrian/pkg/notify"
+	"github.com/bdreece/herobrian/pkg/systemd"
+	"github.com/bdreece/herobrian/pkg/token"
+)
+
+// cliActor names the actor of audit events recorded by admin commands.
+const cliActor = "cli"
+
+var (
+	ErrLastSuperUser     = errors.New("cannot delete the last super user")
+	ErrBackupUnsupported = errors.New("only SQLite databases can be backed up; use pg_dump for PostgreSQL")
+)
+
+var (
+	userCommands = map[string]func([]string) error{
+		"create":         createUser,
+		"list":           listUsers,
+		"set-role":       setUserRole,
+		"reset-password": resetUserPassword,
+		"delete":         deleteUser,
+	}
+
+	dbCommands = map[string]func([]string) error{
+		"migrate": migrate,
+		"backup":  backup,
+		"vacuum":  vacuum,
+	}
+
+	configCommands = map[string]func([]string) error{
+		"check": checkConfig,
+	}
+
+	keysCommands = map[string]func([]string) error{
+		"generate": generateKeys,
+	}
+)
+
+func users(args []string) error     { return dispatch("user", userCommands, args) }
+func db(args []string) error        { return dispatch("db", dbCommands, args) }
+func configure(args []string) error { return dispatch("config", configCommands, args) }
+func keys(args []string) error      { return dispatch("keys", keysCommands, args) }
+
+// dispatch runs the subcommand named by the first argument.
+func dispatch(name string, cmds map[string]func([]string) error, args []string) error {
+	if len(args) == 0 || cmds[args[0]] == nil {
+		names := make([]string, 0, len(cmds))
+		for n := range cmds {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(os.Stderr, "usage: herobrian %s <%s> [flags] [args]\n", name, strings.Join(names, "|"))
+		return flag.ErrHelp
+	}
+
+	return cmds[args[0]](args[1:])
+}
+
+// adminFlags creates the flag set of a command which reads the server's
+// settings and database directly.
+func adminFlags(name, args string) (*flag.FlagSet, *herobrian.Args) {
+	a := new(herobrian.Args)
+
+	fs := flags(name, args)
+	fs.StringVar(&a.ConfigPath, "c", "/etc/herobrian", "config path")
+	fs.StringVar(&a.Environment, "e", "prod", "environment")
+
+	return fs, a
+}
+
+func createUser(args []string) error {
+	var role, addr string
+
+	fs, a := adminFlags("user create", "<username>")
+	fs.StringVar(&role, "role", "user", "role of the user")
+	fs.StringVar(&addr, "email", "", "email address of the user")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	r, err := identity.ParseRole(role)
+	if err != nil {
+		return err
+	}
+
+	username := fs.Arg(0)
+	return herobrian.Exec(*a, func(query database.Querier, recorder audit.Recorder) (err error) {
+		ctx := context.Background()
+		defer func() { record(ctx, recorder, audit.ActionUserCreate, username, err) }()
+
+		password := generatePassword()
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		id, err := query.CreateUser(ctx, database.CreateUserParams{
+			Username:     username,
+			PasswordHash: hash,
+			RoleID:       int64(r),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+
+		if addr != "" {
+			_, err = query.UpdateUserEmail(ctx, database.UpdateUserEmailParams{
+				Email: &addr,
+				ID:    id,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to set email: %w", err)
+			}
+		}
+
+		fmt.Printf("Created %s %s with password %s\n", r, username, password)
+		return nil
+	})
+}
+
+func listUsers(args []string) error {
+	fs, a := adminFlags("user list", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return herobrian.Exec(*a, func(query database.Querier) error {
+		users, err := query.ListUsers(context.Background())
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tEMAIL\tSTATUS")
+		for _, u := range users {
+			addr, status := "-", "active"
+			if u.Email != nil {
+				addr = *u.Email
+			}
+			if u.Disabled {
+				status = "disabled"
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", u.ID, u.Username, identity.Role(u.RoleID), addr, status)
+		}
+
+		return w.Flush()
+	})
+}
+
+func setUserRole(args []string) error {
+	fs, a := adminFlags("user set-role", "<username> <role>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	r, err := identity.ParseRole(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return withUser(*a, fs.Arg(0), audit.ActionUserRole, func(ctx context.Context, u userCommand) error {
+		_, err := u.query.UpdateUserRole(ctx, database.UpdateUserRoleParams{
+			RoleID: int64(r),
+			ID:     u.user.ID,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err = u.query.RemoveUserSessions(ctx, u.user.ID); err != nil {
+			return err
+		}
+
+		fmt.Printf("%s is now %s\n", u.user.Username, r)
+		return nil
+	})
+}
+
+func resetUserPassword(args []string) error {
+	fs, a := adminFlags("user reset-password", "<username>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	return withUser(*a, fs.Arg(0), audit.ActionUserPasswordReset, func(ctx context.Context, u userCommand) error {
+		password := generatePassword()
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		_, err = u.query.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+			PasswordHash: hash,
+			ID:           u.user.ID,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err = u.query.RemoveUserSessions(ctx, u.user.ID); err != nil {
+			return err
+		}
+
+		fmt.Printf("New password for %s: %s\n", u.user.Username, password)
+		return nil
+	})
+}
+
+func deleteUser(args []string) error {
+	fs, a := adminFlags("user delete", "<username>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	return withUser(*a, fs.Arg(0), audit.ActionUserDelete, func(ctx context.Context, u userCommand) error {
+		if u.user.RoleID == int64(identity.RoleSuper) {
+			count, err := u.query.CountUsersByRole(ctx, u.user.RoleID)
+			if err != nil {
+				return err
+			} else if count == 1 {
+				return ErrLastSuperUser
+			}
+		}
+		if err := database.DeleteUser(ctx, u.conn, u.user.ID); err != nil {
+			return err
+		}
+
+		fmt.Printf("Deleted %s\n", u.user.Username)
+		return nil
+	})
+}
+
+// userCommand is the user an admin command acts on, and the database
+// holding them.
+type userCommand struct {
+	conn  *sql.DB
+	query database.Querier
+	user  *database.User
+}
+
+// withUser finds a user by name and records the outcome of fn on them.
+func withUser(a herobrian.Args, username, action string, fn func(context.Context, userCommand) error) error {
+	return herobrian.Exec(a, func(conn *sql.DB, query database.Querier, recorder audit.Recorder) error {
+		ctx := context.Background()
+		user, err := query.FindUserByUsername(ctx, username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("user %q not found", username)
+		} else if err != nil {
+			return err
+		}
+
+		err = fn(ctx, userCommand{conn, query, &user})
+		record(ctx, recorder, action, user.Username, err)
+		return err
+	})
+}
+
+func record(ctx context.Context, recorder audit.Recorder, action, target string, err error) {
+	recorder.Record(ctx, &audit.Event{
+		ActorName:  cliActor,
+		Action:     action,
+		Target:     target,
+		RemoteAddr: "local",
+		Err:        err,
+	})
+}
+
+func migrate(args []string) error {
+	fs, a := adminFlags("db migrate", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return herobrian.Exec(*a, func(conn *sql.DB, query database.Querier, su *database.SuperUserOptions) error {
+		applied, err := herobrian.Migrate(context.Background(), conn, query, su)
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Database is up to date")
+		return nil
+	})
+}
+
+func backup(args []string) error {
+	fs, a := adminFlags("db backup", "<path>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	// VACUUM INTO writes a consistent copy, even while the server is running
+	return herobrian.Exec(*a, func(conn *sql.DB) error {
+		if database.Driver(conn) != database.SQLite {
+			return ErrBackupUnsupported
+		}
+		if _, err := conn.ExecContext(context.Background(), "VACUUM INTO ?", fs.Arg(0)); err != nil {
+			return fmt.Errorf("failed to back up database: %w", err)
+		}
+
+		fmt.Printf("Database backed up to %s\n", fs.Arg(0))
+		return nil
+	})
+}
+
+func vacuum(args []string) error {
+	fs, a := adminFlags("db vacuum", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return herobrian.Exec(*a, func(conn *sql.DB) error {
+		if _, err := conn.ExecContext(context.Background(), "VACUUM"); err != nil {
+			return fmt.Errorf("failed to vacuum database: %w", err)
+		}
+
+		fmt.Println("Database vacuumed")
+		return nil
+	})
+}
+
+func checkConfig(args []string) error {
+	fs, a := adminFlags("config check", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return herobrian.Exec(*a, func(provider config.Provider) error {
+		checks := []struct {
+			name      string
+			configure func(config.Provider) (any, error)
+		}{
+			{"database", configurer(database.Configure)},
+			{"database.super_user", configurer(database.ConfigureSuperUser)},
+			{"logger", configurer(logger.Configure)},
+			{"router", configurer(router.Configure)},
+			{"email", configurer(email.Configure)},
+			{"token.password_reset", configurer(tokenConfigurer("password_reset"))},
+			{"token.email_verification", configurer(tokenConfigurer("email_verification"))},
+			{"token.user_invite", configurer(tokenConfigurer("user_invite"))},
+			{"session", configurer(identity.ConfigureSession)},
+			{"session.cookie", configurer(identity.ConfigureCookie)},
+			{"totp", configurer(identity.ConfigureTOTP)},
+			{"passkey", configurer(identity.ConfigurePasskey)},
+			{"oauth", configurer(identity.ConfigureOAuth)},
+			{"throttle", configurer(identity.ConfigureThrottle)},
+			{"notify", configurer(notify.Configure)},
+			{"mojang", configurer(mojang.Configure)},
+			{"linode", configurer(linode.Configure)},
+			{"systemd", configurer(systemd.ConfigureSSH)},
+		}
+
+		var errs []error
+		for _, check := range checks {
+			if _, err := check.configure(provider); err != nil {
+				fmt.Fprintf(os.Stderr, "%-26s %v\n", check.name, err)
+				errs = append(errs, err)
+				continue
+			}
+
+			fmt.Fprintf(os.Stderr, "%-26s ok\n", check.name)
+		}
+
+		var resolved any
+		if err := provider.Get(config.Root).Populate(&resolved); err != nil {
+			return err
+		}
+
+		b, err := yaml.Marshal(redact("", resolved))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\n%s", b)
+		if len(errs) > 0 {
+			return fmt.Errorf("%d of %d sections are invalid", len(errs), len(checks))
+		}
+
+		return nil
+	})
+}
+
+func configurer[T any](fn func(config.Provider) (T, error)) func(config.Provider) (any, error) {
+	return func(provider config.Provider) (any, error) {
+		return fn(provider)
+	}
+}
+
+func tokenConfigurer(name string) func(config.Provider) (*token.Options, error) {
+	return func(provider config.Provider) (*token.Options, error) {
+		return token.Configure(name, provider)
+	}
+}
+
+// redact replaces the value of every key which looks like it holds a secret,
+// and the password of every URL. Empty values are kept, so that a missing
+// secret stands out.
+func redact(key string, v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		out := make(map[any]any, len(v))
+		for k, value := range v {
+			out[k] = redact(fmt.Sprint(k), value)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			out[i] = redact(key, value)
+		}
+		return out
+	}
+
+	if v != nil && v != "" && isSecret(key) {
+		return "<redacted>"
+	}
+
+	// connection strings and webhooks may carry a password
+	if s, ok := v.(string); ok {
+		if u, err := url.Parse(s); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	}
+
+	return v
+}
+
+func isSecret(key string) bool {
+	if key == "public_key" {
+		return false
+	}
+
+	for _, s := range []string{"password", "secret", "token", "key"} {
+		if key == s || strings.HasSuffix(key, "_"+s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func generateKeys(args []string) error {
+	fs := flags("keys generate", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	for _, name := range []string{
+		"HEROBRIAN_SESSION_SIGNING_KEY",
+		"HEROBRIAN_SESSION_ENCRYPTING_KEY",
+		"HEROBRIAN_INVITE_JWT_SECRET",
+		"HEROBRIAN_PASSWORD_RESET_JWT_SECRET",
+		"HEROBRIAN_EMAIL_VERIFICATION_JWT_SECRET",
+		"HEROBRIAN_TOTP_ENCRYPTION_KEY",
+	} {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+
+		fmt.Printf("%s=%s\n", name, base64.StdEncoding.EncodeToString(b))
+	}
+
+	public, private, err := notify.GenerateVAPIDKeys()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("HEROBRIAN_VAPID_PUBLIC_KEY=%s\n", public)
+	fmt.Printf("HEROBRIAN_VAPID_PRIVATE_KEY=%s\n", private)
+	return nil
+}
+
+func generatePassword() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(hash), nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	urlEnv   = "HEROBRIAN_URL"
+	tokenEnv = "HEROBRIAN_TOKEN"
+)
+
+var ErrNotLoggedIn = errors.New("no server configured; run herobrian login, or set " + urlEnv + " and " + tokenEnv)
+
+type (
+	// clientConfig is stored by login, readable only by the user.
+	clientConfig struct {
+		URL   string `json:"url"`
+		Token string `json:"token"`
+	}
+
+	// client calls the API of a running server with a personal access token.
+	client struct {
+		url   string
+		token string
+		http  *http.Client
+	}
+
+	problem struct {
+		Title  string `json:"title"`
+		Status int    `json:"status"`
+		Detail string `json:"detail"`
+	}
+)
+
+func (p *problem) Error() string {
+	if p.Detail == "" {
+		return strings.ToLower(p.Title)
+	}
+
+	return fmt.Sprintf("%s: %s", strings.ToLower(p.Title), p.Detail)
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "herobrian", "client.json"), nil
+}
+
+func saveConfig(cfg clientConfig) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return path, os.WriteFile(path, b, 0o600)
+}
+
+// newClient loads the stored config, which the environment overrides.
+func newClient() (*client, error) {
+	var cfg clientConfig
+	if path, err := configPath(); err == nil {
+		if b, err := os.ReadFile(path); err == nil {
+			if err = json.Unmarshal(b, &cfg); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+		}
+	}
+
+	if v := os.Getenv(urlEnv); v != "" {
+		cfg.URL = v
+	}
+	if v := os.Getenv(tokenEnv); v != "" {
+		cfg.Token = v
+	}
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil, ErrNotLoggedIn
+	}
+
+	return &client{strings.TrimSuffix(cfg.URL, "/"), cfg.Token, http.DefaultClient}, nil
+}
+
+// do sends a request to the API, decoding a JSON response into out if it is
+// not nil. The caller closes the body of a streamed response, when out is nil.
+func (c *client) do(ctx context.Context, method, path string, body, out any) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+"/api/v1"+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		defer res.Body.Close()
+
+		p := &problem{Title: http.StatusText(res.StatusCode), Status: res.StatusCode}
+		_ = json.NewDecoder(res.Body).Decode(p)
+		return nil, p
+	}
+
+	if out == nil {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+	if err = json.NewDecoder(res.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return res, nil
+}
+
+// send makes a request whose response has no body of interest.
+func (c *client) send(ctx context.Context, method, path string, body any) error {
+	res, err := c.do(ctx, method, path, body, nil)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bdreece/herobrian/internal/controller"
+)
+
+var unitActions = []string{"start", "stop", "restart", "enable", "disable", "status"}
+
+func login(args []string) error {
+	var cfg clientConfig
+
+	fs := flags("login", "")
+	fs.StringVar(&cfg.URL, "url", "http://localhost:3000", "server URL")
+	fs.StringVar(&cfg.Token, "token", "", "personal access token, read from stdin if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if cfg.Token == "" {
+		fmt.Fprint(os.Stderr, "Token: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read token: %w", err)
+		}
+		cfg.Token = strings.TrimSpace(line)
+	}
+
+	// check the token works before storing it
+	c := &client{strings.TrimSuffix(cfg.URL, "/"), cfg.Token, http.DefaultClient}
+	if err := c.send(context.Background(), http.MethodGet, "/units", nil); err != nil {
+		return err
+	}
+
+	path, err := saveConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to store config: %w", err)
+	}
+
+	fmt.Printf("Logged in to %s; token stored in %s\n", cfg.URL, path)
+	return nil
+}
+
+func status(args []string) error {
+	fs := flags("status", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var linode controller.LinodeStatusResponse
+	if _, err = c.do(ctx, http.MethodGet, "/linode", nil, &linode); err != nil {
+		fmt.Printf("Linode: unknown (%v)\n", err)
+	} else {
+		fmt.Printf("Linode %s: %s\n", linode.InstanceID, linode.Status)
+	}
+
+	var units []controller.UnitResponse
+	if _, err = c.do(ctx, http.MethodGet, "/units", nil, &units); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nINSTANCE\tSTATUS\tDESCRIPTION")
+	for _, u := range units {
+		var unit controller.UnitResponse
+		status := "unknown"
+		if _, err = c.do(ctx, http.MethodGet, "/units/"+url.PathEscape(u.Instance), nil, &unit); err == nil {
+			status = unit.Status
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", u.Instance, status, u.Description)
+	}
+
+	return w.Flush()
+}
+
+// power creates a command which boots, reboots or shuts down the instance.
+func power(action string) func([]string) error {
+	return func(args []string) error {
+		fs := flags(action, "")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		if err = c.send(context.Background(), http.MethodPost, "/linode/"+action, nil); err != nil {
+			return err
+		}
+
+		fmt.Printf("Linode %s requested\n", action)
+		return nil
+	}
+}
+
+func unit(args []string) error {
+	fs := flags("unit", "<"+strings.Join(unitActions, "|")+"> <instance>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 || !slices.Contains(unitActions, fs.Arg(0)) {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	action, instance := fs.Arg(0), url.PathEscape(fs.Arg(1))
+	if action == "status" {
+		var u controller.UnitResponse
+		if _, err = c.do(context.Background(), http.MethodGet, "/units/"+instance, nil, &u); err != nil {
+			return err
+		}
+
+		fmt.Printf("%s (%s): %s\n", u.Instance, u.Description, u.Status)
+		return nil
+	}
+
+	if err = c.send(context.Background(), http.MethodPost, "/units/"+instance+"/"+action, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("Unit %s %s requested\n", fs.Arg(1), action)
+	return nil
+}
+
+func logs(args []string) error {
+	var (
+		follow bool
+		lines  int
+	)
+
+	fs := flags("logs", "<instance>")
+	fs.BoolVar(&follow, "f", false, "follow the journal until interrupted")
+	fs.IntVar(&lines, "n", 100, "number of lines to show first")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	query := url.Values{}
+	query.Set("lines", fmt.Sprint(lines))
+	query.Set("follow", fmt.Sprint(follow))
+
+	res, err := c.do(ctx, http.MethodGet, "/units/"+url.PathEscape(fs.Arg(0))+"/logs?"+query.Encode(), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if _, err = io.Copy(os.Stdout, res.Body); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	return nil
+}
+
+func invite(args []string) error {
+	var model controller.CreateInviteRequest
+
+	fs := flags("invite", "")
+	fs.StringVar(&model.Role, "role", "user", "role of the invited user")
+	fs.StringVar(&model.Email, "email", "", "email the invite to this address")
+	fs.Int64Var(&model.MaxUses, "max-uses", 1, "number of users who may accept the invite")
+	fs.IntVar(&model.ExpiresIn, "expires-in", 24, "hours until the invite expires")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var created controller.InviteResponse
+	if _, err = c.do(context.Background(), http.MethodPost, "/invites", model, &created); err != nil {
+		return err
+	}
+
+	if created.Email != nil {
+		fmt.Fprintf(os.Stderr, "Invite emailed to %s\n", *created.Email)
+	}
+	fmt.Println(created.URL)
+	return nil
+}
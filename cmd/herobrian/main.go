@@ -1,23 +1,77 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-
-	"github.com/bdreece/herobrian"
+	"strings"
 )
 
+// command runs a subcommand with the arguments following its name.
+type command struct {
+	run     func(args []string) error
+	summary string
+}
+
+var commands = map[string]command{
+	"serve":    {serve, "run the server (the default)"},
+	"login":    {login, "store the URL and API token of a server"},
+	"status":   {status, "show the status of the Linode instance and its units"},
+	"boot":     {power("boot"), "boot the Linode instance"},
+	"reboot":   {power("reboot"), "reboot the Linode instance"},
+	"shutdown": {power("shutdown"), "shut down the Linode instance"},
+	"unit":     {unit, "start, stop, restart, enable, disable or show a unit"},
+	"logs":     {logs, "print or follow the journal of a unit"},
+	"invite":   {invite, "create an invite and print its URL"},
+	"user":     {users, "create, list, set the role of, reset or delete local users"},
+	"db":       {db, "migrate, back up or vacuum the local database"},
+	"config":   {configure, "check the settings and print them, with secrets redacted"},
+	"keys":     {keys, "generate session, token and push secrets"},
+}
+
+var commandOrder = []string{"serve", "login", "status", "boot", "reboot", "shutdown", "unit", "logs", "invite", "user", "db", "config", "keys"}
+
 func main() {
-	var args herobrian.Args
 	defer quit()
 
-	flag.IntVar(&args.Port, "p", 3000, "port")
-	flag.StringVar(&args.ConfigPath, "c", "/etc/herobrian", "config path")
-	flag.StringVar(&args.Environment, "e", "prod", "environment")
-	flag.Parse()
+	// flags without a command start the server, as before subcommands
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(args); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "herobrian %s: %v\n", name, err)
+		}
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: herobrian <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
+
+// flags creates the flag set of a subcommand, which reports its own errors.
+func flags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: herobrian %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
 
-	herobrian.New(args).Run()
+	return fs
 }
 
 func quit() {
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/bdreece/herobrian"
+)
+
+func serve(args []string) error {
+	var a herobrian.Args
+
+	fs := flags("serve", "")
+	fs.IntVar(&a.Port, "p", 3000, "port")
+	fs.StringVar(&a.ConfigPath, "c", "/etc/herobrian", "config path")
+	fs.StringVar(&a.Environment, "e", "prod", "environment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	herobrian.New(a).Run()
+	return nil
+}
@@ -2,9 +2,11 @@ package herobrian
 
 import (
 	"context"
+	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"maps"
 	"os"
 	"path/filepath"
@@ -16,20 +18,25 @@ import (
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/config"
+	"go.uber.org/dig"
 	"go.uber.org/fx"
-	"go.uber.org/multierr"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/bdreece/herobrian/internal/controller"
 	"github.com/bdreece/herobrian/internal/logger"
 	"github.com/bdreece/herobrian/internal/middleware"
 	"github.com/bdreece/herobrian/internal/router"
+	"github.com/bdreece/herobrian/pkg/audit"
 	"github.com/bdreece/herobrian/pkg/database"
 	"github.com/bdreece/herobrian/pkg/email"
 	"github.com/bdreece/herobrian/pkg/identity"
 	"github.com/bdreece/herobrian/pkg/linode"
+	"github.com/bdreece/herobrian/pkg/metrics"
+	"github.com/bdreece/herobrian/pkg/mojang"
+	"github.com/bdreece/herobrian/pkg/notify"
 	"github.com/bdreece/herobrian/pkg/systemd"
 	"github.com/bdreece/herobrian/pkg/token"
+	"github.com/bdreece/herobrian/pkg/worker"
 	"github.com/bdreece/herobrian/web"
 )
 
@@ -41,16 +48,27 @@ type Args struct {
 
 var (
 	Config = fx.Module("config",
-		fx.Provide(func(args Args) (config.Provider, error) {
-			basePath := filepath.Join(args.ConfigPath, "settings.yml")
-			overridePath := filepath.Join(args.ConfigPath, fmt.Sprintf("settings.%s.yml", args.Environment))
-			return config.NewYAML(
-				config.Permissive(),
-				config.Expand(os.LookupEnv),
-				config.File(basePath),
-				config.File(overridePath),
-			)
-		}),
+		fx.Provide(
+			fx.Annotate(
+				Args.ConfigFiles,
+				fx.ResultTags(`name:"config_files"`),
+			),
+			fx.Annotate(
+				func(files []string) (config.Provider, error) {
+					opts := []config.YAMLOption{
+						config.Permissive(),
+						config.Expand(os.LookupEnv),
+					}
+
+					for _, file := range files {
+						opts = append(opts, config.File(file))
+					}
+
+					return config.NewYAML(opts...)
+				},
+				fx.ParamTags(`name:"config_files"`),
+			),
+		),
 	)
 
 	Infrastructure = fx.Module("infrastructure",
@@ -64,38 +82,44 @@ var (
 			fx.Annotate(
 				database.Dial,
 				fx.As(new(database.DBTX)),
-			),
-			fx.Annotate(
-				database.New,
-				fx.As(new(database.Querier)),
 				fx.As(fx.Self()),
 			),
+			database.NewQuerier,
 		),
+		fx.Provide(configureEmailTemplates),
 		fx.Provide(
-			email.ConfigureMailchimp,
+			email.Configure,
 			fx.Annotate(
-				email.NewMailchimpClient,
+				email.New,
+				fx.ResultTags(`name:"email_transport"`),
+			),
+			fx.Annotate(
+				email.NewOutbox,
+				fx.As(fx.Self()),
 				fx.As(new(email.Client)),
 			),
 		),
-		// fx.Provide(
-		// 	email.ConfigureSendGrid,
-		// 	fx.Annotate(
-		// 		email.NewSendGridClient,
-		// 		fx.As(new(email.Client)),
-		// 	),
-		// ),
 		fx.Provide(
-			// 	fx.Annotate(
-			// 		func(provider config.Provider) (*token.Options, error) {
-			// 			return token.Configure("password_reset", provider)
-			// 		},
-			// 		fx.ResultTags(`name:"password_reset"`),
-			// 	),
-			// 	fx.Annotate(
-			// 		token.NewHandler[token.PasswordResetClaims],
-			// 		fx.ParamTags(`name:"password_reset"`),
-			// 	),
+			fx.Annotate(
+				func(provider config.Provider) (*token.Options, error) {
+					return token.Configure("password_reset", provider)
+				},
+				fx.ResultTags(`name:"password_reset"`),
+			),
+			fx.Annotate(
+				token.NewHandler[token.PasswordResetClaims],
+				fx.ParamTags(`name:"password_reset"`),
+			),
+			fx.Annotate(
+				func(provider config.Provider) (*token.Options, error) {
+					return token.Configure("email_verification", provider)
+				},
+				fx.ResultTags(`name:"email_verification"`),
+			),
+			fx.Annotate(
+				token.NewHandler[token.EmailVerificationClaims],
+				fx.ParamTags(`name:"email_verification"`),
+			),
 			fx.Annotate(
 				func(provider config.Provider) (*token.Options, error) {
 					return token.Configure("user_invite", provider)
@@ -113,12 +137,26 @@ var (
 			fx.Annotate(
 				identity.NewSessionStore,
 				fx.As(new(sessions.Store)),
+				fx.As(fx.Self()),
 			),
 			fx.Annotate(
 				identity.NewCookieAuthenticator,
 				fx.As(new(identity.Authenticator)),
 				fx.As(new(identity.SignInManager)),
 			),
+			identity.NewGrants,
+			identity.NewPasswordResetManager,
+			identity.NewEmailManager,
+			identity.ConfigureTOTP,
+			identity.NewTOTPManager,
+			identity.ConfigurePasskey,
+			identity.NewPasskeyManager,
+			identity.ConfigureOAuth,
+			identity.NewOAuthManager,
+			identity.ConfigureThrottle,
+			identity.NewLoginThrottle,
+			identity.NewAccessTokens,
+			identity.NewProfileManager,
 		),
 		fx.Supply(
 			fx.Annotate(
@@ -133,6 +171,25 @@ var (
 				fx.As(new(echo.Renderer)),
 			),
 		),
+		fx.Provide(audit.NewRecorder),
+		fx.Provide(
+			notify.Configure,
+			notify.New,
+		),
+		fx.Provide(
+			worker.NewRegistry,
+			metrics.New,
+		),
+		fx.Provide(
+			asHealthCheck(database.NewHealthCheck),
+			asHealthCheck(email.NewHealthCheck),
+			asHealthCheck(linode.NewHealthCheck),
+			asHealthCheck(systemd.NewHealthCheck),
+		),
+		fx.Provide(
+			mojang.Configure,
+			mojang.NewHTTP,
+		),
 		fx.Provide(
 			linode.Configure,
 			linode.NewHTTP,
@@ -149,36 +206,97 @@ var (
 	Application = fx.Module("application",
 		fx.Provide(
 			controller.NewHome,
+			controller.NewHealth,
 			controller.NewAuth,
+			controller.NewAccount,
+			controller.NewProfile,
+			controller.NewNotifications,
+			controller.NewTOTP,
+			controller.NewPasskeys,
+			controller.NewConnections,
+			controller.NewTokens,
+			controller.NewAudit,
+			controller.NewGrants,
+			controller.NewUsers,
 			controller.NewInvite,
+			controller.NewOutbox,
 			controller.NewLinode,
 			controller.NewSystemd,
+			controller.NewAPI,
 		),
 		fx.Provide(
 			router.Configure,
 			router.New,
+			configureBaseURL,
 		),
 		fx.Decorate(startRouter),
 		fx.Decorate(createTables),
+		fx.Invoke(closeEmitters),
+		fx.Invoke(metrics.Watch),
+		fx.Invoke(notify.Watch),
 		fx.Invoke(func(router.Router) {}),
-		fx.Invoke(func(*database.Queries) {}),
+		fx.Invoke(func(database.Querier) {}),
+		fx.Invoke(runOutbox),
 	)
 )
 
 func New(args Args) *fx.App {
 	return fx.New(
 		fx.Supply(args),
+		fx.Decorate(
+			metrics.InstrumentLinode,
+			metrics.InstrumentSystemd,
+		),
 		Config,
 		Infrastructure,
 		Application,
 	)
 }
 
+// Exec calls fn with its dependencies from the config and infrastructure
+// modules, without starting the application. Logs at warning level and
+// above are written to stderr instead of the log file, and a failure is
+// reduced to the error which caused it.
+func Exec(args Args, fn any) error {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+	}))
+
+	err := fx.New(
+		fx.Supply(args),
+		fx.NopLogger,
+		Config,
+		Infrastructure,
+		fx.Replace(logger),
+		fx.Invoke(fn),
+	).Err()
+	if err != nil {
+		return dig.RootCause(err)
+	}
+
+	return nil
+}
+
 func (args Args) Addr() string {
 	return fmt.Sprintf(":%d", args.Port)
 }
 
-func configureRenderer() *echorenderer.Options {
+// ConfigFiles lists the settings files in the order they are merged.
+func (args Args) ConfigFiles() []string {
+	return []string{
+		filepath.Join(args.ConfigPath, "settings.yml"),
+		filepath.Join(args.ConfigPath, fmt.Sprintf("settings.%s.yml", args.Environment)),
+	}
+}
+
+func asHealthCheck(f any) any {
+	return fx.Annotate(
+		f,
+		fx.ResultTags(`group:"health_checks"`),
+	)
+}
+
+func configureRenderer(grants *identity.Grants) *echorenderer.Options {
 	return &echorenderer.Options{
 		FS:      web.Templates,
 		Include: []string{"*.gotmpl"},
@@ -203,6 +321,22 @@ func configureRenderer() *echorenderer.Options {
 
 					return identity.Role(claims.Role).String()
 				},
+				"can": func(p identity.Permission) bool {
+					claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+					if !ok || claims == nil {
+						return false
+					}
+
+					return identity.Role(claims.Role).Can(p)
+				},
+				"canUnit": func(p identity.Permission, instance string) (bool, error) {
+					claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+					if !ok {
+						return false, nil
+					}
+
+					return grants.Can(c.Request().Context(), claims, p, instance)
+				},
 			})
 
 			return funcs
@@ -210,23 +344,57 @@ func configureRenderer() *echorenderer.Options {
 	}
 }
 
+func configureBaseURL(opts *router.Options) controller.BaseURL {
+	return controller.BaseURL(opts.BaseURL)
+}
+
+func configureEmailTemplates() *email.Templates {
+	return email.NewTemplates(web.EmailTemplates)
+}
+
 func startRouter(router router.Router, p struct {
 	fx.In
 
-	Home    *controller.Home
-	Auth    *controller.Auth
-	Invite  *controller.Invite
-	Linode  *controller.Linode
-	Systemd *controller.Systemd
+	Home          *controller.Home
+	Health        *controller.Health
+	Auth          *controller.Auth
+	Account       *controller.Account
+	Profile       *controller.Profile
+	Notifications *controller.Notifications
+	TOTP          *controller.TOTP
+	Passkeys      *controller.Passkeys
+	Connections   *controller.Connections
+	Tokens        *controller.Tokens
+	Audit         *controller.Audit
+	Grants        *controller.Grants
+	Users         *controller.Users
+	Invite        *controller.Invite
+	Outbox        *controller.Outbox
+	Linode        *controller.Linode
+	Systemd       *controller.Systemd
+	API           *controller.API
 
 	Args      Args
 	Lifecycle fx.Lifecycle
 }) router.Router {
 	router.MapHome(p.Home)
+	router.MapHealth(p.Health)
 	router.MapAuth(p.Auth)
+	router.MapAccount(p.Account)
+	router.MapProfile(p.Profile)
+	router.MapNotifications(p.Notifications)
+	router.MapTOTP(p.TOTP)
+	router.MapPasskeys(p.Passkeys)
+	router.MapConnections(p.Connections)
+	router.MapTokens(p.Tokens)
+	router.MapAudit(p.Audit)
+	router.MapGrants(p.Grants)
+	router.MapUsers(p.Users)
 	router.MapInvite(p.Invite)
+	router.MapOutbox(p.Outbox)
 	router.MapLinode(p.Linode)
 	router.MapSystemd(p.Systemd)
+	router.MapAPI(p.API)
 
 	p.Lifecycle.Append(fx.Hook{
 		OnStart: func(context.Context) error {
@@ -241,44 +409,87 @@ func startRouter(router router.Router, p struct {
 	return router
 }
 
-func createTables(db *database.Queries, p struct {
+func closeEmitters(lc fx.Lifecycle, linodeEmitter linode.Emitter, systemdEmitter systemd.Emitter) {
+	lc.Append(fx.StopHook(func() error {
+		return errors.Join(linodeEmitter.Close(), systemdEmitter.Close())
+	}))
+}
+
+// runOutbox starts delivering queued email once the tables exist.
+func runOutbox(lc fx.Lifecycle, outbox *email.Outbox) {
+	lc.Append(fx.StartStopHook(
+		func() error { return outbox.Start(context.Background()) },
+		outbox.Stop,
+	))
+}
+
+func createTables(db database.Querier, p struct {
 	fx.In
 
-	Options   *database.Options
+	DB        *sql.DB
 	SuperUser *database.SuperUserOptions
 	Lifecycle fx.Lifecycle
-}) *database.Queries {
-	p.Lifecycle.Append(fx.StartHook(func(ctx context.Context) (err error) {
-		f, err := os.Open(p.Options.Schema)
-		if err != nil {
-			return
-		}
-		defer multierr.AppendInvoke(&err, multierr.Close(f))
+}) database.Querier {
+	p.Lifecycle.Append(fx.StartHook(func(ctx context.Context) error {
+		_, err := Migrate(ctx, p.DB, db, p.SuperUser)
+		return err
+	}))
 
-		schema, err := io.ReadAll(f)
-		if err != nil {
-			return
-		}
+	return db
+}
 
-		_, err = db.DBTX().ExecContext(ctx, string(schema))
-		if err != nil {
-			return
-		}
+// Migrate applies pending migrations, returning those applied, and creates
+// the configured super user if there is no Super user.
+func Migrate(ctx context.Context, conn *sql.DB, db database.Querier, su *database.SuperUserOptions) ([]database.Migration, error) {
+	applied, err := database.Migrate(ctx, conn)
+	if err != nil {
+		return applied, err
+	}
 
-		hash, err := bcrypt.GenerateFromPassword([]byte(p.SuperUser.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return
-		}
+	count, err := db.CountUsersByRole(ctx, int64(identity.RoleSuper))
+	if err != nil || count > 0 {
+		return applied, err
+	}
 
-		_, err = db.UpsertUser(ctx, database.UpsertUserParams{
-			ID:           -1,
-			Username:     p.SuperUser.Username,
-			PasswordHash: base64.StdEncoding.EncodeToString(hash),
-			RoleID:       int64(identity.RoleSuper),
-		})
+	hash, err := bcrypt.GenerateFromPassword([]byte(su.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return applied, err
+	}
 
-		return
-	}))
+	id, err := db.CreateUser(ctx, database.CreateUserParams{
+		Username:     su.Username,
+		PasswordHash: base64.StdEncoding.EncodeToString(hash),
+		RoleID:       int64(identity.RoleSuper),
+	})
+	if err != nil {
+		return applied, fmt.Errorf("failed to create super user %q: %w", su.Username, err)
+	}
 
-	return db
+	_, err = db.UpdateUserProfile(ctx, database.UpdateUserProfileParams{
+		FirstName: su.FirstName,
+		LastName:  su.LastName,
+		ID:        id,
+	})
+	if err != nil {
+		return applied, fmt.Errorf("failed to set super user profile: %w", err)
+	}
+
+	// the address comes from the operator, so it is trusted as verified
+	if su.EmailAddress != "" {
+		_, err = db.UpdateUserEmail(ctx, database.UpdateUserEmailParams{
+			Email: &su.EmailAddress,
+			ID:    id,
+		})
+		if err == nil {
+			_, err = db.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+				ID:    id,
+				Email: &su.EmailAddress,
+			})
+		}
+		if err != nil {
+			return applied, fmt.Errorf("failed to set super user email: %w", err)
+		}
+	}
+
+	return applied, nil
 }
@@ -0,0 +1,40 @@
+package build
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is overridden at link time with
+// -ldflags "-X github.com/bdreece/herobrian/internal/build.Version=...".
+var Version = "dev"
+
+type Info struct {
+	Version   string
+	GoVersion string
+	Revision  string
+	Modified  bool
+}
+
+func ReadInfo() Info {
+	info := Info{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,341 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+type (
+	Account struct {
+		db        database.Querier
+		passwords identity.PasswordManager
+		emails    identity.EmailManager
+		sessions  *identity.SessionStore
+		audit     audit.Recorder
+		logger    *slog.Logger
+		baseURL   BaseURL
+	}
+
+	AccountParams struct {
+		fx.In
+
+		Querier         database.Querier
+		PasswordManager identity.PasswordManager
+		EmailManager    identity.EmailManager
+		SessionStore    *identity.SessionStore
+		Recorder        audit.Recorder
+		Logger          *slog.Logger
+		BaseURL         BaseURL
+	}
+
+	tokenParamModel struct {
+		Token string `param:"token" validate:"required"`
+	}
+
+	sessionModel struct {
+		database.Session
+		Device  string
+		Current bool
+	}
+)
+
+func (controller *Account) RenderAccount(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	user, err := controller.db.FindUser(c.Request().Context(), claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	return c.Render(http.StatusOK, "account.gotmpl", echo.Map{
+		"User": user,
+	})
+}
+
+func (controller *Account) ChangePassword(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		OldPassword string `form:"oldPassword" validate:"required,max=127"`
+		Password    string `form:"password" validate:"required,min=8,max=127"`
+		_           string `form:"confirmPassword" validate:"required,min=8,max=127,eqfield=Password"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	err := controller.passwords.SetPassword(c.Request().Context(), claims, model.OldPassword, model.Password)
+	recordAudit(c, controller.audit, audit.ActionPasswordChange, claims.Username, err)
+	if errors.Is(err, identity.ErrInvalidPassword) {
+		return c.HTML(http.StatusOK, `<p class="text-red-600">The current password is incorrect.</p>`)
+	} else if err != nil {
+		return err
+	}
+
+	return c.HTML(http.StatusOK, `<p>Your password has been changed.</p>`)
+}
+
+func (controller *Account) ChangeEmail(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		Email string `form:"email" validate:"required,email,max=254"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	err := controller.emails.SetEmail(c.Request().Context(), claims, model.Email, controller.baseURL.Join("/account/email"))
+	recordAudit(c, controller.audit, audit.ActionEmailChange, model.Email, err)
+	if errors.Is(err, identity.ErrEmailTaken) {
+		return c.HTML(http.StatusOK, `<p class="text-red-600">That email address is used by another account.</p>`)
+	} else if err != nil {
+		controller.logger.Error("failed to change email", slog.String("error", err.Error()))
+		return c.HTML(http.StatusOK, `<p class="text-red-600">Failed to send the verification email.</p>`)
+	}
+
+	return c.HTML(http.StatusOK, `<p>Check your inbox for a verification link.</p>`)
+}
+
+func (controller *Account) VerifyEmail(c echo.Context) error {
+	model := new(tokenParamModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	err := controller.emails.ConfirmEmail(c.Request().Context(), model.Token)
+	if errors.Is(err, identity.ErrInvalidVerificationToken) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, identity.ErrEmailTaken) {
+		return c.Render(http.StatusConflict, "message.gotmpl", echo.Map{
+			"Title":   "Email Not Verified",
+			"Message": "This email address has been verified by another account.",
+		})
+	} else if err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "message.gotmpl", echo.Map{
+		"Title":   "Email Verified",
+		"Message": "Your email address has been verified.",
+	})
+}
+
+func (Account) RenderForgotPassword(c echo.Context) error {
+	return c.Render(http.StatusOK, "forgot-password.gotmpl", echo.Map{})
+}
+
+func (controller *Account) ForgotPassword(c echo.Context) error {
+	model := new(struct {
+		Email string `form:"email" validate:"required,email,max=254"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	// failures are only logged, so the response never reveals whether an
+	// account exists for the address
+	err := controller.passwords.SendPasswordReset(c.Request().Context(), model.Email, controller.baseURL.Join("/reset-password"))
+	if err != nil {
+		controller.logger.Error("failed to send password reset",
+			slog.String("error", err.Error()))
+	}
+
+	return c.HTML(http.StatusOK, `
+        <p class="col-span-2">
+            If an account with that verified email address exists, a reset link
+            has been sent to it.
+        </p>
+    `)
+}
+
+func (controller *Account) RenderResetPassword(c echo.Context) error {
+	model := new(tokenParamModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "reset-password.gotmpl", echo.Map{
+		"Token": model.Token,
+	})
+}
+
+func (controller *Account) ResetPassword(c echo.Context) error {
+	model := new(struct {
+		Token    string `param:"token" validate:"required"`
+		Password string `form:"password" validate:"required,min=8,max=127"`
+		_        string `form:"confirmPassword" validate:"required,min=8,max=127,eqfield=Password"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	err := controller.passwords.ConfirmPasswordReset(c.Request().Context(), model.Token, model.Password)
+	controller.audit.Record(c.Request().Context(), &audit.Event{
+		Action:     audit.ActionPasswordReset,
+		RemoteAddr: c.RealIP(),
+		Err:        err,
+	})
+	if errors.Is(err, identity.ErrInvalidResetToken) {
+		return echo.NewHTTPError(http.StatusBadRequest, identity.ErrInvalidResetToken.Error())
+	} else if err != nil {
+		return err
+	}
+
+	c.Response().Header().Add("HX-Location", "/login")
+	return c.NoContent(http.StatusOK)
+}
+
+func (controller *Account) RenderSessions(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	sessions, err := controller.sessions.List(c.Request().Context(), claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	models := make([]sessionModel, 0, len(sessions))
+	for _, sess := range sessions {
+		models = append(models, sessionModel{
+			Session: sess,
+			Device:  describeDevice(sess.UserAgent),
+			Current: sess.ID == claims.SessionID,
+		})
+	}
+
+	return c.Render(http.StatusOK, "sessions.gotmpl", echo.Map{
+		"Sessions": models,
+	})
+}
+
+func (controller *Account) RevokeSession(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		ID string `param:"id" validate:"required"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	err := controller.sessions.Revoke(c.Request().Context(), claims.ID, model.ID)
+	recordAudit(c, controller.audit, audit.ActionSessionRevoke, claims.Username, err)
+	if err != nil {
+		return err
+	}
+
+	if model.ID == claims.SessionID {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+
+	return c.Redirect(http.StatusFound, "/account/sessions")
+}
+
+func (controller *Account) RevokeOtherSessions(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	err := controller.sessions.RevokeOthers(c.Request().Context(), claims.ID, claims.SessionID)
+	recordAudit(c, controller.audit, audit.ActionSessionRevoke, claims.Username, err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/account/sessions")
+}
+
+// describeDevice summarizes a user agent as a browser and platform.
+func describeDevice(userAgent string) string {
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	platform := "unknown platform"
+	for _, p := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	return browser + " on " + platform
+}
+
+func NewAccount(p AccountParams) *Account {
+	return &Account{
+		db:        p.Querier,
+		passwords: p.PasswordManager,
+		emails:    p.EmailManager,
+		sessions:  p.SessionStore,
+		audit:     p.Recorder,
+		logger:    p.Logger,
+		baseURL:   p.BaseURL,
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	echovalidator "github.com/bdreece/echo-validator"
+	"github.com/labstack/echo/v4"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/identity"
+)
+
+// linkRecorder records the links it is asked to send.
+type linkRecorder struct {
+	identity.PasswordManager
+	identity.EmailManager
+
+	links []string
+}
+
+func (r *linkRecorder) SendPasswordReset(_ context.Context, _, resetURL string) error {
+	r.links = append(r.links, resetURL)
+	return nil
+}
+
+func (r *linkRecorder) SetEmail(_ context.Context, _ *identity.ClaimSet, _, verifyURL string) error {
+	r.links = append(r.links, verifyURL)
+	return nil
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Record(context.Context, *audit.Event) {}
+
+func TestAccountLinksIgnoreHost(t *testing.T) {
+	links := new(linkRecorder)
+	controller := NewAccount(AccountParams{
+		PasswordManager: links,
+		EmailManager:    links,
+		Recorder:        nopRecorder{},
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		BaseURL:         "https://herobrian.test",
+	})
+
+	e := echo.New()
+	e.Validator = echovalidator.Default
+
+	post := func(form url.Values) echo.Context {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Host = "attacker.example"
+		return e.NewContext(req, httptest.NewRecorder())
+	}
+
+	if err := controller.ForgotPassword(post(url.Values{"email": {"steve@example.com"}})); err != nil {
+		t.Fatal(err)
+	}
+
+	c := post(url.Values{"email": {"steve@example.com"}})
+	c.Set(middleware.ClaimsContextKey, &identity.ClaimSet{ID: 1, Username: "steve"})
+	if err := controller.ChangeEmail(c); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"https://herobrian.test/reset-password", "https://herobrian.test/account/email"}
+	if strings.Join(links.links, " ") != strings.Join(want, " ") {
+		t.Errorf("sent links %q, want %q", links.links, want)
+	}
+}
@@ -0,0 +1,434 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/bdreece/herobrian/pkg/systemd"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+type (
+	// API serves the JSON surface under /api/v1, reusing the page
+	// controllers so both record the same audit events.
+	API struct {
+		linode  *Linode
+		systemd *Systemd
+		users   *Users
+		invite  *Invite
+	}
+
+	APIParams struct {
+		fx.In
+
+		Linode  *Linode
+		Systemd *Systemd
+		Users   *Users
+		Invite  *Invite
+	}
+
+	LinodeStatusResponse struct {
+		InstanceID string `json:"instance_id"`
+		Status     string `json:"status"`
+	}
+
+	UnitResponse struct {
+		Name        string `json:"name"`
+		Instance    string `json:"instance"`
+		Description string `json:"description"`
+		Status      string `json:"status,omitempty"`
+	}
+
+	UserResponse struct {
+		ID                int64   `json:"id"`
+		Username          string  `json:"username"`
+		DisplayName       string  `json:"display_name"`
+		Role              string  `json:"role"`
+		Disabled          bool    `json:"disabled"`
+		Email             *string `json:"email"`
+		MinecraftUsername *string `json:"minecraft_username"`
+	}
+
+	SetRoleRequest struct {
+		Role string `json:"role" validate:"required"`
+	}
+
+	CreateInviteRequest struct {
+		Role      string `json:"role" validate:"required"`
+		Email     string `json:"email,omitempty" validate:"omitempty,email,max=254"`
+		MaxUses   int64  `json:"max_uses,omitempty" validate:"min=1,max=100"`
+		ExpiresIn int    `json:"expires_in,omitempty" validate:"min=1,max=168"`
+	}
+
+	InviteResponse struct {
+		ID        string     `json:"id"`
+		Role      string     `json:"role"`
+		Email     *string    `json:"email"`
+		Inviter   *string    `json:"inviter"`
+		Uses      int64      `json:"uses"`
+		MaxUses   int64      `json:"max_uses"`
+		Status    string     `json:"status"`
+		CreatedAt time.Time  `json:"created_at"`
+		ExpiresAt time.Time  `json:"expires_at"`
+		RevokedAt *time.Time `json:"revoked_at"`
+		URL       string     `json:"url,omitempty"`
+	}
+)
+
+func (api *API) LinodeStatus(c echo.Context) error {
+	status, err := api.linode.client.InstanceStatus(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to get linode status: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, LinodeStatusResponse{
+		InstanceID: api.linode.opts.InstanceID,
+		Status:     status.String(),
+	})
+}
+
+func (api *API) LinodeBoot(c echo.Context) error {
+	return api.power(c, audit.ActionLinodeBoot, api.linode.client.BootInstance)
+}
+
+func (api *API) LinodeReboot(c echo.Context) error {
+	return api.power(c, audit.ActionLinodeReboot, api.linode.client.RebootInstance)
+}
+
+func (api *API) LinodeShutdown(c echo.Context) error {
+	return api.power(c, audit.ActionLinodeShutdown, api.linode.client.ShutdownInstance)
+}
+
+func (api *API) ListUnits(c echo.Context) error {
+	units := api.systemd.services.Units()
+	models := make([]UnitResponse, 0, len(units))
+	for _, unit := range units {
+		models = append(models, UnitResponse{
+			Name:        unit.Name,
+			Instance:    unit.Instance,
+			Description: unit.Description,
+		})
+	}
+
+	return c.JSON(http.StatusOK, models)
+}
+
+func (api *API) UnitStatus(c echo.Context) error {
+	svc, err := api.systemd.resolveService(c)
+	if err != nil {
+		return err
+	}
+
+	status, err := svc.Status(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to get unit status: %w", err)
+	}
+
+	unit := svc.Unit()
+	return c.JSON(http.StatusOK, UnitResponse{
+		Name:        unit.Name,
+		Instance:    unit.Instance,
+		Description: unit.Description,
+		Status:      status.String(),
+	})
+}
+
+// UnitLogs streams the unit's journal as text, flushing each line so it can
+// be followed.
+func (api *API) UnitLogs(c echo.Context) error {
+	model := &struct {
+		Lines  int  `query:"lines" validate:"min=1,max=10000"`
+		Follow bool `query:"follow"`
+	}{Lines: 100}
+	if err := bindAPI(c, model); err != nil {
+		return err
+	}
+
+	svc, err := api.systemd.resolveService(c)
+	if err != nil {
+		return err
+	}
+
+	logs, err := svc.Logs(c.Request().Context(), model.Lines, model.Follow)
+	if err != nil {
+		return fmt.Errorf("failed to read unit logs: %w", err)
+	}
+	defer logs.Close()
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		if _, err = fmt.Fprintln(w, scanner.Text()); err != nil {
+			return nil
+		}
+		w.Flush()
+	}
+
+	return nil
+}
+
+func (api *API) UnitStart(c echo.Context) error {
+	return api.unit(c, audit.ActionUnitStart, (*systemd.Service).Start)
+}
+
+func (api *API) UnitStop(c echo.Context) error {
+	return api.unit(c, audit.ActionUnitStop, (*systemd.Service).Stop)
+}
+
+func (api *API) UnitRestart(c echo.Context) error {
+	return api.unit(c, audit.ActionUnitRestart, (*systemd.Service).Restart)
+}
+
+func (api *API) UnitEnable(c echo.Context) error {
+	return api.unit(c, audit.ActionUnitEnable, (*systemd.Service).Enable)
+}
+
+func (api *API) UnitDisable(c echo.Context) error {
+	return api.unit(c, audit.ActionUnitDisable, (*systemd.Service).Disable)
+}
+
+func (api *API) ListUsers(c echo.Context) error {
+	users, err := api.users.query.ListUsers(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	models := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		models = append(models, UserResponse{
+			ID:                user.ID,
+			Username:          user.Username,
+			DisplayName:       user.DisplayName,
+			Role:              identity.Role(user.RoleID).String(),
+			Disabled:          user.Disabled,
+			Email:             user.Email,
+			MinecraftUsername: user.MinecraftUsername,
+		})
+	}
+
+	return c.JSON(http.StatusOK, models)
+}
+
+func (api *API) SetUserRole(c echo.Context) error {
+	model := new(struct {
+		ID int64 `param:"id"`
+		SetRoleRequest
+	})
+	if err := bindAPI(c, model); err != nil {
+		return err
+	}
+
+	role, err := identity.ParseRole(model.Role)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := api.users.find(c, model.ID)
+	if err == nil {
+		err = api.users.setRole(c, user, int64(role))
+	}
+
+	recordAudit(c, api.users.audit, audit.ActionUserRole, userTarget(user, model.ID), err)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (api *API) DisableUser(c echo.Context) error {
+	return api.setUserDisabled(c, true, audit.ActionUserDisable)
+}
+
+func (api *API) EnableUser(c echo.Context) error {
+	return api.setUserDisabled(c, false, audit.ActionUserEnable)
+}
+
+func (api *API) DeleteUser(c echo.Context) error {
+	model := new(userParamModel)
+	if err := bindAPI(c, model); err != nil {
+		return err
+	}
+
+	user, err := api.users.find(c, model.ID)
+	if err == nil {
+		err = api.users.remove(c, user)
+	}
+
+	recordAudit(c, api.users.audit, audit.ActionUserDelete, userTarget(user, model.ID), err)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (api *API) ListInvites(c echo.Context) error {
+	invites, err := api.invite.query.ListInvites(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to list invites: %w", err)
+	}
+
+	now := time.Now()
+	models := make([]InviteResponse, 0, len(invites))
+	for _, invite := range invites {
+		models = append(models, InviteResponse{
+			ID:        invite.ID,
+			Role:      identity.Role(invite.RoleID).String(),
+			Email:     invite.Email,
+			Inviter:   invite.InviterName,
+			Uses:      invite.Uses,
+			MaxUses:   invite.MaxUses,
+			Status:    inviteStatus(invite.RevokedAt, invite.Uses, invite.MaxUses, invite.ExpiresAt, now),
+			CreatedAt: invite.CreatedAt,
+			ExpiresAt: invite.ExpiresAt,
+			RevokedAt: invite.RevokedAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, models)
+}
+
+// CreateInvite stores an invite, emailing it if addressed, and responds with
+// its URL.
+func (api *API) CreateInvite(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := &CreateInviteRequest{MaxUses: 1, ExpiresIn: 24}
+	if err := bindAPI(c, model); err != nil {
+		return err
+	}
+
+	role, err := identity.ParseRole(model.Role)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	invite, url, err := api.invite.create(c, claims, &createInviteModel{
+		Role:      int(role),
+		Email:     model.Email,
+		MaxUses:   model.MaxUses,
+		ExpiresIn: model.ExpiresIn,
+	})
+	if err != nil {
+		return err
+	}
+
+	// failures are listed on the invites page, and delivery on the outbox page
+	if invite.Email != nil {
+		_ = api.invite.deliver(c, invite, claims.Username, url)
+	}
+
+	return c.JSON(http.StatusCreated, InviteResponse{
+		ID:        invite.ID,
+		Role:      identity.Role(invite.RoleID).String(),
+		Email:     invite.Email,
+		Inviter:   &claims.Username,
+		MaxUses:   invite.MaxUses,
+		Status:    "pending",
+		CreatedAt: invite.CreatedAt,
+		ExpiresAt: invite.ExpiresAt,
+		URL:       url,
+	})
+}
+
+func (api *API) RevokeInvite(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		ID string `param:"id" validate:"required,uuid"`
+	})
+	if err := bindAPI(c, model); err != nil {
+		return err
+	}
+
+	if err := api.invite.revoke(c, claims, model.ID); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (api *API) power(c echo.Context, action string, fn func(ctx context.Context) error) error {
+	err := fn(c.Request().Context())
+	recordAudit(c, api.linode.audit, action, api.linode.opts.InstanceID, err)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (api *API) unit(c echo.Context, action string, fn func(*systemd.Service, context.Context) error) error {
+	svc, err := api.systemd.resolveService(c)
+	if err != nil {
+		recordAudit(c, api.systemd.audit, action, c.Param("instance"), err)
+		return err
+	}
+
+	err = fn(svc, c.Request().Context())
+	recordAudit(c, api.systemd.audit, action, svc.Unit().Instance, err)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (api *API) setUserDisabled(c echo.Context, disabled bool, action string) error {
+	model := new(userParamModel)
+	if err := bindAPI(c, model); err != nil {
+		return err
+	}
+
+	user, err := api.users.find(c, model.ID)
+	if err == nil {
+		err = api.users.updateDisabled(c, user, disabled)
+	}
+
+	recordAudit(c, api.users.audit, action, userTarget(user, model.ID), err)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// bindAPI binds and validates a request, reporting either failure as a bad
+// request rather than an internal error.
+func bindAPI(c echo.Context, model any) error {
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return nil
+}
+
+func NewAPI(p APIParams) *API {
+	return &API{
+		linode:  p.Linode,
+		systemd: p.Systemd,
+		users:   p.Users,
+		invite:  p.Invite,
+	}
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+const auditPageSize = 50
+
+type (
+	Audit struct {
+		db database.Querier
+	}
+
+	AuditParams struct {
+		fx.In
+
+		Querier database.Querier
+	}
+
+	auditFilterModel struct {
+		Action  string `query:"action" validate:"max=127"`
+		Actor   string `query:"actor" validate:"max=127"`
+		Outcome string `query:"outcome" validate:"omitempty,oneof=success failure"`
+		Since   string `query:"since" validate:"omitempty,datetime=2006-01-02"`
+		Until   string `query:"until" validate:"omitempty,datetime=2006-01-02"`
+		Page    int    `query:"page" validate:"min=0"`
+	}
+)
+
+func (controller *Audit) RenderAudit(c echo.Context) error {
+	model, params, err := controller.bindFilter(c)
+	if err != nil {
+		return err
+	}
+
+	params.Limit = auditPageSize + 1
+	params.Offset = int64(model.Page * auditPageSize)
+
+	events, err := controller.db.ListAuditEvents(c.Request().Context(), params)
+	if err != nil {
+		return fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	hasNext := len(events) > auditPageSize
+	if hasNext {
+		events = events[:auditPageSize]
+	}
+
+	return c.Render(http.StatusOK, "audit.gotmpl", echo.Map{
+		"Filter":  model,
+		"Query":   model.query(),
+		"Actions": audit.Actions,
+		"Events":  events,
+		"Page":    model.Page,
+		"HasNext": hasNext,
+	})
+}
+
+func (controller *Audit) ExportAudit(c echo.Context) error {
+	_, params, err := controller.bindFilter(c)
+	if err != nil {
+		return err
+	}
+
+	// no dialect agrees on how to disable LIMIT, so export everything there is
+	params.Limit = math.MaxInt64
+
+	events, err := controller.db.ListAuditEvents(c.Request().Context(), params)
+	if err != nil {
+		return fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/csv")
+	w.Header().Set(echo.HeaderContentDisposition, `attachment; filename="audit.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"time", "actor_id", "actor", "action", "target", "remote_addr", "outcome", "error"})
+	for _, e := range events {
+		var actorID, errMsg string
+		if e.ActorID != nil {
+			actorID = strconv.FormatInt(*e.ActorID, 10)
+		}
+		if e.Error != nil {
+			errMsg = *e.Error
+		}
+
+		_ = out.Write([]string{
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			actorID,
+			e.ActorName,
+			e.Action,
+			e.Target,
+			e.RemoteAddr,
+			e.Outcome,
+			errMsg,
+		})
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func (controller *Audit) bindFilter(c echo.Context) (*auditFilterModel, database.ListAuditEventsParams, error) {
+	model := new(auditFilterModel)
+	if err := c.Bind(model); err != nil {
+		return nil, database.ListAuditEventsParams{}, err
+	}
+	if err := c.Validate(model); err != nil {
+		return nil, database.ListAuditEventsParams{}, err
+	}
+
+	params := database.ListAuditEventsParams{
+		Action:    model.Action,
+		ActorName: model.Actor,
+		Outcome:   model.Outcome,
+		Until:     time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC),
+	}
+
+	if model.Since != "" {
+		params.Since, _ = time.Parse(time.DateOnly, model.Since)
+	}
+	if model.Until != "" {
+		until, _ := time.Parse(time.DateOnly, model.Until)
+		params.Until = until.AddDate(0, 0, 1)
+	}
+
+	return model, params, nil
+}
+
+// query encodes the filter for links which preserve it.
+func (model auditFilterModel) query() template.URL {
+	q := make(url.Values)
+	for key, value := range map[string]string{
+		"action":  model.Action,
+		"actor":   model.Actor,
+		"outcome": model.Outcome,
+		"since":   model.Since,
+		"until":   model.Until,
+	} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+
+	return template.URL(q.Encode())
+}
+
+func NewAudit(p AuditParams) *Audit {
+	return &Audit{p.Querier}
+}
+
+// recordAudit records a privileged action performed by the authenticated
+// user of the request.
+func recordAudit(c echo.Context, recorder audit.Recorder, action, target string, err error) {
+	e := &audit.Event{
+		Action:     action,
+		Target:     target,
+		RemoteAddr: c.RealIP(),
+		Err:        err,
+	}
+
+	if claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet); ok && claims != nil {
+		e.ActorID = &claims.ID
+		e.ActorName = claims.Username
+	}
+
+	recorder.Record(c.Request().Context(), e)
+}
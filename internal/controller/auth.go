@@ -1,32 +1,48 @@
 package controller
 
 import (
-	"encoding/base64"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
 	"github.com/bdreece/herobrian/pkg/database"
-	"github.com/bdreece/herobrian/pkg/email"
 	"github.com/bdreece/herobrian/pkg/identity"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/fx"
-	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserDisabled       = errors.New("user account is disabled")
+	ErrInvalidCredentials = errors.New("invalid username or password")
 )
 
 type (
 	Auth struct {
-		db     database.Querier
-		client email.Client
-		mgr    identity.SignInManager
+		db       database.Querier
+		mgr      identity.SignInManager
+		totp     *identity.TOTPManager
+		passkeys *identity.PasskeyManager
+		oauth    *identity.OAuthManager
+		throttle *identity.LoginThrottle
+		audit    audit.Recorder
 	}
 
 	AuthParams struct {
 		fx.In
 
-		Querier       database.Querier
-		EmailClient   email.Client
-		SignInManager identity.SignInManager
+		Querier        database.Querier
+		SignInManager  identity.SignInManager
+		TOTPManager    *identity.TOTPManager
+		PasskeyManager *identity.PasskeyManager
+		OAuthManager   *identity.OAuthManager
+		LoginThrottle  *identity.LoginThrottle
+		Recorder       audit.Recorder
 	}
 
 	authLoginModel struct {
@@ -35,8 +51,10 @@ type (
 	}
 )
 
-func (Auth) RenderLogin(c echo.Context) error {
-	return c.Render(http.StatusOK, "login.gotmpl", echo.Map{})
+func (controller *Auth) RenderLogin(c echo.Context) error {
+	return c.Render(http.StatusOK, "login.gotmpl", echo.Map{
+		"Providers": controller.oauth.Providers(),
+	})
 }
 
 func (controller *Auth) Login(c echo.Context) error {
@@ -54,37 +72,261 @@ func (controller *Auth) Login(c echo.Context) error {
 		return err
 	}
 
-	// find user
+	ip := c.RealIP()
+	if wait, ok := controller.throttle.Allow(ip, model.Username); !ok {
+		controller.recordLogin(c, nil, model.Username, identity.ErrLockedOut)
+		return lockedOut(c, wait)
+	}
+
+	// find user, comparing a password either way so that unknown users
+	// take as long to reject
 	user, err := controller.db.FindUserByUsername(c.Request().Context(), model.Username)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = identity.ComparePassword("", model.Password)
+		controller.throttle.Fail(ip, model.Username)
+		controller.recordLogin(c, nil, model.Username, err)
+		return echo.NewHTTPError(http.StatusUnauthorized, ErrInvalidCredentials.Error())
+	} else if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
 	}
 
-	// compare hash
-	hash, err := base64.StdEncoding.DecodeString(user.PasswordHash)
+	if err = identity.ComparePassword(user.PasswordHash, model.Password); err != nil {
+		controller.throttle.Fail(ip, model.Username)
+		controller.recordLogin(c, &user.ID, user.Username, err)
+		return echo.NewHTTPError(http.StatusUnauthorized, ErrInvalidCredentials.Error())
+	}
+	controller.throttle.Reset(model.Username)
+
+	if user.Disabled {
+		controller.recordLogin(c, &user.ID, user.Username, ErrUserDisabled)
+		return echo.NewHTTPError(http.StatusUnauthorized, ErrUserDisabled.Error())
+	}
+
+	// users with two-factor authentication finish signing in with a code
+	enabled, err := controller.totp.Enabled(c.Request().Context(), user.ID)
 	if err != nil {
-		return fmt.Errorf("failed to decode user password hash: %w", err)
+		return err
+	}
+	if enabled {
+		if err = controller.totp.Challenge(c, user.ID); err != nil {
+			return err
+		}
+
+		c.Response().Header().Add("HX-Location", "/login/totp")
+		return c.NoContent(http.StatusOK)
+	}
+
+	return controller.signIn(c, &user)
+}
+
+func (controller *Auth) RenderLoginTOTP(c echo.Context) error {
+	if _, err := controller.totp.Challenged(c); err != nil {
+		return c.Redirect(http.StatusFound, "/login")
 	}
-	if err = bcrypt.CompareHashAndPassword(hash, []byte(model.Password)); err != nil {
+
+	return c.Render(http.StatusOK, "login-totp.gotmpl", echo.Map{})
+}
+
+// LoginTOTP completes a sign-in started by Login with a code from the
+// user's authenticator app or a recovery code.
+func (controller *Auth) LoginTOTP(c echo.Context) error {
+	userID, err := controller.totp.Challenged(c)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
 
-	// create session
-	err = controller.mgr.SignIn(c, &identity.ClaimSet{
-		ID:       user.ID,
-		Username: user.Username,
-		Role:     user.RoleID,
+	model := new(struct {
+		Code string `form:"code" validate:"required,max=32"`
 	})
+	if err = c.Bind(model); err != nil {
+		return err
+	}
+	if err = c.Validate(model); err != nil {
+		return err
+	}
+
+	user, err := controller.db.FindUser(c.Request().Context(), userID)
 	if err != nil {
-		return fmt.Errorf("failed to sign in user: %w", err)
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 	}
 
-	c.Response().Header().Add("HX-Location", "/")
-	return c.NoContent(http.StatusOK)
+	ip := c.RealIP()
+	if wait, ok := controller.throttle.Allow(ip, user.Username); !ok {
+		controller.recordLogin(c, &user.ID, user.Username, identity.ErrLockedOut)
+		return lockedOut(c, wait)
+	}
+
+	if user.Disabled {
+		controller.totp.ClearChallenge(c)
+		controller.recordLogin(c, &user.ID, user.Username, ErrUserDisabled)
+		return echo.NewHTTPError(http.StatusUnauthorized, ErrUserDisabled.Error())
+	}
+
+	err = controller.totp.Verify(c.Request().Context(), user.ID, model.Code)
+	if errors.Is(err, identity.ErrInvalidTOTPCode) {
+		controller.throttle.Fail(ip, user.Username)
+		controller.recordLogin(c, &user.ID, user.Username, err)
+		return c.HTML(http.StatusOK, `<p class="text-red-600">The code is incorrect or has already been used.</p>`)
+	} else if err != nil {
+		return err
+	}
+
+	controller.throttle.Reset(user.Username)
+	controller.totp.ClearChallenge(c)
+	return controller.signIn(c, &user)
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get. It is
+// fetched by the passkey-login element on the login page.
+func (controller *Auth) BeginPasskeyLogin(c echo.Context) error {
+	assertion, err := controller.passkeys.BeginLogin(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, assertion)
+}
+
+// PasskeyLogin signs in the owner of the passkey in the request body.
+// Users with two-factor authentication still enter a code unless the
+// authenticator verified them with a PIN or biometric.
+func (controller *Auth) PasskeyLogin(c echo.Context) error {
+	if claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet); ok && claims != nil {
+		// user already logged in
+		c.Response().Header().Add("HX-Location", "/")
+		return c.NoContent(http.StatusOK)
+	}
+
+	ip := c.RealIP()
+	if wait, ok := controller.throttle.Allow(ip, ""); !ok {
+		controller.recordLogin(c, nil, "", identity.ErrLockedOut)
+		return lockedOut(c, wait)
+	}
+
+	user, verified, err := controller.passkeys.FinishLogin(c)
+	if err != nil {
+		controller.recordLogin(c, nil, "", err)
+		if errors.Is(err, identity.ErrNoCeremony) || errors.Is(err, identity.ErrInvalidPasskey) || errors.Is(err, identity.ErrPasskeyCloned) {
+			controller.throttle.Fail(ip, "")
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return err
+	}
+
+	if user.Disabled {
+		controller.recordLogin(c, &user.ID, user.Username, ErrUserDisabled)
+		return echo.NewHTTPError(http.StatusBadRequest, ErrUserDisabled.Error())
+	}
+
+	if !verified {
+		enabled, err := controller.totp.Enabled(c.Request().Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		if enabled {
+			if err = controller.totp.Challenge(c, user.ID); err != nil {
+				return err
+			}
+
+			c.Response().Header().Add("HX-Location", "/login/totp")
+			return c.NoContent(http.StatusOK)
+		}
+	}
+
+	return controller.signIn(c, user)
+}
+
+// BeginOAuth sends the browser to the provider to sign in.
+func (controller *Auth) BeginOAuth(c echo.Context) error {
+	if claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet); ok && claims != nil {
+		// user already logged in
+		return c.Redirect(http.StatusFound, "/")
+	}
+
+	location, err := controller.oauth.Begin(c, c.Param("provider"))
+	if errors.Is(err, identity.ErrUnknownProvider) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		c.Logger().Errorf("failed to begin oauth sign-in: %v", err)
+		return renderOAuthError(c, http.StatusBadGateway, "The sign-in provider could not be reached.")
+	}
+
+	return c.Redirect(http.StatusFound, location)
+}
+
+// OAuthCallback completes a sign-in, or links the account if the flow was
+// begun from the connections page. Users with two-factor authentication
+// still enter a code.
+func (controller *Auth) OAuthCallback(c echo.Context) error {
+	claims, _ := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	provider := c.Param("provider")
+
+	result, err := controller.oauth.Complete(c, provider, claims)
+	if err != nil {
+		if claims != nil {
+			recordAudit(c, controller.audit, audit.ActionAccountLink, provider, err)
+		} else {
+			controller.recordLogin(c, nil, "", err)
+		}
+
+		switch {
+		case errors.Is(err, identity.ErrUnknownProvider):
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case errors.Is(err, identity.ErrInvalidOAuthFlow),
+			errors.Is(err, identity.ErrOAuthDenied),
+			errors.Is(err, identity.ErrAccountNotLinked),
+			errors.Is(err, identity.ErrAccountLinked):
+			return renderOAuthError(c, http.StatusBadRequest, capitalize(err.Error())+".")
+		default:
+			c.Logger().Errorf("failed to complete oauth sign-in: %v", err)
+			return renderOAuthError(c, http.StatusBadGateway, "The sign-in provider could not verify you.")
+		}
+	}
+
+	target := provider + ":" + result.Identity.Username
+	if result.Linked {
+		recordAudit(c, controller.audit, audit.ActionAccountLink, target, nil)
+		return c.Redirect(http.StatusFound, "/account/connections")
+	}
+	if result.Provisioned {
+		controller.audit.Record(c.Request().Context(), &audit.Event{
+			ActorID:    &result.User.ID,
+			ActorName:  result.User.Username,
+			Action:     audit.ActionUserProvision,
+			Target:     target,
+			RemoteAddr: c.RealIP(),
+		})
+	}
+
+	user := result.User
+	if user.Disabled {
+		controller.recordLogin(c, &user.ID, user.Username, ErrUserDisabled)
+		return renderOAuthError(c, http.StatusUnauthorized, "Your account is disabled.")
+	}
+
+	enabled, err := controller.totp.Enabled(c.Request().Context(), user.ID)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		if err = controller.totp.Challenge(c, user.ID); err != nil {
+			return err
+		}
+
+		return c.Redirect(http.StatusFound, "/login/totp")
+	}
+
+	if err = controller.startSession(c, user); err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/")
 }
 
 func (controller *Auth) RenderLogout(c echo.Context) error {
-	if err := controller.mgr.SignOut(c); err != nil {
+	err := controller.mgr.SignOut(c)
+	recordAudit(c, controller.audit, audit.ActionLogout, "", err)
+	if err != nil {
 		return err
 	}
 
@@ -92,6 +334,60 @@ func (controller *Auth) RenderLogout(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+func (controller *Auth) signIn(c echo.Context, user *database.User) error {
+	if err := controller.startSession(c, user); err != nil {
+		return err
+	}
+
+	c.Response().Header().Add("HX-Location", "/")
+	return c.NoContent(http.StatusOK)
+}
+
+func (controller *Auth) startSession(c echo.Context, user *database.User) error {
+	err := controller.mgr.SignIn(c, identity.NewClaimSet(user))
+	if err != nil {
+		controller.recordLogin(c, &user.ID, user.Username, err)
+		return fmt.Errorf("failed to sign in user: %w", err)
+	}
+
+	controller.recordLogin(c, &user.ID, user.Username, nil)
+	return nil
+}
+
+func (controller *Auth) recordLogin(c echo.Context, id *int64, username string, err error) {
+	controller.audit.Record(c.Request().Context(), &audit.Event{
+		ActorID:    id,
+		ActorName:  username,
+		Action:     audit.ActionLogin,
+		Target:     username,
+		RemoteAddr: c.RealIP(),
+		Err:        err,
+	})
+}
+
+// lockedOut tells the client when it may try again.
+func lockedOut(c echo.Context, wait time.Duration) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	return echo.NewHTTPError(http.StatusTooManyRequests, identity.ErrLockedOut.Error())
+}
+
+// renderOAuthError shows the error as a page, since the provider redirected
+// the browser here rather than htmx.
+func renderOAuthError(c echo.Context, code int, message string) error {
+	return c.Render(code, "message.gotmpl", echo.Map{
+		"Title":   "Sign In Failed",
+		"Message": message,
+	})
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
 func NewAuth(p AuthParams) *Auth {
-	return &Auth{p.Querier, p.EmailClient, p.SignInManager}
+	return &Auth{p.Querier, p.SignInManager, p.TOTPManager, p.PasskeyManager, p.OAuthManager, p.LoginThrottle, p.Recorder}
 }
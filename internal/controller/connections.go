@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrConnectionNotFound = errors.New("linked account not found")
+	ErrLastSignInMethod   = errors.New("set a password or add a passkey before removing your only linked account")
+)
+
+type (
+	Connections struct {
+		query database.Querier
+		oauth *identity.OAuthManager
+		audit audit.Recorder
+	}
+
+	ConnectionsParams struct {
+		fx.In
+
+		Querier      database.Querier
+		OAuthManager *identity.OAuthManager
+		Recorder     audit.Recorder
+	}
+)
+
+func (controller *Connections) RenderConnections(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	accounts, err := controller.query.ListExternalAccounts(c.Request().Context(), claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list linked accounts: %w", err)
+	}
+
+	return c.Render(http.StatusOK, "connections.gotmpl", echo.Map{
+		"Accounts":  accounts,
+		"Providers": controller.oauth.Providers(),
+	})
+}
+
+// Link sends the browser to the provider, which returns to the sign-in
+// callback to link the account.
+func (controller *Connections) Link(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	location, err := controller.oauth.BeginLink(c, c.Param("provider"), claims.ID)
+	if errors.Is(err, identity.ErrUnknownProvider) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	// htmx cannot follow a redirect to another origin
+	if c.Request().Header.Get("HX-Request") != "" {
+		c.Response().Header().Add("HX-Redirect", location)
+		return c.NoContent(http.StatusOK)
+	}
+
+	return c.Redirect(http.StatusFound, location)
+}
+
+// Remove unlinks an account, unless it is the only way the user can sign in.
+func (controller *Connections) Remove(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		ID int64 `param:"id" validate:"required"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	err := controller.canRemove(c, claims.ID)
+
+	var n int64
+	if err == nil {
+		n, err = controller.query.RemoveExternalAccount(c.Request().Context(), database.RemoveExternalAccountParams{
+			ID:     model.ID,
+			UserID: claims.ID,
+		})
+	}
+	if err == nil && n == 0 {
+		err = ErrConnectionNotFound
+	}
+
+	recordAudit(c, controller.audit, audit.ActionAccountUnlink, fmt.Sprint(model.ID), err)
+	switch {
+	case errors.Is(err, ErrConnectionNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrLastSignInMethod):
+		return c.HTML(http.StatusOK, fmt.Sprintf(`<p class="text-red-600">%s.</p>`, capitalize(err.Error())))
+	case err != nil:
+		return fmt.Errorf("failed to remove linked account: %w", err)
+	}
+
+	c.Response().Header().Add("HX-Location", "/account/connections")
+	return c.NoContent(http.StatusOK)
+}
+
+// canRemove checks a user created through a provider, who has no password,
+// keeps another way to sign in.
+func (controller *Connections) canRemove(c echo.Context, userID int64) error {
+	ctx := c.Request().Context()
+	user, err := controller.query.FindUser(ctx, userID)
+	if err != nil || user.PasswordHash != "" {
+		return err
+	}
+
+	accounts, err := controller.query.ListExternalAccounts(ctx, userID)
+	if err != nil {
+		return err
+	}
+	passkeys, err := controller.query.ListPasskeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(accounts) <= 1 && len(passkeys) == 0 {
+		return ErrLastSignInMethod
+	}
+
+	return nil
+}
+
+func NewConnections(p ConnectionsParams) *Connections {
+	return &Connections{p.Querier, p.OAuthManager, p.Recorder}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/bdreece/herobrian/pkg/systemd"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+type (
+	Grants struct {
+		db       database.Querier
+		grants   *identity.Grants
+		services *systemd.ServiceFactory
+		audit    audit.Recorder
+	}
+
+	GrantsParams struct {
+		fx.In
+
+		Querier        database.Querier
+		Grants         *identity.Grants
+		ServiceFactory *systemd.ServiceFactory
+		Recorder       audit.Recorder
+	}
+
+	grantModel struct {
+		Username   string `form:"username" validate:"required,max=127"`
+		Instance   string `form:"instance" validate:"required,max=127"`
+		Permission string `form:"permission" validate:"required"`
+	}
+)
+
+func (controller *Grants) RenderGrants(c echo.Context) error {
+	grants, err := controller.grants.List(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to list unit grants: %w", err)
+	}
+
+	return c.Render(http.StatusOK, "grants.gotmpl", echo.Map{
+		"Grants":      grants,
+		"Units":       controller.services.Units(),
+		"Permissions": identity.UnitPermissions,
+	})
+}
+
+func (controller *Grants) CreateGrant(c echo.Context) error {
+	model, err := controller.bind(c)
+	if err != nil {
+		return err
+	}
+
+	err = controller.withUser(c, model, func(id int64) error {
+		return controller.grants.Grant(c.Request().Context(), id, model.Instance, identity.Permission(model.Permission))
+	})
+	recordAudit(c, controller.audit, audit.ActionGrantCreate, model.target(), err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/grants")
+}
+
+func (controller *Grants) RevokeGrant(c echo.Context) error {
+	model, err := controller.bind(c)
+	if err != nil {
+		return err
+	}
+
+	err = controller.withUser(c, model, func(id int64) error {
+		return controller.grants.Revoke(c.Request().Context(), id, model.Instance, identity.Permission(model.Permission))
+	})
+	recordAudit(c, controller.audit, audit.ActionGrantRevoke, model.target(), err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/grants")
+}
+
+func (controller *Grants) bind(c echo.Context) (*grantModel, error) {
+	model := new(grantModel)
+	if err := c.Bind(model); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(model); err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(controller.services.Units(), func(u systemd.Unit) bool {
+		return u.Instance == model.Instance
+	}) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, ErrInstanceNotFound.Error())
+	}
+
+	if !identity.Permission(model.Permission).IsUnitPermission() {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, identity.ErrInvalidGrant.Error())
+	}
+
+	return model, nil
+}
+
+func (controller *Grants) withUser(c echo.Context, model *grantModel, fn func(int64) error) error {
+	user, err := controller.db.FindUserByUsername(c.Request().Context(), model.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	} else if err != nil {
+		return err
+	}
+
+	return fn(user.ID)
+}
+
+func (model *grantModel) target() string {
+	return fmt.Sprintf("%s:%s:%s", model.Username, model.Instance, model.Permission)
+}
+
+func NewGrants(p GrantsParams) *Grants {
+	return &Grants{
+		db:       p.Querier,
+		grants:   p.Grants,
+		services: p.ServiceFactory,
+		audit:    p.Recorder,
+	}
+}
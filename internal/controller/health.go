@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bdreece/herobrian/internal/build"
+	"github.com/bdreece/herobrian/pkg/health"
+	"github.com/bdreece/herobrian/pkg/linode"
+	"github.com/bdreece/herobrian/pkg/systemd"
+	"github.com/bdreece/herobrian/pkg/worker"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+const readinessTimeout = 5 * time.Second
+
+type (
+	Health struct {
+		workers        *worker.Registry
+		checks         []health.Check
+		linodeEmitter  linode.Emitter
+		systemdEmitter systemd.Emitter
+		configFiles    []string
+	}
+
+	HealthParams struct {
+		fx.In
+
+		Registry       *worker.Registry
+		Checks         []health.Check `group:"health_checks"`
+		LinodeEmitter  linode.Emitter
+		SystemdEmitter systemd.Emitter
+		ConfigFiles    []string `name:"config_files"`
+	}
+
+	healthModel struct {
+		Status  string          `json:"status"`
+		Workers []worker.Health `json:"workers"`
+	}
+
+	configFileModel struct {
+		Path   string
+		Exists bool
+	}
+)
+
+func (controller *Health) Healthz(c echo.Context) error {
+	model := healthModel{
+		Status:  "ok",
+		Workers: controller.workers.Health(),
+	}
+
+	code := http.StatusOK
+	for _, health := range model.Workers {
+		if health.State == worker.StateStopped {
+			model.Status = "unhealthy"
+			code = http.StatusServiceUnavailable
+			break
+		}
+
+		if health.State == worker.StateBackoff {
+			model.Status = "degraded"
+		}
+	}
+
+	return c.JSON(code, model)
+}
+
+func (controller *Health) Readyz(c echo.Context) error {
+	report := health.Run(c.Request().Context(), readinessTimeout, controller.checks...)
+	if !report.OK() {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+func (controller *Health) RenderDiagnostics(c echo.Context) error {
+	files := make([]configFileModel, 0, len(controller.configFiles))
+	for _, path := range controller.configFiles {
+		_, err := os.Stat(path)
+		files = append(files, configFileModel{path, err == nil})
+	}
+
+	return c.Render(http.StatusOK, "diagnostics.gotmpl", echo.Map{
+		"Build":              build.ReadInfo(),
+		"Workers":            controller.workers.Health(),
+		"Readiness":          health.Run(c.Request().Context(), readinessTimeout, controller.checks...),
+		"LinodeSubscribers":  controller.linodeEmitter.Subscribers(),
+		"SystemdSubscribers": controller.systemdEmitter.Subscribers(),
+		"ConfigFiles":        files,
+	})
+}
+
+func NewHealth(p HealthParams) *Health {
+	return &Health{
+		workers:        p.Registry,
+		checks:         p.Checks,
+		linodeEmitter:  p.LinodeEmitter,
+		systemdEmitter: p.SystemdEmitter,
+		configFiles:    p.ConfigFiles,
+	}
+}
@@ -1,30 +1,89 @@
 package controller
 
 import (
+	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"html"
 	"net/http"
+	"time"
 
 	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
 	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/email"
 	"github.com/bdreece/herobrian/pkg/identity"
 	"github.com/bdreece/herobrian/pkg/token"
+	"github.com/gofrs/uuid"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/fx"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInviteUnavailable = errors.New("invite has been revoked, used or has expired")
+	ErrUsernameTaken     = errors.New("username is taken")
+)
+
+// inviteLifetimes are the expiry choices offered when sending an invite, in
+// hours.
+var inviteLifetimes = []struct {
+	Hours int
+	Label string
+}{
+	{1, "1 hour"},
+	{24, "1 day"},
+	{168, "1 week"},
+}
+
 type (
 	Invite struct {
-		db      database.Querier
-		handler token.Handler[token.UserInviteClaims]
+		db        *sql.DB
+		query     database.Querier
+		handler   token.Handler[token.UserInviteClaims]
+		outbox    *email.Outbox
+		templates *email.Templates
+		audit     audit.Recorder
+		baseURL   BaseURL
 	}
 
 	InviteParams struct {
 		fx.In
 
-		Querier database.Querier
-		Handler token.Handler[token.UserInviteClaims]
+		DB        *sql.DB
+		Querier   database.Querier
+		Handler   token.Handler[token.UserInviteClaims]
+		Outbox    *email.Outbox
+		Templates *email.Templates
+		Recorder  audit.Recorder
+		BaseURL   BaseURL
+	}
+
+	createInviteModel struct {
+		Role      int    `form:"role" validate:"min=0,max=3"`
+		Email     string `form:"email" validate:"omitempty,email,max=254"`
+		MaxUses   int64  `form:"maxUses" validate:"min=1,max=100"`
+		ExpiresIn int    `form:"expiresIn" validate:"min=1,max=168"`
+	}
+
+	inviteModel struct {
+		database.ListInvitesRow
+		Role       identity.Role
+		Status     string
+		RedeemedBy []string
+		Delivery   *inviteDelivery
+		CanRevoke  bool
+		CanResend  bool
+	}
+
+	// inviteDelivery is the latest email of an invite. Status follows the
+	// outbox message: pending, sent or dead, or failed if it was never
+	// queued.
+	inviteDelivery struct {
+		database.ListInviteDeliveriesRow
+		Status string
+		Reason string
 	}
 )
 
@@ -49,14 +108,18 @@ func (Invite) RenderSendInvite(c echo.Context) error {
 	}
 
 	return c.Render(http.StatusOK, "send-invite.gotmpl", echo.Map{
-		"Roles": roles,
+		"Roles":     roles,
+		"Lifetimes": inviteLifetimes,
 	})
 }
 
 func (controller *Invite) SendInvite(c echo.Context) error {
-	model := new(struct {
-		Role int `form:"role" validate:"min=0,max=3"`
-	})
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(createInviteModel)
 	if err := c.Bind(model); err != nil {
 		return err
 	}
@@ -64,30 +127,234 @@ func (controller *Invite) SendInvite(c echo.Context) error {
 		return err
 	}
 
-	t, err := controller.handler.Sign(&token.UserInviteClaims{
-		RoleID: model.Role,
-	})
+	invite, url, err := controller.create(c, claims, model)
 	if err != nil {
 		return err
 	}
 
-	var proto string
-	if c.IsTLS() {
-		proto = "https"
-	} else {
-		proto = "http"
+	status := ""
+	if invite.Email != nil {
+		if err = controller.deliver(c, invite, claims.Name(), url); err != nil {
+			status = fmt.Sprintf(`<p class="text-red-700">Failed to email %s: %s</p>`,
+				html.EscapeString(*invite.Email), html.EscapeString(err.Error()))
+		} else {
+			status = fmt.Sprintf(`<p>Invite email queued for %s.</p>`, html.EscapeString(*invite.Email))
+		}
 	}
+
 	return c.HTML(http.StatusOK, fmt.Sprintf(`
         <div class="bg-neutral-200 rounded p-2 overflow-x-scroll col-span-2">
+            %s
             <strong class="font-bold">Invite URL:</strong>
             <input
                 class="input"
                 type="text"
-                value="%s://%s/invite/%s"
+                value="%s"
                 is="invite-link"
             >
         </div>
-    `, proto, c.Request().Host, t))
+    `, status, url))
+}
+
+// create stores an invite and signs its URL. It is emailed by the caller.
+func (controller *Invite) create(c echo.Context, claims *identity.ClaimSet, model *createInviteModel) (*database.Invite, string, error) {
+	if int64(model.Role) > claims.Role {
+		return nil, "", echo.NewHTTPError(http.StatusForbidden, "cannot invite users above your own role")
+	}
+	if model.Email != "" && model.MaxUses != 1 {
+		return nil, "", echo.NewHTTPError(http.StatusBadRequest, "invites addressed to an email may only be used once")
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(time.Duration(model.ExpiresIn) * time.Hour)
+
+	var email *string
+	if model.Email != "" {
+		email = &model.Email
+	}
+
+	invite := database.Invite{
+		ID:        id.String(),
+		InviterID: claims.ID,
+		RoleID:    int64(model.Role),
+		Email:     email,
+		MaxUses:   model.MaxUses,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	err = controller.query.CreateInvite(c.Request().Context(), database.CreateInviteParams{
+		ID:        invite.ID,
+		InviterID: invite.InviterID,
+		RoleID:    invite.RoleID,
+		Email:     invite.Email,
+		MaxUses:   invite.MaxUses,
+		CreatedAt: invite.CreatedAt,
+		ExpiresAt: invite.ExpiresAt,
+	})
+
+	var url string
+	if err == nil {
+		url, err = controller.inviteURL(&invite)
+	}
+
+	recordAudit(c, controller.audit, audit.ActionInviteCreate, identity.Role(model.Role).String(), err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &invite, url, nil
+}
+
+func (controller *Invite) ResendInvite(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		ID string `param:"id" validate:"required,uuid"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	invite, err := controller.query.FindInvite(ctx, model.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "invite not found")
+	} else if err != nil {
+		return err
+	}
+
+	switch {
+	case invite.RoleID > claims.Role:
+		return echo.NewHTTPError(http.StatusForbidden, "cannot resend invites above your own role")
+	case invite.Email == nil:
+		return echo.NewHTTPError(http.StatusBadRequest, "invite is not addressed to an email")
+	case inviteStatus(invite.RevokedAt, invite.Uses, invite.MaxUses, invite.ExpiresAt, time.Now()) != "pending":
+		return echo.NewHTTPError(http.StatusGone, ErrInviteUnavailable.Error())
+	}
+
+	inviter := claims.Name()
+	if user, err := controller.query.FindUser(ctx, invite.InviterID); err == nil {
+		inviter = identity.NewClaimSet(&user).Name()
+	}
+
+	url, err := controller.inviteURL(&invite)
+	if err != nil {
+		return err
+	}
+
+	// failures are listed on the invites page, and delivery on the outbox page
+	_ = controller.deliver(c, &invite, inviter, url)
+
+	return c.Redirect(http.StatusFound, "/invites")
+}
+
+func (controller *Invite) RenderInvites(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	ctx := c.Request().Context()
+	invites, err := controller.query.ListInvites(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list invites: %w", err)
+	}
+
+	redemptions, err := controller.query.ListInviteRedemptions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list invite redemptions: %w", err)
+	}
+
+	deliveries, err := controller.query.ListInviteDeliveries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list invite deliveries: %w", err)
+	}
+
+	// deliveries are ordered by attempt, so the last one wins
+	lastDelivery := make(map[string]*inviteDelivery)
+	for _, d := range deliveries {
+		lastDelivery[d.InviteID] = newInviteDelivery(d)
+	}
+
+	redeemedBy := make(map[string][]string)
+	for _, r := range redemptions {
+		redeemedBy[r.InviteID] = append(redeemedBy[r.InviteID], r.Username)
+	}
+
+	now := time.Now()
+	models := make([]inviteModel, 0, len(invites))
+	for _, invite := range invites {
+		status := inviteStatus(invite.RevokedAt, invite.Uses, invite.MaxUses, invite.ExpiresAt, now)
+		models = append(models, inviteModel{
+			ListInvitesRow: invite,
+			Role:           identity.Role(invite.RoleID),
+			Status:         status,
+			RedeemedBy:     redeemedBy[invite.ID],
+			Delivery:       lastDelivery[invite.ID],
+			CanRevoke:      status == "pending" && invite.RoleID <= claims.Role,
+			CanResend:      status == "pending" && invite.RoleID <= claims.Role && invite.Email != nil,
+		})
+	}
+
+	return c.Render(http.StatusOK, "invites.gotmpl", echo.Map{
+		"Invites": models,
+	})
+}
+
+func (controller *Invite) RevokeInvite(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		ID string `param:"id" validate:"required,uuid"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	if err := controller.revoke(c, claims, model.ID); err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/invites")
+}
+
+func (controller *Invite) revoke(c echo.Context, claims *identity.ClaimSet, id string) error {
+	ctx := c.Request().Context()
+	invite, err := controller.query.FindInvite(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = echo.NewHTTPError(http.StatusNotFound, "invite not found")
+	} else if err == nil && invite.RoleID > claims.Role {
+		err = echo.NewHTTPError(http.StatusForbidden, "cannot revoke invites above your own role")
+	}
+
+	if err == nil {
+		now := time.Now().UTC()
+		_, err = controller.query.RevokeInvite(ctx, database.RevokeInviteParams{
+			RevokedAt: &now,
+			ID:        id,
+		})
+	}
+
+	recordAudit(c, controller.audit, audit.ActionInviteRevoke, id, err)
+	return err
 }
 
 func (controller *Invite) RenderAcceptInvite(c echo.Context) error {
@@ -101,11 +368,23 @@ func (controller *Invite) RenderAcceptInvite(c echo.Context) error {
 		return err
 	}
 
-	_, err := controller.handler.Verify(model.Token)
+	claims, err := controller.handler.Verify(model.Token)
 	if err != nil {
 		return err
 	}
 
+	invite, err := controller.query.FindInvite(c.Request().Context(), claims.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "invite not found")
+	}
+
+	if inviteStatus(invite.RevokedAt, invite.Uses, invite.MaxUses, invite.ExpiresAt, time.Now()) != "pending" {
+		return c.Render(http.StatusOK, "message.gotmpl", echo.Map{
+			"Title":   "Invite Unavailable",
+			"Message": "This invite has been revoked, used or has expired.",
+		})
+	}
+
 	return c.Render(http.StatusOK, "accept-invite.gotmpl", echo.Map{
 		"Token": model.Token,
 	})
@@ -127,6 +406,7 @@ func (controller *Invite) AcceptInvite(c echo.Context) error {
 
 	claims, err := controller.handler.Verify(model.Token)
 	if err != nil {
+		controller.recordAccept(c, nil, model.Username, err)
 		return err
 	}
 
@@ -135,19 +415,195 @@ func (controller *Invite) AcceptInvite(c echo.Context) error {
 		return err
 	}
 
-	_, err = controller.db.CreateUser(c.Request().Context(), database.CreateUserParams{
+	id, err := controller.redeem(c, claims.ID, database.CreateUserParams{
 		Username:     model.Username,
 		PasswordHash: base64.StdEncoding.EncodeToString(hash),
-		RoleID:       int64(claims.RoleID),
 	})
 	if err != nil {
+		controller.recordAccept(c, nil, model.Username, err)
+		if errors.Is(err, ErrUsernameTaken) {
+			return c.Render(http.StatusOK, "accept-invite.gotmpl", echo.Map{
+				"Token":    model.Token,
+				"Username": model.Username,
+				"Error":    "That username is taken.",
+			})
+		}
+
 		return err
 	}
 
+	controller.recordAccept(c, &id, model.Username, nil)
+
 	c.Response().Header().Add("HX-Location", "/login")
 	return c.NoContent(http.StatusOK)
 }
 
+// redeem consumes a use of the invite and creates the user in a single
+// transaction, taking the role and email from the stored invite.
+func (controller *Invite) redeem(c echo.Context, inviteID string, params database.CreateUserParams) (int64, error) {
+	ctx := c.Request().Context()
+	tx, err := controller.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := database.WithTx(controller.db, tx)
+	now := time.Now().UTC()
+	n, err := query.ConsumeInvite(ctx, database.ConsumeInviteParams{
+		ID:  inviteID,
+		Now: now,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, echo.NewHTTPError(http.StatusGone, ErrInviteUnavailable.Error())
+	}
+
+	invite, err := query.FindInvite(ctx, inviteID)
+	if err != nil {
+		return 0, err
+	}
+
+	params.RoleID = invite.RoleID
+	id, err := query.CreateUser(ctx, params)
+	if database.IsUniqueViolation(err) {
+		return 0, ErrUsernameTaken
+	} else if err != nil {
+		return 0, err
+	}
+
+	if invite.Email != nil {
+		_, err = query.UpdateUserEmail(ctx, database.UpdateUserEmailParams{
+			Email: invite.Email,
+			ID:    id,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = query.CreateInviteRedemption(ctx, database.CreateInviteRedemptionParams{
+		InviteID:   inviteID,
+		UserID:     id,
+		RedeemedAt: now,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (controller *Invite) recordAccept(c echo.Context, id *int64, username string, err error) {
+	controller.audit.Record(c.Request().Context(), &audit.Event{
+		ActorID:    id,
+		ActorName:  username,
+		Action:     audit.ActionInviteAccept,
+		Target:     username,
+		RemoteAddr: c.RealIP(),
+		Err:        err,
+	})
+}
+
+// inviteURL signs a token for the stored invite. Tokens for the same invite
+// share its ID and expiry, so any of them may be redeemed.
+func (controller *Invite) inviteURL(invite *database.Invite) (string, error) {
+	t, err := controller.handler.Sign(&token.UserInviteClaims{
+		ID:        invite.ID,
+		ExpiresAt: invite.ExpiresAt.Unix(),
+		RoleID:    int(invite.RoleID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return controller.baseURL.Join("/invite/" + t), nil
+}
+
+// deliver queues the invite email for its address and records the outbox
+// message, from which the invites page shows whether it was sent.
+func (controller *Invite) deliver(c echo.Context, invite *database.Invite, inviter string, url string) error {
+	ctx := c.Request().Context()
+	msg, err := controller.templates.Render("invite", email.Address{
+		Email: *invite.Email,
+	}, map[string]any{
+		"Inviter":   inviter,
+		"Role":      identity.Role(invite.RoleID),
+		"URL":       url,
+		"ExpiresAt": invite.ExpiresAt,
+	})
+	var messageID *int64
+	if err == nil {
+		var id int64
+		if id, err = controller.outbox.Enqueue(ctx, msg); err == nil {
+			messageID = &id
+		}
+	}
+
+	var reason *string
+	if err != nil {
+		reason = new(string)
+		*reason = err.Error()
+	}
+
+	if dberr := controller.query.CreateInviteDelivery(ctx, database.CreateInviteDeliveryParams{
+		InviteID:        invite.ID,
+		Email:           *invite.Email,
+		AttemptedAt:     time.Now().UTC(),
+		Error:           reason,
+		OutboxMessageID: messageID,
+	}); dberr != nil {
+		c.Logger().Error(dberr)
+	}
+
+	recordAudit(c, controller.audit, audit.ActionInviteEmail, *invite.Email, err)
+	return err
+}
+
+func newInviteDelivery(d database.ListInviteDeliveriesRow) *inviteDelivery {
+	delivery := &inviteDelivery{ListInviteDeliveriesRow: d}
+	switch {
+	case d.Error != nil:
+		delivery.Status, delivery.Reason = "failed", *d.Error
+	case d.OutboxMessageID == nil:
+		// queued before outbox messages were recorded, so not followed
+		delivery.Status = "queued"
+	case d.OutboxStatus == nil:
+		// the outbox only deletes messages once they are sent
+		delivery.Status = email.OutboxStatusSent
+	default:
+		delivery.Status = *d.OutboxStatus
+		if d.OutboxError != nil {
+			delivery.Reason = *d.OutboxError
+		}
+	}
+
+	return delivery
+}
+
+func inviteStatus(revokedAt *time.Time, uses, maxUses int64, expiresAt, now time.Time) string {
+	switch {
+	case revokedAt != nil:
+		return "revoked"
+	case uses >= maxUses:
+		return "used"
+	case !expiresAt.After(now):
+		return "expired"
+	default:
+		return "pending"
+	}
+}
+
 func NewInvite(p InviteParams) *Invite {
-	return &Invite{p.Querier, p.Handler}
+	return &Invite{
+		db:        p.DB,
+		query:     p.Querier,
+		handler:   p.Handler,
+		outbox:    p.Outbox,
+		templates: p.Templates,
+		audit:     p.Recorder,
+		baseURL:   p.BaseURL,
+	}
 }
@@ -0,0 +1,288 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	echovalidator "github.com/bdreece/echo-validator"
+	"github.com/labstack/echo/v4"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/email"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/bdreece/herobrian/pkg/token"
+	"github.com/bdreece/herobrian/pkg/worker"
+	"github.com/bdreece/herobrian/web"
+)
+
+func TestSendInviteEmail(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	query := database.NewQuerier(db)
+	id, err := query.CreateUser(ctx, database.CreateUserParams{Username: "steve", PasswordHash: "hash", RoleID: int64(identity.RoleModerator)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = query.UpdateUserProfile(ctx, database.UpdateUserProfileParams{DisplayName: "Steve the Miner", ID: id}); err != nil {
+		t.Fatal(err)
+	}
+	steve, err := query.FindUser(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	capture := email.NewCaptureClient()
+	outbox := email.NewOutbox(email.OutboxParams{
+		Querier:   query,
+		Transport: capture,
+		Options:   new(email.Options),
+		Registry:  worker.NewRegistry(),
+		Logger:    logger,
+	})
+	if err = outbox.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { outbox.Stop(context.Background()) })
+
+	handler := newInviteHandler()
+	controller := NewInvite(InviteParams{
+		DB:        db,
+		Querier:   query,
+		Handler:   handler,
+		Outbox:    outbox,
+		Templates: email.NewTemplates(web.EmailTemplates),
+		Recorder:  audit.NewRecorder(audit.RecorderParams{Querier: query, Logger: logger}),
+		BaseURL:   "https://herobrian.test/",
+	})
+
+	e := echo.New()
+	e.Validator = echovalidator.Default
+
+	form := url.Values{
+		"role":      {"0"},
+		"email":     {"alex@example.com"},
+		"maxUses":   {"1"},
+		"expiresIn": {"24"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/invite", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	// links are built from the configured address, never the Host header
+	req.Host = "attacker.example"
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(middleware.ClaimsContextKey, identity.NewClaimSet(&steve))
+
+	if err = controller.SendInvite(c); err != nil {
+		t.Fatalf("failed to send invite: %v", err)
+	}
+	if !strings.Contains(rec.Body.String(), "Invite email queued for alex@example.com") {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+
+	var messages []email.Message
+	for deadline := time.Now().Add(5 * time.Second); len(messages) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		messages = capture.Messages()
+	}
+	if len(messages) != 1 {
+		t.Fatalf("captured %d messages, want 1", len(messages))
+	}
+
+	invites, err := query.ListInvites(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invites) != 1 {
+		t.Fatalf("found %d invites, want 1", len(invites))
+	}
+	invite := invites[0]
+
+	msg := messages[0]
+	if len(msg.To) != 1 || msg.To[0].Email != "alex@example.com" {
+		t.Errorf("message is addressed to %+v", msg.To)
+	}
+	if msg.Subject != "Steve the Miner invited you to herobrian" {
+		t.Errorf("subject is %q", msg.Subject)
+	}
+
+	link := ""
+	for _, line := range strings.Split(msg.Text, "\n") {
+		if strings.HasPrefix(line, "https://herobrian.test/invite/") {
+			link = line
+		}
+	}
+	if link == "" {
+		t.Fatalf("text part has no invite link:\n%s", msg.Text)
+	}
+	if strings.Contains(msg.Text+msg.HTML, "attacker.example") {
+		t.Errorf("message links to the Host header:\n%s", msg.Text)
+	}
+	claims, err := handler.Verify(strings.TrimPrefix(link, "https://herobrian.test/invite/"))
+	if err != nil || claims.ID != invite.ID || claims.ExpiresAt != invite.ExpiresAt.Unix() {
+		t.Errorf("link is for %+v, %v, want invite %s", claims, err, invite.ID)
+	}
+
+	expiry := invite.ExpiresAt.Format("Monday, January 2 at 15:04 MST")
+	for name, body := range map[string]string{"text": msg.Text, "HTML": msg.HTML} {
+		if !strings.Contains(body, "Steve the Miner has invited you to join herobrian as a User") {
+			t.Errorf("%s part does not name the inviter and role:\n%s", name, body)
+		}
+		if !strings.Contains(body, expiry) {
+			t.Errorf("%s part does not give the expiry %q:\n%s", name, expiry, body)
+		}
+	}
+	if !strings.Contains(msg.HTML, `<a href="`+html.EscapeString(link)+`">`) {
+		t.Errorf("HTML part does not link to %s:\n%s", link, msg.HTML)
+	}
+
+	// the message is marked sent after the transport returns
+	var delivery *inviteDelivery
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		deliveries, err := query.ListInviteDeliveries(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("found %d deliveries, want 1", len(deliveries))
+		}
+		if delivery = newInviteDelivery(deliveries[0]); delivery.Status == email.OutboxStatusSent {
+			break
+		}
+	}
+	if delivery.Status != email.OutboxStatusSent {
+		t.Errorf("delivery is %s, want sent", delivery.Status)
+	}
+}
+
+func TestAcceptInviteUsernameTaken(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	query := database.NewQuerier(db)
+	steve, err := query.CreateUser(ctx, database.CreateUserParams{Username: "steve", PasswordHash: "hash", RoleID: int64(identity.RoleAdmin)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	err = query.CreateInvite(ctx, database.CreateInviteParams{
+		ID:        "invite",
+		InviterID: steve,
+		RoleID:    int64(identity.RoleUser),
+		MaxUses:   1,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := newInviteHandler()
+	tok, err := handler.Sign(&token.UserInviteClaims{ID: "invite", ExpiresAt: now.Add(time.Hour).Unix(), RoleID: int(identity.RoleUser)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controller := NewInvite(InviteParams{
+		DB:       db,
+		Querier:  query,
+		Handler:  handler,
+		Recorder: nopRecorder{},
+	})
+
+	renderer := new(renderRecorder)
+	e := echo.New()
+	e.Validator = echovalidator.Default
+	e.Renderer = renderer
+
+	accept := func(username string) (*httptest.ResponseRecorder, error) {
+		form := url.Values{
+			"username":        {username},
+			"password":        {"password123"},
+			"confirmPassword": {"password123"},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/invite/"+tok, strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("token")
+		c.SetParamValues(tok)
+
+		return rec, controller.AcceptInvite(c)
+	}
+
+	rec, err := accept("steve")
+	if err != nil {
+		t.Fatalf("accepting with a taken username returned %v", err)
+	}
+	data, _ := renderer.data.(echo.Map)
+	if rec.Code != http.StatusOK || renderer.name != "accept-invite.gotmpl" || data["Username"] != "steve" || data["Error"] == nil {
+		t.Errorf("rendered %s with %v (%d), want the form with an error", renderer.name, renderer.data, rec.Code)
+	}
+
+	// the failed attempt does not use up the invite
+	if _, err = accept("alex"); err != nil {
+		t.Fatalf("failed to accept invite: %v", err)
+	}
+	if _, err = query.FindUserByUsername(ctx, "alex"); err != nil {
+		t.Errorf("invitee was not created: %v", err)
+	}
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open(database.SQLite, "file:"+filepath.Join(t.TempDir(), "herobrian.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err = database.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func newInviteHandler() token.Handler[token.UserInviteClaims] {
+	return token.NewHandler[token.UserInviteClaims](&token.Options{
+		Audience:  "herobrian",
+		Issuer:    "herobrian",
+		ValidFor:  "1h",
+		SecretKey: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))),
+	})
+}
+
+// renderRecorder records the last template rendered.
+type renderRecorder struct {
+	name string
+	data any
+}
+
+func (r *renderRecorder) Render(_ io.Writer, name string, data any, _ echo.Context) error {
+	r.name, r.data = name, data
+	return nil
+}
+
+// testWriter logs to the test.
+type testWriter struct{ t *testing.T }
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
@@ -8,9 +8,13 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
 	"github.com/bdreece/herobrian/pkg/cron"
+	"github.com/bdreece/herobrian/pkg/identity"
 	"github.com/bdreece/herobrian/pkg/linode"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
 	"golang.org/x/sync/singleflight"
 )
 
@@ -62,14 +66,28 @@ var (
 
 const key string = "linode"
 
-type Linode struct {
-	client linode.Client
-	logger *slog.Logger
-	group  singleflight.Group
-}
+type (
+	Linode struct {
+		client linode.Client
+		opts   *linode.Options
+		audit  audit.Recorder
+		logger *slog.Logger
+		group  singleflight.Group
+	}
+
+	LinodeParams struct {
+		fx.In
+
+		Client   linode.Client
+		Options  *linode.Options
+		Recorder audit.Recorder
+		Logger   *slog.Logger
+	}
+)
 
 func (controller *Linode) Boot(c echo.Context) error {
 	err := controller.client.BootInstance(c.Request().Context())
+	recordAudit(c, controller.audit, audit.ActionLinodeBoot, controller.opts.InstanceID, err)
 	if err != nil {
 		return err
 	}
@@ -79,6 +97,7 @@ func (controller *Linode) Boot(c echo.Context) error {
 
 func (controller *Linode) Reboot(c echo.Context) error {
 	err := controller.client.RebootInstance(c.Request().Context())
+	recordAudit(c, controller.audit, audit.ActionLinodeReboot, controller.opts.InstanceID, err)
 	if err != nil {
 		return err
 	}
@@ -88,6 +107,7 @@ func (controller *Linode) Reboot(c echo.Context) error {
 
 func (controller *Linode) Shutdown(c echo.Context) error {
 	err := controller.client.ShutdownInstance(c.Request().Context())
+	recordAudit(c, controller.audit, audit.ActionLinodeShutdown, controller.opts.InstanceID, err)
 	if err != nil {
 		return err
 	}
@@ -101,6 +121,13 @@ func (controller *Linode) SSE(c echo.Context) error {
 		interval = 2 * time.Second
 	)
 
+	claims, _ := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	var canBoot, canPower bool
+	if claims != nil {
+		canBoot = identity.Role(claims.Role).Can(identity.PermissionLinodeBoot)
+		canPower = identity.Role(claims.Role).Can(identity.PermissionLinodePower)
+	}
+
 	c.Logger().Info("subscribing to server-sent events")
 
 	w := c.Response()
@@ -127,9 +154,9 @@ func (controller *Linode) SSE(c echo.Context) error {
 		controller.logger.Debug("got status", slog.String("status", status.String()))
 		_, _ = linodeStatusEvent(status).WriteTo(&buf)
 
-		if status == linode.StatusRunning {
+		if status == linode.StatusRunning && canPower {
 			_, _ = linodeRunningEvent.WriteTo(&buf)
-		} else if status == linode.StatusOffline {
+		} else if status == linode.StatusOffline && canBoot {
 			_, _ = linodeOfflineEvent.WriteTo(&buf)
 		}
 
@@ -144,10 +171,12 @@ func (controller *Linode) SSE(c echo.Context) error {
 	return nil
 }
 
-func NewLinode(client linode.Client, logger *slog.Logger) *Linode {
+func NewLinode(p LinodeParams) *Linode {
 	return &Linode{
-		client: client,
-		logger: logger,
+		client: p.Client,
+		opts:   p.Options,
+		audit:  p.Recorder,
+		logger: p.Logger,
 	}
 }
 
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/bdreece/herobrian/pkg/linode"
+	"github.com/bdreece/herobrian/pkg/notify"
+	"github.com/bdreece/herobrian/pkg/systemd"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrPreferenceNotFound   = errors.New("notification preference not found")
+	ErrSubscriptionNotFound = errors.New("push subscription not found")
+	ErrPushDisabled         = errors.New("web push is not enabled")
+	ErrInvalidInstance      = errors.New("invalid instance")
+)
+
+// notificationEvents are the events users may subscribe to, in the order
+// they are offered.
+var notificationEvents = []notificationEvent{
+	{"linode." + linode.StatusRunning.String(), "Server is up", false},
+	{"linode." + linode.StatusOffline.String(), "Server is down", false},
+	{notify.EventUnitStarted, "Instance started", true},
+	{notify.EventUnitStopped, "Instance stopped", true},
+	{notify.EventUnitFailed, "Instance crashed", true},
+}
+
+type (
+	Notifications struct {
+		query    database.Querier
+		notifier *notify.Notifier
+		services *systemd.ServiceFactory
+	}
+
+	NotificationsParams struct {
+		fx.In
+
+		Querier        database.Querier
+		Notifier       *notify.Notifier
+		ServiceFactory *systemd.ServiceFactory
+	}
+
+	notificationEvent struct {
+		Name     string
+		Label    string
+		Instance bool
+	}
+
+	notificationPreferenceModel struct {
+		Event    string `form:"event" validate:"required"`
+		Instance string `form:"instance" validate:"max=255"`
+		Channel  string `form:"channel" validate:"required,oneof=email push"`
+	}
+)
+
+func (controller *Notifications) RenderNotifications(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	ctx := c.Request().Context()
+	user, err := controller.query.FindUser(ctx, claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	preferences, err := controller.query.ListNotificationPreferences(ctx, claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list notification preferences: %w", err)
+	}
+
+	subscriptions, err := controller.query.ListPushSubscriptions(ctx, claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list push subscriptions: %w", err)
+	}
+
+	labels := make(map[string]string, len(notificationEvents))
+	for _, e := range notificationEvents {
+		labels[e.Name] = e.Label
+	}
+
+	devices := make(map[int64]string, len(subscriptions))
+	for _, s := range subscriptions {
+		devices[s.ID] = describeDevice(s.UserAgent)
+	}
+
+	return c.Render(http.StatusOK, "notifications.gotmpl", echo.Map{
+		"User":          user,
+		"Events":        notificationEvents,
+		"Labels":        labels,
+		"Units":         controller.services.Units(),
+		"Preferences":   preferences,
+		"Subscriptions": subscriptions,
+		"Devices":       devices,
+		"PushKey":       controller.notifier.PushKey(),
+	})
+}
+
+func (controller *Notifications) CreatePreference(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(notificationPreferenceModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+	if err := controller.validatePreference(model); err != nil {
+		return err
+	}
+
+	err := controller.query.CreateNotificationPreference(c.Request().Context(), database.CreateNotificationPreferenceParams{
+		UserID:    claims.ID,
+		Event:     model.Event,
+		Instance:  model.Instance,
+		Channel:   model.Channel,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create notification preference: %w", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/account/notifications")
+}
+
+func (controller *Notifications) RemovePreference(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(notificationPreferenceModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	n, err := controller.query.RemoveNotificationPreference(c.Request().Context(), database.RemoveNotificationPreferenceParams{
+		UserID:   claims.ID,
+		Event:    model.Event,
+		Instance: model.Instance,
+		Channel:  model.Channel,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove notification preference: %w", err)
+	}
+	if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, ErrPreferenceNotFound.Error())
+	}
+
+	return c.Redirect(http.StatusFound, "/account/notifications")
+}
+
+// Subscribe stores the browser's push subscription. It is posted as JSON by
+// the push-subscribe element.
+func (controller *Notifications) Subscribe(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	if controller.notifier.PushKey() == "" {
+		return echo.NewHTTPError(http.StatusNotFound, ErrPushDisabled.Error())
+	}
+
+	sub := new(notify.PushSubscription)
+	if err := c.Bind(sub); err != nil {
+		return err
+	}
+	if err := sub.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	err := controller.query.CreatePushSubscription(c.Request().Context(), database.CreatePushSubscriptionParams{
+		UserID:    claims.ID,
+		Endpoint:  sub.Endpoint,
+		P256dh:    sub.Keys.P256dh,
+		Auth:      sub.Keys.Auth,
+		UserAgent: c.Request().UserAgent(),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create push subscription: %w", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (controller *Notifications) Unsubscribe(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		ID int64 `param:"id" validate:"required"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	n, err := controller.query.RemovePushSubscription(c.Request().Context(), database.RemovePushSubscriptionParams{
+		ID:     model.ID,
+		UserID: claims.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove push subscription: %w", err)
+	}
+	if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, ErrSubscriptionNotFound.Error())
+	}
+
+	return c.Redirect(http.StatusFound, "/account/notifications")
+}
+
+// validatePreference checks the event is offered and the instance, if any,
+// names a configured unit. Linode events never have an instance.
+func (controller *Notifications) validatePreference(model *notificationPreferenceModel) error {
+	i := slices.IndexFunc(notificationEvents, func(e notificationEvent) bool {
+		return e.Name == model.Event
+	})
+	if i < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown event %q", model.Event))
+	}
+
+	model.Instance = strings.TrimSpace(model.Instance)
+	if model.Instance == "" {
+		return nil
+	}
+
+	if !notificationEvents[i].Instance || !slices.ContainsFunc(controller.services.Units(), func(u systemd.Unit) bool {
+		return u.Instance == model.Instance
+	}) {
+		return echo.NewHTTPError(http.StatusBadRequest, ErrInvalidInstance.Error())
+	}
+
+	return nil
+}
+
+func NewNotifications(p NotificationsParams) *Notifications {
+	return &Notifications{p.Querier, p.Notifier, p.ServiceFactory}
+}
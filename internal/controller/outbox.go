@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/email"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+const outboxPageSize = 100
+
+type (
+	Outbox struct {
+		outbox *email.Outbox
+		audit  audit.Recorder
+	}
+
+	OutboxParams struct {
+		fx.In
+
+		Outbox   *email.Outbox
+		Recorder audit.Recorder
+	}
+)
+
+func (controller *Outbox) RenderOutbox(c echo.Context) error {
+	model := new(struct {
+		Status string `query:"status" validate:"omitempty,oneof=pending sent dead"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	messages, err := controller.outbox.List(c.Request().Context(), model.Status, outboxPageSize)
+	if err != nil {
+		return fmt.Errorf("failed to list outbox messages: %w", err)
+	}
+
+	return c.Render(http.StatusOK, "outbox.gotmpl", echo.Map{
+		"Status":   model.Status,
+		"Statuses": []string{email.OutboxStatusPending, email.OutboxStatusSent, email.OutboxStatusDead},
+		"Messages": messages,
+	})
+}
+
+func (controller *Outbox) RetryMessage(c echo.Context) error {
+	model := new(struct {
+		ID int64 `param:"id" validate:"required"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	err := controller.outbox.Retry(c.Request().Context(), model.ID)
+	if errors.Is(err, email.ErrOutboxMessageNotFound) {
+		err = echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	recordAudit(c, controller.audit, audit.ActionOutboxRetry, strconv.FormatInt(model.ID, 10), err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/outbox")
+}
+
+func NewOutbox(p OutboxParams) *Outbox {
+	return &Outbox{p.Outbox, p.Recorder}
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+var ErrPasskeyNotFound = errors.New("passkey not found")
+
+type (
+	Passkeys struct {
+		query    database.Querier
+		passkeys *identity.PasskeyManager
+		audit    audit.Recorder
+	}
+
+	PasskeysParams struct {
+		fx.In
+
+		Querier        database.Querier
+		PasskeyManager *identity.PasskeyManager
+		Recorder       audit.Recorder
+	}
+)
+
+func (controller *Passkeys) RenderPasskeys(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	passkeys, err := controller.query.ListPasskeys(c.Request().Context(), claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list passkeys: %w", err)
+	}
+
+	return c.Render(http.StatusOK, "passkeys.gotmpl", echo.Map{
+		"Passkeys": passkeys,
+	})
+}
+
+// BeginRegistration returns the options for navigator.credentials.create.
+// It is fetched by the passkey-register element.
+func (controller *Passkeys) BeginRegistration(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	creation, err := controller.passkeys.BeginRegistration(c, claims)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, creation)
+}
+
+// FinishRegistration stores the credential posted as JSON by the
+// passkey-register element. The name is given in the query string.
+func (controller *Passkeys) FinishRegistration(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	// the body is the credential, so the name is not bound with it
+	model := &struct {
+		Name string `validate:"required,max=63"`
+	}{strings.TrimSpace(c.QueryParam("name"))}
+	if err := c.Validate(model); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	err := controller.passkeys.FinishRegistration(c, claims, model.Name)
+	recordAudit(c, controller.audit, audit.ActionPasskeyRegister, model.Name, err)
+	if errors.Is(err, identity.ErrNoCeremony) || errors.Is(err, identity.ErrInvalidPasskey) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (controller *Passkeys) Rename(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		ID   int64  `param:"id" validate:"required"`
+		Name string `form:"name" validate:"required,max=63"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	model.Name = strings.TrimSpace(model.Name)
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	n, err := controller.query.RenamePasskey(c.Request().Context(), database.RenamePasskeyParams{
+		Name:   model.Name,
+		ID:     model.ID,
+		UserID: claims.ID,
+	})
+	if err == nil && n == 0 {
+		err = ErrPasskeyNotFound
+	}
+
+	recordAudit(c, controller.audit, audit.ActionPasskeyRename, model.Name, err)
+	if errors.Is(err, ErrPasskeyNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return fmt.Errorf("failed to rename passkey: %w", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/account/passkeys")
+}
+
+func (controller *Passkeys) Remove(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		ID int64 `param:"id" validate:"required"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	n, err := controller.query.RemovePasskey(c.Request().Context(), database.RemovePasskeyParams{
+		ID:     model.ID,
+		UserID: claims.ID,
+	})
+	if err == nil && n == 0 {
+		err = ErrPasskeyNotFound
+	}
+
+	recordAudit(c, controller.audit, audit.ActionPasskeyRemove, fmt.Sprint(model.ID), err)
+	if errors.Is(err, ErrPasskeyNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return fmt.Errorf("failed to remove passkey: %w", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/account/passkeys")
+}
+
+func NewPasskeys(p PasskeysParams) *Passkeys {
+	return &Passkeys{p.Querier, p.PasskeyManager, p.Recorder}
+}
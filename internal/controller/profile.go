@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/bdreece/herobrian/pkg/mojang"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+type (
+	Profile struct {
+		query    database.Querier
+		profiles *identity.ProfileManager
+		audit    audit.Recorder
+		logger   *slog.Logger
+	}
+
+	ProfileParams struct {
+		fx.In
+
+		Querier        database.Querier
+		ProfileManager *identity.ProfileManager
+		Recorder       audit.Recorder
+		Logger         *slog.Logger
+	}
+)
+
+func (controller *Profile) RenderProfile(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	user, err := controller.query.FindUser(c.Request().Context(), claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	return c.Render(http.StatusOK, "profile.gotmpl", echo.Map{
+		"User":           user,
+		"AvatarSource":   identity.AvatarSource(user.AvatarSource),
+		"MaxAvatarBytes": identity.MaxAvatarBytes,
+	})
+}
+
+func (controller *Profile) UpdateProfile(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		FirstName         string `form:"firstName" validate:"max=63"`
+		LastName          string `form:"lastName" validate:"max=63"`
+		DisplayName       string `form:"displayName" validate:"max=63"`
+		MinecraftUsername string `form:"minecraftUsername" validate:"max=16"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	err := controller.profiles.UpdateProfile(c.Request().Context(), claims, &identity.Profile{
+		FirstName:         model.FirstName,
+		LastName:          model.LastName,
+		DisplayName:       model.DisplayName,
+		MinecraftUsername: model.MinecraftUsername,
+	})
+	recordAudit(c, controller.audit, audit.ActionProfileChange, claims.Username, err)
+	switch {
+	case errors.Is(err, mojang.ErrProfileNotFound):
+		return c.HTML(http.StatusOK, `<p class="text-red-600">No Minecraft account has that username.</p>`)
+	case errors.Is(err, identity.ErrMinecraftUsernameTaken):
+		return c.HTML(http.StatusOK, fmt.Sprintf(`<p class="text-red-600">%s.</p>`, capitalize(err.Error())))
+	case err != nil:
+		controller.logger.Error("failed to update profile", slog.String("error", err.Error()))
+		return c.HTML(http.StatusOK, `<p class="text-red-600">Failed to update your profile.</p>`)
+	}
+
+	c.Response().Header().Add("HX-Location", "/account/profile")
+	return c.NoContent(http.StatusOK)
+}
+
+// UploadAvatar replaces the avatar with the image in the avatar field of a
+// multipart form.
+func (controller *Profile) UploadAvatar(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	fh, err := c.FormFile("avatar")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "avatar is required")
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = controller.profiles.UploadAvatar(c.Request().Context(), claims, f)
+	recordAudit(c, controller.audit, audit.ActionAvatarChange, claims.Username, err)
+	if errors.Is(err, identity.ErrInvalidAvatar) {
+		return c.HTML(http.StatusOK, fmt.Sprintf(`<p class="text-red-600">%s.</p>`, capitalize(err.Error())))
+	} else if err != nil {
+		return fmt.Errorf("failed to upload avatar: %w", err)
+	}
+
+	c.Response().Header().Add("HX-Location", "/account/profile")
+	return c.NoContent(http.StatusOK)
+}
+
+func (controller *Profile) UseMojangAvatar(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	err := controller.profiles.UseMojangAvatar(c.Request().Context(), claims)
+	recordAudit(c, controller.audit, audit.ActionAvatarChange, claims.Username, err)
+	switch {
+	case errors.Is(err, identity.ErrNoMinecraftUsername):
+		return c.HTML(http.StatusOK, `<p class="text-red-600">Set your Minecraft username first.</p>`)
+	case errors.Is(err, mojang.ErrNoSkin):
+		return c.HTML(http.StatusOK, `<p class="text-red-600">Your Minecraft account uses a default skin.</p>`)
+	case err != nil:
+		controller.logger.Error("failed to use minecraft avatar", slog.String("error", err.Error()))
+		return c.HTML(http.StatusOK, `<p class="text-red-600">Failed to download your Minecraft skin.</p>`)
+	}
+
+	c.Response().Header().Add("HX-Location", "/account/profile")
+	return c.NoContent(http.StatusOK)
+}
+
+func (controller *Profile) RemoveAvatar(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	err := controller.profiles.RemoveAvatar(c.Request().Context(), claims)
+	recordAudit(c, controller.audit, audit.ActionAvatarChange, claims.Username, err)
+	if err != nil {
+		return fmt.Errorf("failed to remove avatar: %w", err)
+	}
+
+	c.Response().Header().Add("HX-Location", "/account/profile")
+	return c.NoContent(http.StatusOK)
+}
+
+// Avatar serves the avatar of any user to signed-in users. Browsers
+// revalidate it on each use, so a new avatar shows at once.
+func (controller *Profile) Avatar(c echo.Context) error {
+	model := new(struct {
+		ID int64 `param:"id"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+
+	avatar, err := controller.profiles.Avatar(c.Request().Context(), model.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusNotFound, "avatar not found")
+	} else if err != nil {
+		return fmt.Errorf("failed to find avatar: %w", err)
+	}
+
+	etag := `"` + strconv.FormatInt(avatar.UpdatedAt.UnixNano(), 36) + `"`
+	c.Response().Header().Set("Cache-Control", "private, no-cache")
+	c.Response().Header().Set("ETag", etag)
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.Blob(http.StatusOK, "image/png", avatar.Image)
+}
+
+func NewProfile(p ProfileParams) *Profile {
+	return &Profile{p.Querier, p.ProfileManager, p.Recorder, p.Logger}
+}
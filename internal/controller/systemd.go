@@ -9,9 +9,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bdreece/herobrian/pkg/audit"
 	"github.com/bdreece/herobrian/pkg/cron"
 	"github.com/bdreece/herobrian/pkg/systemd"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
 	"golang.org/x/sync/singleflight"
 )
 
@@ -19,11 +21,22 @@ var (
 	ErrInstanceNotFound = errors.New("systemd unit instance not found")
 )
 
-type Systemd struct {
-	services *systemd.ServiceFactory
-	logger   *slog.Logger
-	group    singleflight.Group
-}
+type (
+	Systemd struct {
+		services *systemd.ServiceFactory
+		audit    audit.Recorder
+		logger   *slog.Logger
+		group    singleflight.Group
+	}
+
+	SystemdParams struct {
+		fx.In
+
+		ServiceFactory *systemd.ServiceFactory
+		Recorder       audit.Recorder
+		Logger         *slog.Logger
+	}
+)
 
 type systemdModel struct {
 	Instance string `param:"instance" validate:"required"`
@@ -32,10 +45,13 @@ type systemdModel struct {
 func (controller *Systemd) Enable(c echo.Context) error {
 	svc, err := controller.resolveService(c)
 	if err != nil {
+		recordAudit(c, controller.audit, audit.ActionUnitEnable, c.Param("instance"), err)
 		return err
 	}
 
-	if err := svc.Enable(c.Request().Context()); err != nil {
+	err = svc.Enable(c.Request().Context())
+	recordAudit(c, controller.audit, audit.ActionUnitEnable, svc.Unit().Instance, err)
+	if err != nil {
 		return err
 	}
 
@@ -54,10 +70,13 @@ func (controller *Systemd) Enable(c echo.Context) error {
 func (controller *Systemd) Disable(c echo.Context) error {
 	svc, err := controller.resolveService(c)
 	if err != nil {
+		recordAudit(c, controller.audit, audit.ActionUnitDisable, c.Param("instance"), err)
 		return err
 	}
 
-	if err := svc.Disable(c.Request().Context()); err != nil {
+	err = svc.Disable(c.Request().Context())
+	recordAudit(c, controller.audit, audit.ActionUnitDisable, svc.Unit().Instance, err)
+	if err != nil {
 		return err
 	}
 
@@ -76,10 +95,13 @@ func (controller *Systemd) Disable(c echo.Context) error {
 func (controller *Systemd) Start(c echo.Context) error {
 	svc, err := controller.resolveService(c)
 	if err != nil {
+		recordAudit(c, controller.audit, audit.ActionUnitStart, c.Param("instance"), err)
 		return err
 	}
 
-	if err := svc.Start(c.Request().Context()); err != nil {
+	err = svc.Start(c.Request().Context())
+	recordAudit(c, controller.audit, audit.ActionUnitStart, svc.Unit().Instance, err)
+	if err != nil {
 		return err
 	}
 
@@ -98,10 +120,13 @@ func (controller *Systemd) Start(c echo.Context) error {
 func (controller *Systemd) Stop(c echo.Context) error {
 	svc, err := controller.resolveService(c)
 	if err != nil {
+		recordAudit(c, controller.audit, audit.ActionUnitStop, c.Param("instance"), err)
 		return err
 	}
 
-	if err := svc.Stop(c.Request().Context()); err != nil {
+	err = svc.Stop(c.Request().Context())
+	recordAudit(c, controller.audit, audit.ActionUnitStop, svc.Unit().Instance, err)
+	if err != nil {
 		return err
 	}
 
@@ -120,10 +145,13 @@ func (controller *Systemd) Stop(c echo.Context) error {
 func (controller *Systemd) Restart(c echo.Context) error {
 	svc, err := controller.resolveService(c)
 	if err != nil {
+		recordAudit(c, controller.audit, audit.ActionUnitRestart, c.Param("instance"), err)
 		return err
 	}
 
-	if err = svc.Restart(c.Request().Context()); err != nil {
+	err = svc.Restart(c.Request().Context())
+	recordAudit(c, controller.audit, audit.ActionUnitRestart, svc.Unit().Instance, err)
+	if err != nil {
 		return err
 	}
 
@@ -214,16 +242,17 @@ func (controller *Systemd) resolveService(c echo.Context) (*systemd.Service, err
 
 	svc, err := controller.services.Create(model.Instance)
 	if err != nil {
-		return nil, echo.NewHTTPError(http.StatusNotFound, err)
+		return nil, echo.NewHTTPError(http.StatusNotFound, ErrInstanceNotFound.Error()).SetInternal(err)
 	}
 
 	return svc, nil
 }
 
-func NewSystemd(services *systemd.ServiceFactory, logger *slog.Logger) *Systemd {
+func NewSystemd(p SystemdParams) *Systemd {
 	return &Systemd{
-		services: services,
-		logger:   logger,
+		services: p.ServiceFactory,
+		audit:    p.Recorder,
+		logger:   p.Logger,
 	}
 }
 
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+// tokenLifetimes are the expiry choices offered when creating a token, in
+// days. Zero never expires.
+var tokenLifetimes = []struct {
+	Days  int
+	Label string
+}{
+	{7, "7 days"},
+	{30, "30 days"},
+	{90, "90 days"},
+	{365, "1 year"},
+	{0, "Never"},
+}
+
+var ErrTokenNotFound = errors.New("access token not found")
+
+type (
+	Tokens struct {
+		query  database.Querier
+		tokens *identity.AccessTokens
+		audit  audit.Recorder
+	}
+
+	TokensParams struct {
+		fx.In
+
+		Querier      database.Querier
+		AccessTokens *identity.AccessTokens
+		Recorder     audit.Recorder
+	}
+
+	tokenModel struct {
+		database.AccessToken
+		Permissions []identity.Permission
+		Expired     bool
+	}
+)
+
+func (controller *Tokens) RenderTokens(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	tokens, err := controller.query.ListAccessTokens(c.Request().Context(), claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list access tokens: %w", err)
+	}
+
+	now := time.Now()
+	models := make([]tokenModel, 0, len(tokens))
+	for _, token := range tokens {
+		models = append(models, tokenModel{
+			AccessToken: token,
+			Permissions: identity.SplitPermissions(token.Permissions),
+			Expired:     token.ExpiresAt != nil && !now.Before(*token.ExpiresAt),
+		})
+	}
+
+	return c.Render(http.StatusOK, "tokens.gotmpl", echo.Map{
+		"Tokens":    models,
+		"Scopes":    identity.Scopes(identity.Role(claims.Role)),
+		"Lifetimes": tokenLifetimes,
+	})
+}
+
+// CreateToken issues a token, showing it once in place of the form button.
+func (controller *Tokens) CreateToken(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		Name        string   `form:"name" validate:"required,max=63"`
+		ExpiresIn   int      `form:"expiresIn" validate:"min=0,max=365"`
+		Permissions []string `form:"permissions" validate:"required,min=1"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	model.Name = strings.TrimSpace(model.Name)
+	if err := c.Validate(model); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var expiresAt *time.Time
+	if model.ExpiresIn > 0 {
+		t := time.Now().UTC().AddDate(0, 0, model.ExpiresIn)
+		expiresAt = &t
+	}
+
+	permissions := make([]identity.Permission, 0, len(model.Permissions))
+	for _, p := range model.Permissions {
+		permissions = append(permissions, identity.Permission(p))
+	}
+
+	token, err := controller.tokens.Issue(c.Request().Context(), claims, model.Name, permissions, expiresAt)
+	recordAudit(c, controller.audit, audit.ActionTokenCreate, model.Name, err)
+	if errors.Is(err, identity.ErrInvalidScope) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	return c.HTML(http.StatusOK, fmt.Sprintf(`
+        <div class="bg-neutral-200 rounded p-2 overflow-x-scroll col-span-2">
+            <p>Copy this token now. It will not be shown again.</p>
+            <strong class="font-bold">Token:</strong>
+            <code>%s</code>
+        </div>
+    `, html.EscapeString(token.Value)))
+}
+
+func (controller *Tokens) RevokeToken(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		ID int64 `param:"id" validate:"required"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	n, err := controller.query.RemoveAccessToken(c.Request().Context(), database.RemoveAccessTokenParams{
+		ID:     model.ID,
+		UserID: claims.ID,
+	})
+	if err == nil && n == 0 {
+		err = ErrTokenNotFound
+	}
+
+	recordAudit(c, controller.audit, audit.ActionTokenRevoke, fmt.Sprint(model.ID), err)
+	if errors.Is(err, ErrTokenNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	return c.Redirect(http.StatusFound, "/account/tokens")
+}
+
+func NewTokens(p TokensParams) *Tokens {
+	return &Tokens{p.Querier, p.AccessTokens, p.Recorder}
+}
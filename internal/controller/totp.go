@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+const invalidCodeHTML = `<p class="text-red-600">The code is incorrect or has already been used.</p>`
+
+type (
+	TOTP struct {
+		totp  *identity.TOTPManager
+		audit audit.Recorder
+	}
+
+	TOTPParams struct {
+		fx.In
+
+		TOTPManager *identity.TOTPManager
+		Recorder    audit.Recorder
+	}
+
+	totpCodeModel struct {
+		Code string `form:"code" validate:"required,max=32"`
+	}
+)
+
+func (controller *TOTP) RenderTOTP(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	status, err := controller.totp.Status(c.Request().Context(), claims)
+	if err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "totp.gotmpl", echo.Map{
+		"Status": status,
+	})
+}
+
+// Setup generates a new secret and shows it for the user to scan. It is not
+// enabled until confirmed with a code.
+func (controller *TOTP) Setup(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	ctx := c.Request().Context()
+	enrollment, err := controller.totp.Enroll(ctx, claims)
+	if errors.Is(err, identity.ErrTOTPEnabled) {
+		return c.Redirect(http.StatusFound, "/account/totp")
+	} else if err != nil {
+		return err
+	}
+
+	status, err := controller.totp.Status(ctx, claims)
+	if err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "totp.gotmpl", echo.Map{
+		"Status":     status,
+		"Enrollment": enrollment,
+	})
+}
+
+// Confirm enables TOTP and shows the recovery codes in place of the page.
+func (controller *TOTP) Confirm(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(totpCodeModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	codes, err := controller.totp.Confirm(c.Request().Context(), claims.ID, model.Code)
+	recordAudit(c, controller.audit, audit.ActionTOTPEnable, claims.Username, err)
+	if errors.Is(err, identity.ErrInvalidTOTPCode) {
+		return c.HTML(http.StatusOK, invalidCodeHTML)
+	} else if err != nil {
+		return err
+	}
+
+	return controller.renderRecoveryCodes(c, codes)
+}
+
+func (controller *TOTP) RegenerateRecoveryCodes(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(totpCodeModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	err := controller.totp.Verify(ctx, claims.ID, model.Code)
+
+	var codes []string
+	if err == nil {
+		codes, err = controller.totp.RegenerateRecoveryCodes(ctx, claims.ID)
+	}
+
+	recordAudit(c, controller.audit, audit.ActionTOTPRecoveryCodes, claims.Username, err)
+	if errors.Is(err, identity.ErrInvalidTOTPCode) {
+		return c.HTML(http.StatusOK, invalidCodeHTML)
+	} else if err != nil {
+		return err
+	}
+
+	return controller.renderRecoveryCodes(c, codes)
+}
+
+// Disable turns off TOTP after checking a code, unless the user's role
+// requires it.
+func (controller *TOTP) Disable(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(totpCodeModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	required, err := controller.totp.Required(ctx, claims.Role)
+	if err == nil && required {
+		err = identity.ErrTOTPRequired
+	}
+	if err == nil {
+		err = controller.totp.Verify(ctx, claims.ID, model.Code)
+	}
+	if err == nil {
+		err = controller.totp.Disable(ctx, claims.ID)
+	}
+
+	recordAudit(c, controller.audit, audit.ActionTOTPDisable, claims.Username, err)
+	switch {
+	case errors.Is(err, identity.ErrInvalidTOTPCode):
+		return c.HTML(http.StatusOK, invalidCodeHTML)
+	case errors.Is(err, identity.ErrTOTPRequired):
+		return c.HTML(http.StatusOK, fmt.Sprintf(`<p class="text-red-600">%s.</p>`, identity.ErrTOTPRequired))
+	case err != nil:
+		return err
+	}
+
+	c.Response().Header().Add("HX-Location", "/account/totp")
+	return c.NoContent(http.StatusOK)
+}
+
+func (controller *TOTP) renderRecoveryCodes(c echo.Context, codes []string) error {
+	c.Response().Header().Set("HX-Retarget", "#main")
+	return c.Render(http.StatusOK, "recovery-codes.gotmpl", echo.Map{
+		"Codes": codes,
+	})
+}
+
+func NewTOTP(p TOTPParams) *TOTP {
+	return &TOTP{p.TOTPManager, p.Recorder}
+}
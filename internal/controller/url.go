@@ -0,0 +1,14 @@
+package controller
+
+import "strings"
+
+// BaseURL is the public address of herobrian, such as
+// https://herobrian.example.com, from which links sent outside of the
+// browser are built. The Host header of a request is chosen by the client,
+// so it is never used for them.
+type BaseURL string
+
+// Join returns the absolute URL of the path.
+func (u BaseURL) Join(path string) string {
+	return strings.TrimSuffix(string(u), "/") + path
+}
@@ -0,0 +1,383 @@
+package controller
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/bdreece/herobrian/internal/middleware"
+	"github.com/bdreece/herobrian/pkg/audit"
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrSelfManagement  = errors.New("cannot manage your own account")
+	ErrRoleNotGranted  = errors.New("cannot manage users above your own role")
+	ErrRoleOutOfBounds = errors.New("cannot assign a role above your own")
+)
+
+type (
+	Users struct {
+		db       *sql.DB
+		query    database.Querier
+		sessions *identity.SessionStore
+		totp     *identity.TOTPManager
+		audit    audit.Recorder
+	}
+
+	UsersParams struct {
+		fx.In
+
+		DB           *sql.DB
+		Querier      database.Querier
+		SessionStore *identity.SessionStore
+		TOTPManager  *identity.TOTPManager
+		Recorder     audit.Recorder
+	}
+
+	userModel struct {
+		database.User
+		Role identity.Role
+	}
+
+	userParamModel struct {
+		ID int64 `param:"id"`
+	}
+)
+
+func (controller *Users) RenderUsers(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	users, err := controller.query.ListUsers(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	models := make([]userModel, 0, len(users))
+	for _, user := range users {
+		models = append(models, userModel{user, identity.Role(user.RoleID)})
+	}
+
+	roles := make([]identity.Role, 0)
+	for role := identity.RoleUser; role <= identity.Role(claims.Role); role++ {
+		roles = append(roles, role)
+	}
+
+	policies, err := controller.query.ListRolePolicies(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("failed to list role policies: %w", err)
+	}
+
+	return c.Render(http.StatusOK, "users.gotmpl", echo.Map{
+		"Users":    models,
+		"Roles":    roles,
+		"Policies": policies,
+		"Actor":    claims,
+	})
+}
+
+// SetTOTPPolicy makes two-factor authentication mandatory, or optional, for
+// a role up to the actor's own.
+func (controller *Users) SetTOTPPolicy(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	model := new(struct {
+		Role    int64 `form:"role" validate:"min=0,max=3"`
+		Require bool  `form:"require"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	var err error
+	if model.Role > claims.Role {
+		err = echo.NewHTTPError(http.StatusForbidden, ErrRoleNotGranted.Error())
+	} else {
+		err = controller.query.UpsertRolePolicy(c.Request().Context(), database.UpsertRolePolicyParams{
+			RoleID:      model.Role,
+			RequireTotp: model.Require,
+		})
+	}
+
+	target := fmt.Sprintf("%s required=%t", identity.Role(model.Role), model.Require)
+	recordAudit(c, controller.audit, audit.ActionTOTPPolicy, target, err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+// ResetTOTP removes the user's authenticator and recovery codes, such as
+// after they lose their device.
+func (controller *Users) ResetTOTP(c echo.Context) error {
+	model := new(userParamModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+
+	user, err := controller.find(c, model.ID)
+	if err == nil {
+		err = controller.totp.Disable(c.Request().Context(), user.ID)
+	}
+
+	recordAudit(c, controller.audit, audit.ActionUserTOTPReset, userTarget(user, model.ID), err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+func (controller *Users) SetRole(c echo.Context) error {
+	model := new(struct {
+		userParamModel
+		Role int64 `form:"role" validate:"min=0,max=3"`
+	})
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+	if err := c.Validate(model); err != nil {
+		return err
+	}
+
+	user, err := controller.find(c, model.ID)
+	if err == nil {
+		err = controller.setRole(c, user, model.Role)
+	}
+
+	recordAudit(c, controller.audit, audit.ActionUserRole, userTarget(user, model.ID), err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+func (controller *Users) ResetPassword(c echo.Context) error {
+	model := new(userParamModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+
+	password := generatePassword()
+	user, err := controller.find(c, model.ID)
+	if err == nil {
+		err = controller.resetPassword(c, user, password)
+	}
+
+	recordAudit(c, controller.audit, audit.ActionUserPasswordReset, userTarget(user, model.ID), err)
+	if err != nil {
+		return err
+	}
+
+	return c.HTML(http.StatusOK, fmt.Sprintf(`
+        <div class="bg-neutral-200 rounded p-2">
+            <strong class="font-bold">Temporary password:</strong>
+            <code>%s</code>
+        </div>
+    `, template.HTMLEscapeString(password)))
+}
+
+func (controller *Users) Disable(c echo.Context) error {
+	return controller.setDisabled(c, true, audit.ActionUserDisable)
+}
+
+func (controller *Users) Enable(c echo.Context) error {
+	return controller.setDisabled(c, false, audit.ActionUserEnable)
+}
+
+func (controller *Users) Delete(c echo.Context) error {
+	model := new(userParamModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+
+	user, err := controller.find(c, model.ID)
+	if err == nil {
+		err = controller.remove(c, user)
+	}
+
+	recordAudit(c, controller.audit, audit.ActionUserDelete, userTarget(user, model.ID), err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+// SignOut signs the user out of every session.
+func (controller *Users) SignOut(c echo.Context) error {
+	model := new(userParamModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+
+	user, err := controller.find(c, model.ID)
+	if err == nil {
+		err = controller.sessions.RevokeUser(c.Request().Context(), user.ID)
+	}
+
+	recordAudit(c, controller.audit, audit.ActionSessionRevoke, userTarget(user, model.ID), err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+// SignOutEverywhere signs every user out of every session, except for the
+// actor's current session.
+func (controller *Users) SignOutEverywhere(c echo.Context) error {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return fmt.Errorf("failed to get claims from request context")
+	}
+
+	err := controller.sessions.RevokeAll(c.Request().Context(), claims.SessionID)
+	recordAudit(c, controller.audit, audit.ActionSessionRevokeAll, "", err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+func (controller *Users) setDisabled(c echo.Context, disabled bool, action string) error {
+	model := new(userParamModel)
+	if err := c.Bind(model); err != nil {
+		return err
+	}
+
+	user, err := controller.find(c, model.ID)
+	if err == nil {
+		err = controller.updateDisabled(c, user, disabled)
+	}
+
+	recordAudit(c, controller.audit, action, userTarget(user, model.ID), err)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, "/admin/users")
+}
+
+// updateDisabled signs the user out of every session when disabling them.
+func (controller *Users) updateDisabled(c echo.Context, user *database.User, disabled bool) error {
+	_, err := controller.query.UpdateUserDisabled(c.Request().Context(), database.UpdateUserDisabledParams{
+		Disabled: disabled,
+		ID:       user.ID,
+	})
+	if err != nil || !disabled {
+		return err
+	}
+
+	return controller.sessions.RevokeUser(c.Request().Context(), user.ID)
+}
+
+func (controller *Users) setRole(c echo.Context, user *database.User, role int64) error {
+	claims := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if role > claims.Role {
+		return echo.NewHTTPError(http.StatusForbidden, ErrRoleOutOfBounds.Error())
+	}
+
+	_, err := controller.query.UpdateUserRole(c.Request().Context(), database.UpdateUserRoleParams{
+		RoleID: role,
+		ID:     user.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return controller.sessions.RevokeUser(c.Request().Context(), user.ID)
+}
+
+func (controller *Users) resetPassword(c echo.Context, user *database.User, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = controller.query.UpdateUserPassword(c.Request().Context(), database.UpdateUserPasswordParams{
+		PasswordHash: base64.StdEncoding.EncodeToString(hash),
+		ID:           user.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return controller.sessions.RevokeUser(c.Request().Context(), user.ID)
+}
+
+func (controller *Users) remove(c echo.Context, user *database.User) error {
+	return database.DeleteUser(c.Request().Context(), controller.db, user.ID)
+}
+
+// find resolves a user the actor is allowed to manage: any other user whose
+// role does not exceed the actor's own.
+func (controller *Users) find(c echo.Context, id int64) (*database.User, error) {
+	claims, ok := c.Get(middleware.ClaimsContextKey).(*identity.ClaimSet)
+	if !ok || claims == nil {
+		return nil, fmt.Errorf("failed to get claims from request context")
+	}
+
+	if id == claims.ID {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, ErrSelfManagement.Error())
+	}
+
+	user, err := controller.query.FindUser(c.Request().Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, ErrUserNotFound.Error())
+	} else if err != nil {
+		return nil, err
+	}
+
+	if user.RoleID > claims.Role {
+		return &user, echo.NewHTTPError(http.StatusForbidden, ErrRoleNotGranted.Error())
+	}
+
+	return &user, nil
+}
+
+func userTarget(user *database.User, id int64) string {
+	if user == nil {
+		return fmt.Sprintf("#%d", id)
+	}
+
+	return user.Username
+}
+
+func generatePassword() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func NewUsers(p UsersParams) *Users {
+	return &Users{
+		db:       p.DB,
+		query:    p.Querier,
+		sessions: p.SessionStore,
+		totp:     p.TOTPManager,
+		audit:    p.Recorder,
+	}
+}
@@ -7,16 +7,26 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// Authorize rejects requests whose claims do not satisfy every authorizer.
+// Roles and permissions may be passed directly; authorizers implementing
+// identity.ResourceAuthorizer are checked against the current request.
 func Authorize(authorizers ...identity.Authorizer) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			claims, ok := c.Get(ClaimsContextKey).(*identity.ClaimSet)
 			if !ok || claims == nil {
-				return echo.NewHTTPError(http.StatusUnauthorized, "failed to get claims from request context")
+				return echo.NewHTTPError(http.StatusUnauthorized, "authentication is required")
 			}
 
 			for _, authorizer := range authorizers {
-				if err := authorizer.Authorize(claims); err != nil {
+				var err error
+				if ra, ok := authorizer.(identity.ResourceAuthorizer); ok {
+					err = ra.AuthorizeResource(c, claims)
+				} else {
+					err = authorizer.Authorize(claims)
+				}
+
+				if err != nil {
 					return echo.NewHTTPError(http.StatusForbidden, err.Error())
 				}
 			}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+type RateLimitOptions struct {
+	// PerMinute is the sustained rate of requests, with up to Burst allowed
+	// at once.
+	PerMinute float64 `yaml:"per_minute"`
+	Burst     int     `yaml:"burst"`
+}
+
+// RateLimitByIP limits requests from each address.
+func RateLimitByIP(opts RateLimitOptions) echo.MiddlewareFunc {
+	return rateLimit(opts, func(c echo.Context) (string, error) {
+		return c.RealIP(), nil
+	})
+}
+
+// RateLimitByUser limits requests from each signed-in user, falling back to
+// their address. It must follow Authenticate.
+func RateLimitByUser(opts RateLimitOptions) echo.MiddlewareFunc {
+	return rateLimit(opts, func(c echo.Context) (string, error) {
+		if claims, ok := c.Get(ClaimsContextKey).(*identity.ClaimSet); ok && claims != nil {
+			return fmt.Sprint("user:", claims.ID), nil
+		}
+
+		return "ip:" + c.RealIP(), nil
+	})
+}
+
+func rateLimit(opts RateLimitOptions, identify middleware.Extractor) echo.MiddlewareFunc {
+	limit := rate.Limit(opts.PerMinute / 60)
+	store := middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+		Rate:      limit,
+		Burst:     opts.Burst,
+		ExpiresIn: 10 * time.Minute,
+	})
+
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store:               store,
+		IdentifierExtractor: identify,
+		DenyHandler: func(c echo.Context, _ string, _ error) error {
+			// a token is regained every 1/limit seconds
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(1/float64(limit))+1))
+			return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests")
+		},
+	})
+}
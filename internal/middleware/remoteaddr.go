@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+)
+
+// RemoteAddr passes the real IP of each request, as extracted by the
+// router's IPExtractor, to the session store.
+func RemoteAddr() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			c.SetRequest(r.WithContext(identity.WithRemoteAddr(r.Context(), c.RealIP())))
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/labstack/echo/v4"
+)
+
+// RequireTOTP sends users whose role requires two-factor authentication to
+// the enrollment page until they have enabled it. Paths with an exempt
+// prefix, such as the enrollment page itself, are always allowed.
+func RequireTOTP(totp *identity.TOTPManager, enrollPath string, exempt ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := c.Get(ClaimsContextKey).(*identity.ClaimSet)
+			if !ok || claims == nil {
+				return next(c)
+			}
+
+			path := c.Request().URL.Path
+			if strings.HasPrefix(path, enrollPath) {
+				return next(c)
+			}
+			for _, prefix := range exempt {
+				if strings.HasPrefix(path, prefix) {
+					return next(c)
+				}
+			}
+
+			ctx := c.Request().Context()
+			required, err := totp.Required(ctx, claims.Role)
+			if err != nil {
+				return err
+			}
+			if !required {
+				return next(c)
+			}
+
+			enabled, err := totp.Enabled(ctx, claims.ID)
+			if err != nil {
+				return err
+			}
+			if enabled {
+				return next(c)
+			}
+
+			if c.Request().Header.Get("HX-Request") != "" {
+				c.Response().Header().Add("HX-Location", enrollPath)
+				return c.NoContent(http.StatusOK)
+			}
+
+			return c.Redirect(http.StatusFound, enrollPath)
+		}
+	}
+}
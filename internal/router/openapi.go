@@ -0,0 +1,33 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bdreece/herobrian/pkg/openapi"
+)
+
+// apiGroup registers routes together with their OpenAPI operations, so the
+// document is generated from the route table.
+type apiGroup struct {
+	*echo.Group
+
+	spec   *openapi.Document
+	prefix string
+}
+
+func (g apiGroup) add(method, path string, h echo.HandlerFunc, op openapi.Operation, m ...echo.MiddlewareFunc) {
+	g.Add(method, path, h, m...)
+	g.spec.Add(method, g.prefix+path, op)
+}
+
+// group nests a group under the path, sharing the document.
+func (g apiGroup) group(path string, m ...echo.MiddlewareFunc) apiGroup {
+	return apiGroup{g.Group.Group(path, m...), g.spec, g.prefix + path}
+}
+
+// OpenAPI serves the generated document.
+func (r Router) OpenAPI(c echo.Context) error {
+	return c.JSON(http.StatusOK, r.spec)
+}
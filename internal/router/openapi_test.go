@@ -0,0 +1,43 @@
+package router
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/bdreece/herobrian/internal/controller"
+	"github.com/bdreece/herobrian/pkg/metrics"
+	"github.com/bdreece/herobrian/pkg/systemd"
+	"github.com/bdreece/herobrian/pkg/worker"
+)
+
+// TestAPIDocumented fails if a route under /api/v1 is registered without
+// being added to the OpenAPI document.
+func TestAPIDocumented(t *testing.T) {
+	m, err := metrics.New(metrics.Params{
+		Workers: worker.NewRegistry(),
+		Options: new(systemd.ClientOptions[systemd.SSH]),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(Params{
+		Logger:       slog.Default(),
+		SessionStore: sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef")),
+		Metrics:      m,
+		Options:      new(Options),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.MapAPI(new(controller.API))
+
+	if missing := r.spec.Missing(r.Routes()); len(missing) > 0 {
+		t.Errorf("routes missing from the OpenAPI document: %v", missing)
+	}
+	if len(r.spec.Paths) == 0 {
+		t.Error("no routes were documented")
+	}
+}
@@ -2,20 +2,76 @@ package router
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
 
 	"go.uber.org/config"
+
+	mw "github.com/bdreece/herobrian/internal/middleware"
 )
 
 type Options struct {
-	StaticDirectory string `yaml:"static_dir"`
-	AppDirectory    string `yaml:"app_dir"`
+	// BaseURL is the public address of herobrian, from which links in
+	// emails are built.
+	BaseURL         string           `yaml:"base_url"`
+	StaticDirectory string           `yaml:"static_dir"`
+	AppDirectory    string           `yaml:"app_dir"`
+	RateLimit       RateLimitOptions `yaml:"rate_limit"`
+	// TrustedProxies are the CIDR ranges of reverse proxies whose
+	// X-Forwarded-For header names the client. With none, the client is
+	// the peer of the connection.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type RateLimitOptions struct {
+	// Auth limits each address on the sign-in, password reset and invite
+	// forms.
+	Auth mw.RateLimitOptions `yaml:"auth"`
+	// Power limits each user booting, stopping and restarting the server
+	// and its units.
+	Power mw.RateLimitOptions `yaml:"power"`
+}
+
+// IPExtractor finds the real IP of a request, trusting X-Forwarded-For only
+// from the configured proxies.
+func (opts *Options) IPExtractor() (echo.IPExtractor, error) {
+	if len(opts.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	trust := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range opts.TrustedProxies {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+
+		trust = append(trust, echo.TrustIPRange(ipNet))
+	}
+
+	return echo.ExtractIPFromXFFHeader(trust...), nil
 }
 
 func Configure(provider config.Provider) (*Options, error) {
-	opts := new(Options)
+	opts := &Options{
+		RateLimit: RateLimitOptions{
+			Auth:  mw.RateLimitOptions{PerMinute: 10, Burst: 10},
+			Power: mw.RateLimitOptions{PerMinute: 4, Burst: 3},
+		},
+	}
 	if err := provider.Get("router").Populate(opts); err != nil {
 		return nil, fmt.Errorf("failed to configure router options: %w", err)
 	}
 
+	if u, err := url.Parse(opts.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("router base_url %q must be an absolute http or https URL", opts.BaseURL)
+	}
+
 	return opts, nil
 }
@@ -3,6 +3,7 @@ package router
 import (
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo-contrib/session"
@@ -14,6 +15,8 @@ import (
 	"github.com/bdreece/herobrian/internal/controller"
 	mw "github.com/bdreece/herobrian/internal/middleware"
 	"github.com/bdreece/herobrian/pkg/identity"
+	"github.com/bdreece/herobrian/pkg/metrics"
+	"github.com/bdreece/herobrian/pkg/openapi"
 )
 
 type Params struct {
@@ -24,50 +27,365 @@ type Params struct {
 	Logger        *slog.Logger
 	SessionStore  sessions.Store
 	Authenticator identity.Authenticator
+	AccessTokens  *identity.AccessTokens
+	TOTP          *identity.TOTPManager
+	Grants        *identity.Grants
+	Metrics       *metrics.Metrics
 	Options       *Options
 }
 
 type Router struct {
 	*echo.Echo
 
-	authenticate   echo.MiddlewareFunc
-	authorize      echo.MiddlewareFunc
-	allowModerator echo.MiddlewareFunc
+	authenticate      echo.MiddlewareFunc
+	authenticateToken echo.MiddlewareFunc
+	authorize         echo.MiddlewareFunc
+	limitAuth         echo.MiddlewareFunc
+	limitPower        echo.MiddlewareFunc
+	grants            *identity.Grants
+	metrics           *metrics.Metrics
+	spec              *openapi.Document
+}
+
+// problem is an RFC 9457 problem details response, returned by the API in
+// place of the redirects served to browsers.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+const (
+	// apiPrefix is the path of every route authenticated by access token.
+	apiPrefix = "/api/"
+	apiV1     = "/api/v1"
+)
+
+// require authorizes requests holding every permission through their role.
+func (r Router) require(permissions ...identity.Permission) echo.MiddlewareFunc {
+	authorizers := []identity.Authorizer{identity.DefaultAuthorizer}
+	for _, p := range permissions {
+		authorizers = append(authorizers, p)
+	}
+
+	return mw.Authorize(authorizers...)
+}
+
+// requireUnit authorizes requests holding every permission on the unit named
+// by the :instance parameter, through either their role or a unit grant.
+func (r Router) requireUnit(permissions ...identity.Permission) echo.MiddlewareFunc {
+	authorizers := []identity.Authorizer{identity.DefaultAuthorizer}
+	for _, p := range permissions {
+		authorizers = append(authorizers, r.grants.Unit("instance", p))
+	}
+
+	return mw.Authorize(authorizers...)
 }
 
 func (r Router) MapHome(home *controller.Home) {
 	r.GET("/", home.RenderIndex, r.authenticate, r.authorize)
 }
 
+func (r Router) MapHealth(health *controller.Health) {
+	r.GET("/healthz", health.Healthz)
+	r.GET("/readyz", health.Readyz)
+	r.GET("/metrics", r.metrics.Handler())
+	r.GET("/admin/diagnostics", health.RenderDiagnostics, r.authenticate, r.require(identity.PermissionDiagnosticsView))
+}
+
 func (r Router) MapAuth(auth *controller.Auth) {
 	r.GET("/login", auth.RenderLogin)
-	r.POST("/login", auth.Login)
-	r.GET("/logout", auth.RenderLogout)
+	r.POST("/login", auth.Login, r.limitAuth)
+	r.GET("/login/totp", auth.RenderLoginTOTP)
+	r.POST("/login/totp", auth.LoginTOTP, r.limitAuth)
+	r.POST("/login/passkey/begin", auth.BeginPasskeyLogin)
+	r.POST("/login/passkey", auth.PasskeyLogin, r.limitAuth)
+	r.GET("/login/oauth/:provider", auth.BeginOAuth, r.authenticate)
+	r.GET("/login/oauth/:provider/callback", auth.OAuthCallback, r.authenticate)
+	r.GET("/logout", auth.RenderLogout, r.authenticate)
+}
+
+func (r Router) MapAccount(account *controller.Account) {
+	r.GET("/forgot-password", account.RenderForgotPassword)
+	r.POST("/forgot-password", account.ForgotPassword, r.limitAuth)
+	r.GET("/reset-password/:token", account.RenderResetPassword)
+	r.POST("/reset-password/:token", account.ResetPassword, r.limitAuth)
+	r.GET("/account/email/:token", account.VerifyEmail)
+
+	route := r.Group("/account", r.authenticate, r.authorize)
+	route.GET("", account.RenderAccount)
+	route.POST("/password", account.ChangePassword)
+	route.POST("/email", account.ChangeEmail)
+	route.GET("/sessions", account.RenderSessions)
+	route.POST("/sessions/revoke", account.RevokeOtherSessions)
+	route.POST("/sessions/:id/revoke", account.RevokeSession)
+}
+
+func (r Router) MapProfile(profile *controller.Profile) {
+	r.GET("/avatars/:id", profile.Avatar, r.authenticate, r.authorize)
+
+	route := r.Group("/account/profile", r.authenticate, r.authorize)
+	route.GET("", profile.RenderProfile)
+	route.POST("", profile.UpdateProfile)
+	route.POST("/avatar", profile.UploadAvatar)
+	route.POST("/avatar/mojang", profile.UseMojangAvatar)
+	route.POST("/avatar/remove", profile.RemoveAvatar)
+}
+
+func (r Router) MapNotifications(notifications *controller.Notifications) {
+	route := r.Group("/account/notifications", r.authenticate, r.authorize)
+	route.GET("", notifications.RenderNotifications)
+	route.POST("", notifications.CreatePreference)
+	route.POST("/remove", notifications.RemovePreference)
+	route.POST("/push", notifications.Subscribe)
+	route.POST("/push/:id/remove", notifications.Unsubscribe)
+}
+
+func (r Router) MapTOTP(totp *controller.TOTP) {
+	route := r.Group("/account/totp", r.authenticate, r.authorize)
+	route.GET("", totp.RenderTOTP)
+	route.POST("/setup", totp.Setup)
+	route.POST("/confirm", totp.Confirm)
+	route.POST("/recovery-codes", totp.RegenerateRecoveryCodes)
+	route.POST("/disable", totp.Disable)
+}
+
+func (r Router) MapPasskeys(passkeys *controller.Passkeys) {
+	route := r.Group("/account/passkeys", r.authenticate, r.authorize)
+	route.GET("", passkeys.RenderPasskeys)
+	route.POST("/begin", passkeys.BeginRegistration)
+	route.POST("", passkeys.FinishRegistration)
+	route.POST("/:id/rename", passkeys.Rename)
+	route.POST("/:id/remove", passkeys.Remove)
+}
+
+func (r Router) MapConnections(connections *controller.Connections) {
+	route := r.Group("/account/connections", r.authenticate, r.authorize)
+	route.GET("", connections.RenderConnections)
+	route.POST("/:provider/link", connections.Link)
+	route.POST("/:id/remove", connections.Remove)
+}
+
+func (r Router) MapTokens(tokens *controller.Tokens) {
+	route := r.Group("/account/tokens", r.authenticate, r.authorize)
+	route.GET("", tokens.RenderTokens)
+	route.POST("", tokens.CreateToken)
+	route.POST("/:id/revoke", tokens.RevokeToken)
+}
+
+func (r Router) MapAudit(audit *controller.Audit) {
+	route := r.Group("/admin/audit", r.authenticate, r.require(identity.PermissionAuditView))
+	route.GET("", audit.RenderAudit)
+	route.GET("/export", audit.ExportAudit)
+}
+
+func (r Router) MapOutbox(outbox *controller.Outbox) {
+	route := r.Group("/admin/outbox", r.authenticate, r.require(identity.PermissionOutboxManage))
+	route.GET("", outbox.RenderOutbox)
+	route.POST("/:id/retry", outbox.RetryMessage)
+}
+
+func (r Router) MapGrants(grants *controller.Grants) {
+	route := r.Group("/admin/grants", r.authenticate, r.require(identity.PermissionUsersManage))
+	route.GET("", grants.RenderGrants)
+	route.POST("", grants.CreateGrant)
+	route.POST("/revoke", grants.RevokeGrant)
+}
+
+func (r Router) MapUsers(users *controller.Users) {
+	route := r.Group("/admin/users", r.authenticate, r.require(identity.PermissionUsersManage))
+	route.GET("", users.RenderUsers)
+	route.POST("/sessions/revoke", users.SignOutEverywhere)
+	route.POST("/totp-policy", users.SetTOTPPolicy)
+	route.POST("/:id/role", users.SetRole)
+	route.POST("/:id/password", users.ResetPassword)
+	route.POST("/:id/disable", users.Disable)
+	route.POST("/:id/enable", users.Enable)
+	route.POST("/:id/delete", users.Delete)
+	route.POST("/:id/sessions/revoke", users.SignOut)
+	route.POST("/:id/totp/reset", users.ResetTOTP)
 }
 
 func (r Router) MapInvite(invite *controller.Invite) {
-	r.GET("/invite", invite.RenderSendInvite, r.authenticate, r.authorize, r.allowModerator)
-	r.POST("/invite", invite.SendInvite, r.authenticate, r.authorize, r.allowModerator)
+	r.GET("/invite", invite.RenderSendInvite, r.authenticate, r.require(identity.PermissionInviteCreate))
+	r.POST("/invite", invite.SendInvite, r.authenticate, r.require(identity.PermissionInviteCreate))
+	r.GET("/invites", invite.RenderInvites, r.authenticate, r.require(identity.PermissionInviteCreate))
+	r.POST("/invites/:id/revoke", invite.RevokeInvite, r.authenticate, r.require(identity.PermissionInviteCreate))
+	r.POST("/invites/:id/resend", invite.ResendInvite, r.authenticate, r.require(identity.PermissionInviteCreate))
 	r.GET("/invite/:token", invite.RenderAcceptInvite)
-	r.POST("/invite/:token", invite.AcceptInvite)
+	r.POST("/invite/:token", invite.AcceptInvite, r.limitAuth)
 }
 
 func (r Router) MapLinode(linode *controller.Linode) {
 	route := r.Group("/linode", r.authenticate, r.authorize)
-	route.GET("/sse", linode.SSE)
-	route.POST("/boot", linode.Boot)
-	route.POST("/reboot", linode.Reboot)
-	route.POST("/shutdown", linode.Shutdown)
+	route.GET("/sse", linode.SSE, r.metrics.TrackStream("linode"))
+	route.POST("/boot", linode.Boot, r.require(identity.PermissionLinodeBoot), r.limitPower)
+	route.POST("/reboot", linode.Reboot, r.require(identity.PermissionLinodePower), r.limitPower)
+	route.POST("/shutdown", linode.Shutdown, r.require(identity.PermissionLinodePower), r.limitPower)
 }
 
 func (r Router) MapSystemd(systemd *controller.Systemd) {
 	route := r.Group("/systemd/:instance", r.authenticate, r.authorize)
-	route.GET("/sse", systemd.SSE)
-	route.POST("/enable", systemd.Enable)
-	route.POST("/disable", systemd.Disable)
-	route.POST("/start", systemd.Start)
-	route.POST("/stop", systemd.Stop)
-	route.POST("/restart", systemd.Restart)
+	route.GET("/sse", systemd.SSE, r.metrics.TrackStream("systemd"))
+	route.POST("/enable", systemd.Enable, r.requireUnit(identity.PermissionUnitEnable))
+	route.POST("/disable", systemd.Disable, r.requireUnit(identity.PermissionUnitEnable))
+	route.POST("/start", systemd.Start, r.requireUnit(identity.PermissionUnitStart), r.limitPower)
+	route.POST("/stop", systemd.Stop, r.requireUnit(identity.PermissionUnitStop), r.limitPower)
+	route.POST("/restart", systemd.Restart, r.requireUnit(identity.PermissionUnitStart, identity.PermissionUnitStop), r.limitPower)
+}
+
+func (r Router) MapAPI(api *controller.API) {
+	r.GET(apiV1+"/openapi.json", r.OpenAPI)
+	r.spec.Add(http.MethodGet, "/openapi.json", openapi.Operation{
+		ID:       "getOpenAPI",
+		Summary:  "Get this document",
+		Tag:      "meta",
+		Public:   true,
+		Response: map[string]any{},
+	})
+
+	route := apiGroup{r.Group(apiV1, r.authenticateToken, r.authorize), r.spec, ""}
+
+	route.add(http.MethodGet, "/linode", api.LinodeStatus, openapi.Operation{
+		ID:       "getLinode",
+		Summary:  "Get the status of the Linode instance",
+		Tag:      "linode",
+		Response: controller.LinodeStatusResponse{},
+	})
+	route.add(http.MethodPost, "/linode/boot", api.LinodeBoot, openapi.Operation{
+		ID:      "bootLinode",
+		Summary: "Boot the Linode instance",
+		Tag:     "linode",
+		Status:  http.StatusAccepted,
+	}, r.require(identity.PermissionLinodeBoot), r.limitPower)
+	route.add(http.MethodPost, "/linode/reboot", api.LinodeReboot, openapi.Operation{
+		ID:      "rebootLinode",
+		Summary: "Reboot the Linode instance",
+		Tag:     "linode",
+		Status:  http.StatusAccepted,
+	}, r.require(identity.PermissionLinodePower), r.limitPower)
+	route.add(http.MethodPost, "/linode/shutdown", api.LinodeShutdown, openapi.Operation{
+		ID:      "shutdownLinode",
+		Summary: "Shut down the Linode instance",
+		Tag:     "linode",
+		Status:  http.StatusAccepted,
+	}, r.require(identity.PermissionLinodePower), r.limitPower)
+
+	route.add(http.MethodGet, "/units", api.ListUnits, openapi.Operation{
+		ID:       "listUnits",
+		Summary:  "List the systemd units",
+		Tag:      "units",
+		Response: []controller.UnitResponse{},
+	})
+	route.add(http.MethodGet, "/units/:instance", api.UnitStatus, openapi.Operation{
+		ID:       "getUnit",
+		Summary:  "Get the status of a unit",
+		Tag:      "units",
+		Response: controller.UnitResponse{},
+	})
+	route.add(http.MethodGet, "/units/:instance/logs", api.UnitLogs, openapi.Operation{
+		ID:      "getUnitLogs",
+		Summary: "Read or follow the journal of a unit",
+		Tag:     "units",
+		Query: map[string]*openapi.Schema{
+			"lines":  {Type: "integer"},
+			"follow": {Type: "boolean"},
+		},
+		Response:    "",
+		ContentType: echo.MIMETextPlain,
+	}, r.requireUnit(identity.PermissionUnitConsole))
+	route.add(http.MethodPost, "/units/:instance/enable", api.UnitEnable, openapi.Operation{
+		ID:      "enableUnit",
+		Summary: "Enable a unit at boot",
+		Tag:     "units",
+		Status:  http.StatusAccepted,
+	}, r.requireUnit(identity.PermissionUnitEnable))
+	route.add(http.MethodPost, "/units/:instance/disable", api.UnitDisable, openapi.Operation{
+		ID:      "disableUnit",
+		Summary: "Disable a unit at boot",
+		Tag:     "units",
+		Status:  http.StatusAccepted,
+	}, r.requireUnit(identity.PermissionUnitEnable))
+	route.add(http.MethodPost, "/units/:instance/start", api.UnitStart, openapi.Operation{
+		ID:      "startUnit",
+		Summary: "Start a unit",
+		Tag:     "units",
+		Status:  http.StatusAccepted,
+	}, r.requireUnit(identity.PermissionUnitStart), r.limitPower)
+	route.add(http.MethodPost, "/units/:instance/stop", api.UnitStop, openapi.Operation{
+		ID:      "stopUnit",
+		Summary: "Stop a unit",
+		Tag:     "units",
+		Status:  http.StatusAccepted,
+	}, r.requireUnit(identity.PermissionUnitStop), r.limitPower)
+	route.add(http.MethodPost, "/units/:instance/restart", api.UnitRestart, openapi.Operation{
+		ID:      "restartUnit",
+		Summary: "Restart a unit",
+		Tag:     "units",
+		Status:  http.StatusAccepted,
+	}, r.requireUnit(identity.PermissionUnitStart, identity.PermissionUnitStop), r.limitPower)
+
+	users := route.group("/users", r.require(identity.PermissionUsersManage))
+	userID := map[string]*openapi.Schema{"id": openapi.Integer}
+	users.add(http.MethodGet, "", api.ListUsers, openapi.Operation{
+		ID:       "listUsers",
+		Summary:  "List users",
+		Tag:      "users",
+		Response: []controller.UserResponse{},
+	})
+	users.add(http.MethodPut, "/:id/role", api.SetUserRole, openapi.Operation{
+		ID:      "setUserRole",
+		Summary: "Change a user's role",
+		Tag:     "users",
+		Params:  userID,
+		Request: controller.SetRoleRequest{},
+		Status:  http.StatusNoContent,
+	})
+	users.add(http.MethodPost, "/:id/disable", api.DisableUser, openapi.Operation{
+		ID:      "disableUser",
+		Summary: "Disable a user and end their sessions",
+		Tag:     "users",
+		Params:  userID,
+		Status:  http.StatusNoContent,
+	})
+	users.add(http.MethodPost, "/:id/enable", api.EnableUser, openapi.Operation{
+		ID:      "enableUser",
+		Summary: "Enable a user",
+		Tag:     "users",
+		Params:  userID,
+		Status:  http.StatusNoContent,
+	})
+	users.add(http.MethodDelete, "/:id", api.DeleteUser, openapi.Operation{
+		ID:      "deleteUser",
+		Summary: "Delete a user",
+		Tag:     "users",
+		Params:  userID,
+		Status:  http.StatusNoContent,
+	})
+
+	invites := route.group("/invites", r.require(identity.PermissionInviteCreate))
+	invites.add(http.MethodGet, "", api.ListInvites, openapi.Operation{
+		ID:       "listInvites",
+		Summary:  "List invites",
+		Tag:      "invites",
+		Response: []controller.InviteResponse{},
+	})
+	invites.add(http.MethodPost, "", api.CreateInvite, openapi.Operation{
+		ID:       "createInvite",
+		Summary:  "Create an invite, emailing it if addressed",
+		Tag:      "invites",
+		Request:  controller.CreateInviteRequest{},
+		Response: controller.InviteResponse{},
+		Status:   http.StatusCreated,
+	})
+	invites.add(http.MethodDelete, "/:id", api.RevokeInvite, openapi.Operation{
+		ID:      "revokeInvite",
+		Summary: "Revoke an invite",
+		Tag:     "invites",
+		Params:  map[string]*openapi.Schema{"id": openapi.UUID},
+		Status:  http.StatusNoContent,
+	})
 }
 
 func (r Router) Start(addr string) error {
@@ -78,8 +396,19 @@ func (r Router) Start(addr string) error {
 	return nil
 }
 
-func New(p Params) Router {
+func New(p Params) (Router, error) {
+	instrument, err := p.Metrics.Middleware()
+	if err != nil {
+		return Router{}, err
+	}
+
+	extractIP, err := p.Options.IPExtractor()
+	if err != nil {
+		return Router{}, err
+	}
+
 	e := echo.New()
+	e.IPExtractor = extractIP
 	e.Renderer = p.Renderer
 	e.Validator = p.Validator
 	e.HTTPErrorHandler = func(err error, c echo.Context) {
@@ -88,6 +417,11 @@ func New(p Params) Router {
 			code = he.Code
 		}
 
+		if strings.HasPrefix(c.Request().URL.Path, apiPrefix) {
+			writeProblem(c, code, err)
+			return
+		}
+
 		var location string
 		switch code {
 		case http.StatusUnauthorized:
@@ -115,13 +449,20 @@ func New(p Params) Router {
 	}
 
 	e.Use(
+		instrument,
 		middleware.BodyLimit("4M"),
 		middleware.Decompress(),
 		middleware.Gzip(),
-		middleware.CSRF(),
+		middleware.CSRFWithConfig(middleware.CSRFConfig{
+			// the API authenticates by bearer token rather than cookie
+			Skipper: func(c echo.Context) bool {
+				return strings.HasPrefix(c.Request().URL.Path, apiPrefix)
+			},
+		}),
 		middleware.Secure(),
 		middleware.Static(p.Options.StaticDirectory),
 		middleware.Static(p.Options.AppDirectory),
+		mw.RemoteAddr(),
 		session.Middleware(p.SessionStore),
 		slogecho.New(p.Logger),
 	)
@@ -129,14 +470,65 @@ func New(p Params) Router {
 	e.RouteNotFound("/*", func(c echo.Context) error {
 		return c.Render(http.StatusOK, "not-found.gotmpl", echo.Map{})
 	})
+	e.RouteNotFound(apiPrefix+"*", func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
 
 	return Router{
-		Echo:         e,
-		authenticate: mw.Authenticate(p.Authenticator),
-		authorize:    mw.Authorize(identity.DefaultAuthorizer),
-		allowModerator: mw.Authorize(
-			identity.DefaultAuthorizer,
-			identity.RoleModerator,
+		Echo:    e,
+		metrics: p.Metrics,
+		authenticate: chain(
+			mw.Authenticate(p.Authenticator),
+			mw.RequireTOTP(p.TOTP, "/account/totp", "/logout"),
 		),
+		authenticateToken: mw.Authenticate(p.AccessTokens),
+		authorize:         mw.Authorize(identity.DefaultAuthorizer),
+		limitAuth:         mw.RateLimitByIP(p.Options.RateLimit.Auth),
+		limitPower:        mw.RateLimitByUser(p.Options.RateLimit.Power),
+		grants:            p.Grants,
+		spec:              openapi.New("herobrian", "1.0.0", apiV1),
+	}, nil
+}
+
+// writeProblem responds to an API request with problem details. Internal
+// errors are not described, as they may reveal more than the client should
+// see.
+func writeProblem(c echo.Context, code int, err error) {
+	if c.Response().Committed {
+		return
+	}
+
+	p := problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(code),
+		Status: code,
+	}
+	if he, ok := err.(*echo.HTTPError); ok && code < http.StatusInternalServerError {
+		if msg, ok := he.Message.(string); ok && msg != p.Title {
+			// joined errors are reported on one line
+			p.Detail = strings.ReplaceAll(msg, "\n", ": ")
+		}
+	}
+
+	if code == http.StatusUnauthorized {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/problem+json")
+	if c.Request().Method == http.MethodHead {
+		_ = c.NoContent(code)
+	} else {
+		_ = c.JSON(code, p)
+	}
+}
+
+// chain applies the middleware in order, the first being outermost.
+func chain(middleware ...echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+
+		return next
 	}
 }
@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.uber.org/fx"
+
+	"github.com/bdreece/herobrian/pkg/database"
+)
+
+const (
+	ActionLogin          = "auth.login"
+	ActionLogout         = "auth.logout"
+	ActionInviteCreate   = "invite.create"
+	ActionInviteAccept   = "invite.accept"
+	ActionInviteRevoke   = "invite.revoke"
+	ActionInviteEmail    = "invite.email"
+	ActionOutboxRetry    = "outbox.retry"
+	ActionLinodeBoot     = "linode.boot"
+	ActionLinodeReboot   = "linode.reboot"
+	ActionLinodeShutdown = "linode.shutdown"
+	ActionUnitEnable     = "unit.enable"
+	ActionUnitDisable    = "unit.disable"
+	ActionUnitStart      = "unit.start"
+	ActionUnitStop       = "unit.stop"
+	ActionUnitRestart    = "unit.restart"
+	ActionGrantCreate    = "grant.create"
+	ActionGrantRevoke    = "grant.revoke"
+
+	ActionUserCreate        = "user.create"
+	ActionUserRole          = "user.role"
+	ActionUserPasswordReset = "user.password_reset"
+	ActionUserDisable       = "user.disable"
+	ActionUserEnable        = "user.enable"
+	ActionUserDelete        = "user.delete"
+	ActionUserTOTPReset     = "user.totp_reset"
+
+	ActionPasswordChange = "account.password_change"
+	ActionPasswordReset  = "account.password_reset"
+	ActionEmailChange    = "account.email_change"
+	ActionProfileChange  = "account.profile_change"
+	ActionAvatarChange   = "account.avatar_change"
+
+	ActionSessionRevoke    = "session.revoke"
+	ActionSessionRevokeAll = "session.revoke_all"
+
+	ActionTOTPEnable        = "totp.enable"
+	ActionTOTPDisable       = "totp.disable"
+	ActionTOTPRecoveryCodes = "totp.recovery_codes"
+	ActionTOTPPolicy        = "totp.policy"
+
+	ActionPasskeyRegister = "passkey.register"
+	ActionPasskeyRename   = "passkey.rename"
+	ActionPasskeyRemove   = "passkey.remove"
+
+	ActionAccountLink   = "account.link"
+	ActionAccountUnlink = "account.unlink"
+	ActionUserProvision = "user.provision"
+
+	ActionTokenCreate = "token.create"
+	ActionTokenRevoke = "token.revoke"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Actions lists every recorded action, for filtering.
+var Actions = []string{
+	ActionLogin,
+	ActionLogout,
+	ActionInviteCreate,
+	ActionInviteAccept,
+	ActionInviteRevoke,
+	ActionInviteEmail,
+	ActionOutboxRetry,
+	ActionLinodeBoot,
+	ActionLinodeReboot,
+	ActionLinodeShutdown,
+	ActionUnitEnable,
+	ActionUnitDisable,
+	ActionUnitStart,
+	ActionUnitStop,
+	ActionUnitRestart,
+	ActionGrantCreate,
+	ActionGrantRevoke,
+	ActionUserCreate,
+	ActionUserRole,
+	ActionUserPasswordReset,
+	ActionUserDisable,
+	ActionUserEnable,
+	ActionUserDelete,
+	ActionUserTOTPReset,
+	ActionPasswordChange,
+	ActionPasswordReset,
+	ActionEmailChange,
+	ActionProfileChange,
+	ActionAvatarChange,
+	ActionSessionRevoke,
+	ActionSessionRevokeAll,
+	ActionTOTPEnable,
+	ActionTOTPDisable,
+	ActionTOTPRecoveryCodes,
+	ActionTOTPPolicy,
+	ActionPasskeyRegister,
+	ActionPasskeyRename,
+	ActionPasskeyRemove,
+	ActionAccountLink,
+	ActionAccountUnlink,
+	ActionUserProvision,
+	ActionTokenCreate,
+	ActionTokenRevoke,
+}
+
+type (
+	Event struct {
+		// ActorID is nil when the actor could not be identified, such as a
+		// failed login.
+		ActorID    *int64
+		ActorName  string
+		Action     string
+		Target     string
+		RemoteAddr string
+		Err        error
+	}
+
+	Recorder interface {
+		Record(context.Context, *Event)
+	}
+
+	RecorderParams struct {
+		fx.In
+
+		Querier database.Querier
+		Logger  *slog.Logger
+	}
+
+	recorder struct {
+		db     database.Querier
+		logger *slog.Logger
+	}
+)
+
+func (e *Event) Outcome() string {
+	if e.Err != nil {
+		return OutcomeFailure
+	}
+
+	return OutcomeSuccess
+}
+
+// Record implements Recorder. Failing to persist an event is logged rather
+// than returned, so that auditing never blocks the audited action.
+func (r *recorder) Record(ctx context.Context, e *Event) {
+	params := database.CreateAuditEventParams{
+		CreatedAt:  time.Now().UTC(),
+		ActorID:    e.ActorID,
+		ActorName:  e.ActorName,
+		Action:     e.Action,
+		Target:     e.Target,
+		RemoteAddr: e.RemoteAddr,
+		Outcome:    e.Outcome(),
+	}
+
+	if e.Err != nil {
+		msg := e.Err.Error()
+		params.Error = &msg
+	}
+
+	attrs := []any{
+		slog.String("actor", e.ActorName),
+		slog.String("action", e.Action),
+		slog.String("target", e.Target),
+		slog.String("remote_addr", e.RemoteAddr),
+		slog.String("outcome", params.Outcome),
+	}
+
+	r.logger.Info("audit event", attrs...)
+	if err := r.db.CreateAuditEvent(context.WithoutCancel(ctx), params); err != nil {
+		r.logger.Error("failed to record audit event", append(attrs, slog.String("error", err.Error()))...)
+	}
+}
+
+func NewRecorder(p RecorderParams) Recorder {
+	return &recorder{p.Querier, p.Logger}
+}
@@ -0,0 +1,30 @@
+-- name: ListAccessTokens :many
+SELECT *
+FROM access_tokens
+WHERE user_id = @user_id
+ORDER BY created_at DESC;
+
+-- name: FindAccessTokenByHash :one
+SELECT *
+FROM access_tokens
+WHERE token_hash = @token_hash
+LIMIT 1;
+
+-- name: CreateAccessToken :one
+INSERT INTO access_tokens (user_id, name, token_hash, permissions, created_at, expires_at)
+VALUES (@user_id, @name, @token_hash, @permissions, @created_at, @expires_at)
+RETURNING id;
+
+-- name: UseAccessToken :exec
+UPDATE access_tokens
+SET last_used_at = @last_used_at
+WHERE id = @id;
+
+-- name: RemoveAccessToken :execrows
+DELETE FROM access_tokens
+WHERE id = @id
+  AND user_id = @user_id;
+
+-- name: RemoveAccessTokensByUser :exec
+DELETE FROM access_tokens
+WHERE user_id = @user_id;
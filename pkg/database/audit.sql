@@ -0,0 +1,14 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (created_at, actor_id, actor_name, action, target, remote_addr, outcome, error)
+VALUES (@created_at, @actor_id, @actor_name, @action, @target, @remote_addr, @outcome, @error);
+
+-- name: ListAuditEvents :many
+SELECT *
+FROM audit_events
+WHERE (CAST(@action AS TEXT) = '' OR action = @action)
+  AND (CAST(@actor_name AS TEXT) = '' OR actor_name = @actor_name)
+  AND (CAST(@outcome AS TEXT) = '' OR outcome = @outcome)
+  AND created_at >= @since
+  AND created_at < @until
+ORDER BY created_at DESC, id DESC
+LIMIT CAST(@limit AS BIGINT) OFFSET CAST(@offset AS BIGINT);
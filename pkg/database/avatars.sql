@@ -0,0 +1,16 @@
+-- name: FindUserAvatar :one
+SELECT *
+FROM user_avatars
+WHERE user_id = @user_id
+LIMIT 1;
+
+-- name: UpsertUserAvatar :exec
+INSERT INTO user_avatars (user_id, image, updated_at)
+VALUES (@user_id, @image, @updated_at)
+ON CONFLICT (user_id) DO UPDATE
+SET image = excluded.image,
+    updated_at = excluded.updated_at;
+
+-- name: RemoveUserAvatar :exec
+DELETE FROM user_avatars
+WHERE user_id = @user_id;
@@ -3,12 +3,24 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 	"go.uber.org/config"
+
+	"github.com/bdreece/herobrian/pkg/database/postgres"
+)
+
+// Drivers accepted by the database.driver option.
+const (
+	SQLite   = "sqlite3"
+	Postgres = "postgres"
 )
 
+var ErrUnknownDriver = errors.New("unknown database driver")
+
 type SuperUserOptions struct {
 	Username     string `yaml:"username"`
 	FirstName    string `yaml:"first_name"`
@@ -18,7 +30,7 @@ type SuperUserOptions struct {
 }
 
 type Options struct {
-	Schema           string `yaml:"schema"`
+	Driver           string `yaml:"driver"`
 	ConnectionString string `yaml:"connection_string"`
 }
 
@@ -34,7 +46,7 @@ func ConfigureSuperUser(provider config.Provider) (*SuperUserOptions, error) {
 }
 
 func Configure(provider config.Provider) (*Options, error) {
-	opts := new(Options)
+	opts := &Options{Driver: SQLite}
 	if err := provider.Get("database").Populate(opts); err != nil {
 		return nil, fmt.Errorf("failed to configure database options: %w", err)
 	}
@@ -43,5 +55,52 @@ func Configure(provider config.Provider) (*Options, error) {
 }
 
 func Dial(opts *Options) (*sql.DB, error) {
-	return sql.Open("sqlite3", opts.ConnectionString)
+	if _, ok := migrators[opts.Driver]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, opts.Driver)
+	}
+
+	return sql.Open(opts.Driver, opts.ConnectionString)
+}
+
+// Driver names the driver a database was opened with.
+func Driver(db *sql.DB) string {
+	switch db.Driver().(type) {
+	case *pq.Driver:
+		return Postgres
+	case *sqlite3.SQLiteDriver:
+		return SQLite
+	default:
+		return ""
+	}
+}
+
+// NewQuerier runs the queries generated for the driver of db.
+func NewQuerier(db *sql.DB) Querier {
+	return WithTx(db, db)
+}
+
+// WithTx runs the queries generated for the driver of db within tx, which
+// may be db itself.
+func WithTx(db *sql.DB, tx DBTX) Querier {
+	if Driver(db) == Postgres {
+		return &postgresQuerier{postgres.New(tx)}
+	}
+
+	return New(tx)
+}
+
+// IsUniqueViolation reports whether err was caused by a unique constraint,
+// on either driver.
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+
+	return false
 }
@@ -0,0 +1,31 @@
+-- name: ListExternalAccounts :many
+SELECT *
+FROM external_accounts
+WHERE user_id = @user_id
+ORDER BY provider ASC;
+
+-- name: FindExternalAccount :one
+SELECT *
+FROM external_accounts
+WHERE provider = @provider
+  AND subject = @subject
+LIMIT 1;
+
+-- name: CreateExternalAccount :exec
+INSERT INTO external_accounts (user_id, provider, subject, username, created_at, last_used_at)
+VALUES (@user_id, @provider, @subject, @username, @created_at, @created_at);
+
+-- name: UseExternalAccount :exec
+UPDATE external_accounts
+SET username = @username,
+    last_used_at = @last_used_at
+WHERE id = @id;
+
+-- name: RemoveExternalAccount :execrows
+DELETE FROM external_accounts
+WHERE id = @id
+  AND user_id = @user_id;
+
+-- name: RemoveExternalAccountsByUser :exec
+DELETE FROM external_accounts
+WHERE user_id = @user_id;
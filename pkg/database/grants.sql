@@ -0,0 +1,29 @@
+-- name: HasUnitGrant :one
+SELECT CAST(EXISTS (
+    SELECT 1
+    FROM unit_grants
+    WHERE user_id = @user_id
+      AND instance = @instance
+      AND permission = @permission
+) AS BOOLEAN);
+
+-- name: ListUnitGrants :many
+SELECT unit_grants.user_id, unit_grants.instance, unit_grants.permission, users.username
+FROM unit_grants
+    INNER JOIN users ON users.id = unit_grants.user_id
+ORDER BY users.username, unit_grants.instance, unit_grants.permission;
+
+-- name: CreateUnitGrant :exec
+INSERT INTO unit_grants (user_id, instance, permission)
+VALUES (@user_id, @instance, @permission)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveUnitGrant :execrows
+DELETE FROM unit_grants
+WHERE user_id = @user_id
+  AND instance = @instance
+  AND permission = @permission;
+
+-- name: RemoveUnitGrantsByUser :exec
+DELETE FROM unit_grants
+WHERE user_id = @user_id;
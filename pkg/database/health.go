@@ -0,0 +1,11 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/bdreece/herobrian/pkg/health"
+)
+
+func NewHealthCheck(db *sql.DB) health.Check {
+	return health.NewCheck("database", db.PingContext)
+}
@@ -0,0 +1,51 @@
+-- name: FindInvite :one
+SELECT *
+FROM invites
+WHERE id = @id
+LIMIT 1;
+
+-- name: ListInvites :many
+SELECT invites.*, users.username AS inviter_name
+FROM invites
+    LEFT JOIN users ON users.id = invites.inviter_id
+ORDER BY invites.created_at DESC;
+
+-- name: ListInviteRedemptions :many
+SELECT invite_redemptions.invite_id, invite_redemptions.redeemed_at, users.username
+FROM invite_redemptions
+    INNER JOIN users ON users.id = invite_redemptions.user_id
+ORDER BY invite_redemptions.redeemed_at ASC;
+
+-- name: CreateInvite :exec
+INSERT INTO invites (id, inviter_id, role_id, email, max_uses, created_at, expires_at)
+VALUES (@id, @inviter_id, @role_id, @email, @max_uses, @created_at, @expires_at);
+
+-- name: ConsumeInvite :execrows
+UPDATE invites
+SET uses = uses + 1
+WHERE id = @id
+  AND revoked_at IS NULL
+  AND uses < max_uses
+  AND expires_at > @now;
+
+-- name: CreateInviteRedemption :exec
+INSERT INTO invite_redemptions (invite_id, user_id, redeemed_at)
+VALUES (@invite_id, @user_id, @redeemed_at);
+
+-- name: RevokeInvite :execrows
+UPDATE invites
+SET revoked_at = @revoked_at
+WHERE id = @id
+  AND revoked_at IS NULL;
+
+-- name: ListInviteDeliveries :many
+SELECT invite_deliveries.*,
+       email_outbox.status AS outbox_status,
+       email_outbox.last_error AS outbox_error
+FROM invite_deliveries
+LEFT JOIN email_outbox ON email_outbox.id = invite_deliveries.outbox_message_id
+ORDER BY invite_deliveries.attempted_at ASC;
+
+-- name: CreateInviteDelivery :exec
+INSERT INTO invite_deliveries (invite_id, email, attempted_at, error, outbox_message_id)
+VALUES (@invite_id, @email, @attempted_at, @error, @outbox_message_id);
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const findSchemaVersion = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+
+// migrator holds the statements which track migrations in each dialect.
+type migrator struct {
+	dir                    string
+	createSchemaMigrations string
+	createSchemaVersion    string
+}
+
+var migrators = map[string]migrator{
+	SQLite: {
+		dir: "migrations/sqlite",
+		createSchemaMigrations: `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+)`,
+		createSchemaVersion: `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?1, ?2, ?3)`,
+	},
+	Postgres: {
+		dir: "migrations/postgres",
+		createSchemaMigrations: `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL
+)`,
+		createSchemaVersion: `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+	},
+}
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+//go:embed migrations/*/*.sql
+var migrations embed.FS
+
+// Migration is one step of the schema, read from a file named
+// <version>_<name>.sql. Versions start at 1 and have no gaps.
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string
+}
+
+// Migrations lists the embedded migrations of a driver in order.
+func Migrations(driver string) ([]Migration, error) {
+	m, ok := migrators[driver]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, driver)
+	}
+
+	entries, err := fs.ReadDir(migrations, m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		version, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %q is not named <version>_<name>.sql", entry.Name())
+		}
+
+		v, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q has an invalid version: %w", entry.Name(), err)
+		}
+
+		b, err := migrations.ReadFile(path.Join(m.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, Migration{v, name, string(b)})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != int64(i+1) {
+			return nil, fmt.Errorf("migration %d_%s is out of sequence, expected version %d", m.Version, m.Name, i+1)
+		}
+	}
+
+	return out, nil
+}
+
+// Migrate applies each pending migration in its own transaction, returning
+// those applied. It refuses to touch a database migrated by a newer binary.
+func Migrate(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	driver := Driver(db)
+	steps, err := Migrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	m := migrators[driver]
+	if _, err = db.ExecContext(ctx, m.createSchemaMigrations); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int64
+	if err = db.QueryRowContext(ctx, findSchemaVersion).Scan(&current); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	latest := int64(len(steps))
+	if current > latest {
+		return nil, fmt.Errorf("%w: database is at version %d, binary knows up to %d", ErrSchemaTooNew, current, latest)
+	}
+
+	applied := make([]Migration, 0, latest-current)
+	for _, step := range steps[current:] {
+		if err = m.apply(ctx, db, step); err != nil {
+			return applied, fmt.Errorf("failed to apply migration %d_%s: %w", step.Version, step.Name, err)
+		}
+
+		applied = append(applied, step)
+	}
+
+	return applied, nil
+}
+
+func (m migrator) apply(ctx context.Context, db *sql.DB, step Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, step.SQL); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, m.createSchemaVersion, step.Version, step.Name, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
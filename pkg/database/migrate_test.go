@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open(SQLite, "file:"+filepath.Join(t.TempDir(), "herobrian.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// TestMigrateBaseline upgrades a database created from the schema.sql of
+// the first release, which has no schema_migrations table.
+func TestMigrateBaseline(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	baseline, err := migrations.ReadFile("migrations/sqlite/0001_initial.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.ExecContext(ctx, string(baseline)); err != nil {
+		t.Fatalf("failed to create baseline schema: %v", err)
+	}
+
+	res, err := db.ExecContext(ctx, `INSERT INTO users (username, password_hash, role_id) VALUES ('steve', 'hash', 3)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := Migrate(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if len(applied) != len(steps) {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(steps))
+	}
+
+	user, err := NewQuerier(db).FindUser(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to find user after migrating: %v", err)
+	}
+	if user.Username != "steve" || user.PasswordHash != "hash" || user.RoleID != 3 {
+		t.Errorf("user changed by migration: %+v", user)
+	}
+	if user.Disabled || user.SessionVersion != 0 || user.Email != nil || user.AvatarSource != "" {
+		t.Errorf("new columns have unexpected defaults: %+v", user)
+	}
+
+	applied, err = Migrate(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to migrate again: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("migrating again applied %d migrations", len(applied))
+	}
+}
+
+func TestMigrateFresh(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	if _, err := Migrate(ctx, db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	query := NewQuerier(db)
+	id, err := query.CreateUser(ctx, CreateUserParams{Username: "alex", PasswordHash: "hash", RoleID: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = query.FindUser(ctx, id); err != nil {
+		t.Fatalf("failed to find user: %v", err)
+	}
+}
+
+func TestMigrateTooNew(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	if _, err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, 'future', CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Migrate(ctx, db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("got %v, want ErrSchemaTooNew", err)
+	}
+}
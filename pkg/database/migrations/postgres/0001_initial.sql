@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id BIGINT PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS IX_roles_name ON roles (name ASC);
+
+INSERT INTO roles
+    (id, name)
+VALUES
+    (0, 'User'),
+    (1, 'Moderator'),
+    (2, 'Admin'),
+    (3, 'Super')
+ON CONFLICT (id) DO UPDATE
+SET name = excluded.name;
+
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    username TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    role_id BIGINT NOT NULL REFERENCES roles (id)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS IX_users_username ON users (username ASC);
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN first_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN last_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN minecraft_username TEXT;
+ALTER TABLE users ADD COLUMN minecraft_uuid TEXT;
+ALTER TABLE users ADD COLUMN avatar_source TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS IX_users_minecraft_uuid ON users (minecraft_uuid ASC) WHERE minecraft_uuid IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_avatars (
+    user_id BIGINT PRIMARY KEY REFERENCES users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    image BYTEA NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,196 @@
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN session_version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN email TEXT;
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS IX_users_email ON users (email ASC) WHERE email IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id INTEGER PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    actor_id INTEGER,
+    actor_name TEXT NOT NULL,
+    action TEXT NOT NULL,
+    target TEXT NOT NULL,
+    remote_addr TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS IX_audit_events_created_at ON audit_events (created_at DESC);
+
+CREATE TABLE IF NOT EXISTS unit_grants (
+    user_id INTEGER NOT NULL REFERENCES users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    instance TEXT NOT NULL,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (user_id, instance, permission)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    user_agent TEXT NOT NULL,
+    remote_addr TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS IX_sessions_user_id ON sessions (user_id ASC);
+
+CREATE TABLE IF NOT EXISTS invites (
+    id TEXT PRIMARY KEY,
+    inviter_id INTEGER NOT NULL,
+    role_id INTEGER NOT NULL REFERENCES roles (id)
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION,
+    email TEXT,
+    max_uses INTEGER NOT NULL DEFAULT 1,
+    uses INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS IX_invites_created_at ON invites (created_at DESC);
+
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+    invite_id TEXT NOT NULL REFERENCES invites (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    redeemed_at DATETIME NOT NULL,
+    PRIMARY KEY (invite_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS invite_deliveries (
+    id INTEGER PRIMARY KEY,
+    invite_id TEXT NOT NULL REFERENCES invites (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    attempted_at DATETIME NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS IX_invite_deliveries_invite_id ON invite_deliveries (invite_id);
+
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id INTEGER PRIMARY KEY,
+    recipients TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    message TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at DATETIME NOT NULL,
+    next_attempt_at DATETIME NOT NULL,
+    sent_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS IX_email_outbox_status ON email_outbox (status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL,
+    event TEXT NOT NULL,
+    instance TEXT NOT NULL DEFAULT '',
+    channel TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (user_id, event, instance, channel)
+);
+
+CREATE INDEX IF NOT EXISTS IX_notification_preferences_event ON notification_preferences (event, instance);
+
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh TEXT NOT NULL,
+    auth TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS IX_push_subscriptions_user_id ON push_subscriptions (user_id);
+
+CREATE TABLE IF NOT EXISTS role_policies (
+    role_id INTEGER PRIMARY KEY REFERENCES roles (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    require_totp BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    confirmed_at DATETIME,
+    last_used_step INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at DATETIME
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS IX_recovery_codes_user_id ON recovery_codes (user_id ASC, code_hash ASC);
+
+CREATE TABLE IF NOT EXISTS passkeys (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    credential_id BLOB NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    public_key BLOB NOT NULL,
+    attestation_type TEXT NOT NULL,
+    transports TEXT NOT NULL,
+    aaguid BLOB NOT NULL,
+    sign_count INTEGER NOT NULL DEFAULT 0,
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME NOT NULL,
+    last_used_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS IX_passkeys_user_id ON passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS external_accounts (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    username TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_used_at DATETIME
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS IX_external_accounts_provider_subject ON external_accounts (provider ASC, subject ASC);
+CREATE UNIQUE INDEX IF NOT EXISTS IX_external_accounts_user_id_provider ON external_accounts (user_id ASC, provider ASC);
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id)
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash BLOB NOT NULL UNIQUE,
+    permissions TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME,
+    last_used_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS IX_access_tokens_user_id ON access_tokens (user_id);
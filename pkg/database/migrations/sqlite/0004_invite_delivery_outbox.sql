@@ -0,0 +1,3 @@
+-- The outbox deletes sent messages after a while, so this is not a foreign
+-- key: a delivery whose message is gone was sent.
+ALTER TABLE invite_deliveries ADD COLUMN outbox_message_id INTEGER;
@@ -0,0 +1,4 @@
+-- Only verified addresses are unique. Anyone may enter an address, so
+-- pending ones must not keep its owner from verifying it.
+DROP INDEX IF EXISTS IX_users_email;
+CREATE UNIQUE INDEX IX_users_email ON users (email ASC) WHERE email IS NOT NULL AND email_verified;
@@ -0,0 +1,58 @@
+-- name: ListNotificationPreferences :many
+SELECT *
+FROM notification_preferences
+WHERE user_id = @user_id
+ORDER BY event ASC, instance ASC, channel ASC;
+
+-- name: ListNotificationSubscribers :many
+SELECT DISTINCT users.id, users.username, users.email, users.email_verified, notification_preferences.channel
+FROM notification_preferences
+    INNER JOIN users ON users.id = notification_preferences.user_id
+WHERE notification_preferences.event = @event
+  AND (notification_preferences.instance = '' OR notification_preferences.instance = @instance)
+  AND users.disabled = FALSE;
+
+-- name: CreateNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, event, instance, channel, created_at)
+VALUES (@user_id, @event, @instance, @channel, @created_at)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveNotificationPreference :execrows
+DELETE FROM notification_preferences
+WHERE user_id = @user_id
+  AND event = @event
+  AND instance = @instance
+  AND channel = @channel;
+
+-- name: RemoveNotificationPreferencesByUser :exec
+DELETE FROM notification_preferences
+WHERE user_id = @user_id;
+
+-- name: ListPushSubscriptions :many
+SELECT *
+FROM push_subscriptions
+WHERE user_id = @user_id
+ORDER BY created_at DESC;
+
+-- name: CreatePushSubscription :exec
+INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent, created_at)
+VALUES (@user_id, @endpoint, @p256dh, @auth, @user_agent, @created_at)
+ON CONFLICT (endpoint) DO UPDATE
+SET user_id = excluded.user_id,
+    p256dh = excluded.p256dh,
+    auth = excluded.auth,
+    user_agent = excluded.user_agent,
+    created_at = excluded.created_at;
+
+-- name: RemovePushSubscription :execrows
+DELETE FROM push_subscriptions
+WHERE id = @id
+  AND user_id = @user_id;
+
+-- name: RemovePushSubscriptionByEndpoint :exec
+DELETE FROM push_subscriptions
+WHERE endpoint = @endpoint;
+
+-- name: RemovePushSubscriptionsByUser :exec
+DELETE FROM push_subscriptions
+WHERE user_id = @user_id;
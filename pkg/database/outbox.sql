@@ -0,0 +1,54 @@
+-- name: FindOutboxMessage :one
+SELECT *
+FROM email_outbox
+WHERE id = @id
+LIMIT 1;
+
+-- name: ListOutboxMessages :many
+SELECT id, recipients, subject, status, attempts, last_error, created_at, next_attempt_at, sent_at
+FROM email_outbox
+WHERE (CAST(@status AS TEXT) = '' OR status = @status)
+ORDER BY created_at DESC, id DESC
+LIMIT CAST(@limit AS BIGINT);
+
+-- name: ListDueOutboxMessages :many
+SELECT *
+FROM email_outbox
+WHERE status = 'pending'
+  AND next_attempt_at <= @now
+ORDER BY next_attempt_at ASC
+LIMIT CAST(@limit AS BIGINT);
+
+-- name: CreateOutboxMessage :one
+INSERT INTO email_outbox (recipients, subject, message, created_at, next_attempt_at)
+VALUES (@recipients, @subject, @message, @created_at, @created_at)
+RETURNING id;
+
+-- name: MarkOutboxMessageSent :exec
+UPDATE email_outbox
+SET status = 'sent',
+    attempts = attempts + 1,
+    last_error = NULL,
+    sent_at = @sent_at
+WHERE id = @id;
+
+-- name: MarkOutboxMessageFailed :exec
+UPDATE email_outbox
+SET status = @status,
+    attempts = attempts + 1,
+    last_error = @last_error,
+    next_attempt_at = @next_attempt_at
+WHERE id = @id;
+
+-- name: RetryOutboxMessage :execrows
+UPDATE email_outbox
+SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = @now
+WHERE id = @id
+  AND status != 'sent';
+
+-- name: RemoveSentOutboxMessages :execrows
+DELETE FROM email_outbox
+WHERE status = 'sent'
+  AND sent_at < @before;
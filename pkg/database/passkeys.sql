@@ -0,0 +1,62 @@
+-- name: ListPasskeys :many
+SELECT *
+FROM passkeys
+WHERE user_id = @user_id
+ORDER BY created_at ASC;
+
+-- name: FindPasskeyByCredentialID :one
+SELECT *
+FROM passkeys
+WHERE credential_id = @credential_id
+LIMIT 1;
+
+-- name: CreatePasskey :one
+INSERT INTO passkeys (
+    user_id,
+    credential_id,
+    name,
+    public_key,
+    attestation_type,
+    transports,
+    aaguid,
+    sign_count,
+    backup_eligible,
+    backup_state,
+    created_at
+)
+VALUES (
+    @user_id,
+    @credential_id,
+    @name,
+    @public_key,
+    @attestation_type,
+    @transports,
+    @aaguid,
+    @sign_count,
+    @backup_eligible,
+    @backup_state,
+    @created_at
+)
+RETURNING id;
+
+-- name: UsePasskey :exec
+UPDATE passkeys
+SET sign_count = @sign_count,
+    backup_state = @backup_state,
+    last_used_at = @last_used_at
+WHERE id = @id;
+
+-- name: RenamePasskey :execrows
+UPDATE passkeys
+SET name = @name
+WHERE id = @id
+  AND user_id = @user_id;
+
+-- name: RemovePasskey :execrows
+DELETE FROM passkeys
+WHERE id = @id
+  AND user_id = @user_id;
+
+-- name: RemovePasskeysByUser :exec
+DELETE FROM passkeys
+WHERE user_id = @user_id;
@@ -0,0 +1,434 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/bdreece/herobrian/pkg/database/postgres"
+)
+
+// postgresQuerier runs the queries generated for PostgreSQL. Both engines
+// generate identical models and parameters, so each converts directly.
+type postgresQuerier struct {
+	q *postgres.Queries
+}
+
+var _ Querier = (*postgresQuerier)(nil)
+
+func convertRows[S, D any](rows []S, err error, convert func(S) D) ([]D, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]D, len(rows))
+	for i, r := range rows {
+		out[i] = convert(r)
+	}
+
+	return out, nil
+}
+
+func (p *postgresQuerier) ConfirmUserTOTP(ctx context.Context, arg ConfirmUserTOTPParams) (int64, error) {
+	return p.q.ConfirmUserTOTP(ctx, postgres.ConfirmUserTOTPParams(arg))
+}
+
+func (p *postgresQuerier) ConsumeInvite(ctx context.Context, arg ConsumeInviteParams) (int64, error) {
+	return p.q.ConsumeInvite(ctx, postgres.ConsumeInviteParams(arg))
+}
+
+func (p *postgresQuerier) CountRecoveryCodes(ctx context.Context, userID int64) (int64, error) {
+	return p.q.CountRecoveryCodes(ctx, userID)
+}
+
+func (p *postgresQuerier) CountUsersByRole(ctx context.Context, roleID int64) (int64, error) {
+	return p.q.CountUsersByRole(ctx, roleID)
+}
+
+func (p *postgresQuerier) CreateAccessToken(ctx context.Context, arg CreateAccessTokenParams) (int64, error) {
+	return p.q.CreateAccessToken(ctx, postgres.CreateAccessTokenParams(arg))
+}
+
+func (p *postgresQuerier) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) error {
+	return p.q.CreateAuditEvent(ctx, postgres.CreateAuditEventParams(arg))
+}
+
+func (p *postgresQuerier) CreateExternalAccount(ctx context.Context, arg CreateExternalAccountParams) error {
+	return p.q.CreateExternalAccount(ctx, postgres.CreateExternalAccountParams(arg))
+}
+
+func (p *postgresQuerier) CreateInvite(ctx context.Context, arg CreateInviteParams) error {
+	return p.q.CreateInvite(ctx, postgres.CreateInviteParams(arg))
+}
+
+func (p *postgresQuerier) CreateInviteDelivery(ctx context.Context, arg CreateInviteDeliveryParams) error {
+	return p.q.CreateInviteDelivery(ctx, postgres.CreateInviteDeliveryParams(arg))
+}
+
+func (p *postgresQuerier) CreateInviteRedemption(ctx context.Context, arg CreateInviteRedemptionParams) error {
+	return p.q.CreateInviteRedemption(ctx, postgres.CreateInviteRedemptionParams(arg))
+}
+
+func (p *postgresQuerier) CreateNotificationPreference(ctx context.Context, arg CreateNotificationPreferenceParams) error {
+	return p.q.CreateNotificationPreference(ctx, postgres.CreateNotificationPreferenceParams(arg))
+}
+
+func (p *postgresQuerier) CreateOutboxMessage(ctx context.Context, arg CreateOutboxMessageParams) (int64, error) {
+	return p.q.CreateOutboxMessage(ctx, postgres.CreateOutboxMessageParams(arg))
+}
+
+func (p *postgresQuerier) CreatePasskey(ctx context.Context, arg CreatePasskeyParams) (int64, error) {
+	return p.q.CreatePasskey(ctx, postgres.CreatePasskeyParams(arg))
+}
+
+func (p *postgresQuerier) CreatePushSubscription(ctx context.Context, arg CreatePushSubscriptionParams) error {
+	return p.q.CreatePushSubscription(ctx, postgres.CreatePushSubscriptionParams(arg))
+}
+
+func (p *postgresQuerier) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	return p.q.CreateRecoveryCode(ctx, postgres.CreateRecoveryCodeParams(arg))
+}
+
+func (p *postgresQuerier) CreateSession(ctx context.Context, arg CreateSessionParams) error {
+	return p.q.CreateSession(ctx, postgres.CreateSessionParams(arg))
+}
+
+func (p *postgresQuerier) CreateUnitGrant(ctx context.Context, arg CreateUnitGrantParams) error {
+	return p.q.CreateUnitGrant(ctx, postgres.CreateUnitGrantParams(arg))
+}
+
+func (p *postgresQuerier) CreateUser(ctx context.Context, arg CreateUserParams) (int64, error) {
+	return p.q.CreateUser(ctx, postgres.CreateUserParams(arg))
+}
+
+func (p *postgresQuerier) FindAccessTokenByHash(ctx context.Context, tokenHash []byte) (AccessToken, error) {
+	row, err := p.q.FindAccessTokenByHash(ctx, tokenHash)
+	return AccessToken(row), err
+}
+
+func (p *postgresQuerier) FindExternalAccount(ctx context.Context, arg FindExternalAccountParams) (ExternalAccount, error) {
+	row, err := p.q.FindExternalAccount(ctx, postgres.FindExternalAccountParams(arg))
+	return ExternalAccount(row), err
+}
+
+func (p *postgresQuerier) FindInvite(ctx context.Context, id string) (Invite, error) {
+	row, err := p.q.FindInvite(ctx, id)
+	return Invite(row), err
+}
+
+func (p *postgresQuerier) FindOutboxMessage(ctx context.Context, id int64) (EmailOutbox, error) {
+	row, err := p.q.FindOutboxMessage(ctx, id)
+	return EmailOutbox(row), err
+}
+
+func (p *postgresQuerier) FindPasskeyByCredentialID(ctx context.Context, credentialID []byte) (Passkey, error) {
+	row, err := p.q.FindPasskeyByCredentialID(ctx, credentialID)
+	return Passkey(row), err
+}
+
+func (p *postgresQuerier) FindRoleRequiresTOTP(ctx context.Context, roleID int64) (bool, error) {
+	return p.q.FindRoleRequiresTOTP(ctx, roleID)
+}
+
+func (p *postgresQuerier) FindSession(ctx context.Context, arg FindSessionParams) (Session, error) {
+	row, err := p.q.FindSession(ctx, postgres.FindSessionParams(arg))
+	return Session(row), err
+}
+
+func (p *postgresQuerier) FindUser(ctx context.Context, id int64) (User, error) {
+	row, err := p.q.FindUser(ctx, id)
+	return User(row), err
+}
+
+func (p *postgresQuerier) FindUserAvatar(ctx context.Context, userID int64) (UserAvatar, error) {
+	row, err := p.q.FindUserAvatar(ctx, userID)
+	return UserAvatar(row), err
+}
+
+func (p *postgresQuerier) FindUserByEmail(ctx context.Context, email *string) (User, error) {
+	row, err := p.q.FindUserByEmail(ctx, email)
+	return User(row), err
+}
+
+func (p *postgresQuerier) FindUserByUsername(ctx context.Context, username string) (User, error) {
+	row, err := p.q.FindUserByUsername(ctx, username)
+	return User(row), err
+}
+
+func (p *postgresQuerier) FindUserTOTP(ctx context.Context, userID int64) (UserTotp, error) {
+	row, err := p.q.FindUserTOTP(ctx, userID)
+	return UserTotp(row), err
+}
+
+func (p *postgresQuerier) HasUnitGrant(ctx context.Context, arg HasUnitGrantParams) (bool, error) {
+	return p.q.HasUnitGrant(ctx, postgres.HasUnitGrantParams(arg))
+}
+
+func (p *postgresQuerier) ListAccessTokens(ctx context.Context, userID int64) ([]AccessToken, error) {
+	rows, err := p.q.ListAccessTokens(ctx, userID)
+	return convertRows(rows, err, func(r postgres.AccessToken) AccessToken { return AccessToken(r) })
+}
+
+func (p *postgresQuerier) ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := p.q.ListAuditEvents(ctx, postgres.ListAuditEventsParams(arg))
+	return convertRows(rows, err, func(r postgres.AuditEvent) AuditEvent { return AuditEvent(r) })
+}
+
+func (p *postgresQuerier) ListDueOutboxMessages(ctx context.Context, arg ListDueOutboxMessagesParams) ([]EmailOutbox, error) {
+	rows, err := p.q.ListDueOutboxMessages(ctx, postgres.ListDueOutboxMessagesParams(arg))
+	return convertRows(rows, err, func(r postgres.EmailOutbox) EmailOutbox { return EmailOutbox(r) })
+}
+
+func (p *postgresQuerier) ListExternalAccounts(ctx context.Context, userID int64) ([]ExternalAccount, error) {
+	rows, err := p.q.ListExternalAccounts(ctx, userID)
+	return convertRows(rows, err, func(r postgres.ExternalAccount) ExternalAccount { return ExternalAccount(r) })
+}
+
+func (p *postgresQuerier) ListInviteDeliveries(ctx context.Context) ([]ListInviteDeliveriesRow, error) {
+	rows, err := p.q.ListInviteDeliveries(ctx)
+	return convertRows(rows, err, func(r postgres.ListInviteDeliveriesRow) ListInviteDeliveriesRow { return ListInviteDeliveriesRow(r) })
+}
+
+func (p *postgresQuerier) ListInviteRedemptions(ctx context.Context) ([]ListInviteRedemptionsRow, error) {
+	rows, err := p.q.ListInviteRedemptions(ctx)
+	return convertRows(rows, err, func(r postgres.ListInviteRedemptionsRow) ListInviteRedemptionsRow { return ListInviteRedemptionsRow(r) })
+}
+
+func (p *postgresQuerier) ListInvites(ctx context.Context) ([]ListInvitesRow, error) {
+	rows, err := p.q.ListInvites(ctx)
+	return convertRows(rows, err, func(r postgres.ListInvitesRow) ListInvitesRow { return ListInvitesRow(r) })
+}
+
+func (p *postgresQuerier) ListNotificationPreferences(ctx context.Context, userID int64) ([]NotificationPreference, error) {
+	rows, err := p.q.ListNotificationPreferences(ctx, userID)
+	return convertRows(rows, err, func(r postgres.NotificationPreference) NotificationPreference { return NotificationPreference(r) })
+}
+
+func (p *postgresQuerier) ListNotificationSubscribers(ctx context.Context, arg ListNotificationSubscribersParams) ([]ListNotificationSubscribersRow, error) {
+	rows, err := p.q.ListNotificationSubscribers(ctx, postgres.ListNotificationSubscribersParams(arg))
+	return convertRows(rows, err, func(r postgres.ListNotificationSubscribersRow) ListNotificationSubscribersRow {
+		return ListNotificationSubscribersRow(r)
+	})
+}
+
+func (p *postgresQuerier) ListOutboxMessages(ctx context.Context, arg ListOutboxMessagesParams) ([]ListOutboxMessagesRow, error) {
+	rows, err := p.q.ListOutboxMessages(ctx, postgres.ListOutboxMessagesParams(arg))
+	return convertRows(rows, err, func(r postgres.ListOutboxMessagesRow) ListOutboxMessagesRow { return ListOutboxMessagesRow(r) })
+}
+
+func (p *postgresQuerier) ListPasskeys(ctx context.Context, userID int64) ([]Passkey, error) {
+	rows, err := p.q.ListPasskeys(ctx, userID)
+	return convertRows(rows, err, func(r postgres.Passkey) Passkey { return Passkey(r) })
+}
+
+func (p *postgresQuerier) ListPushSubscriptions(ctx context.Context, userID int64) ([]PushSubscription, error) {
+	rows, err := p.q.ListPushSubscriptions(ctx, userID)
+	return convertRows(rows, err, func(r postgres.PushSubscription) PushSubscription { return PushSubscription(r) })
+}
+
+func (p *postgresQuerier) ListRolePolicies(ctx context.Context) ([]ListRolePoliciesRow, error) {
+	rows, err := p.q.ListRolePolicies(ctx)
+	return convertRows(rows, err, func(r postgres.ListRolePoliciesRow) ListRolePoliciesRow { return ListRolePoliciesRow(r) })
+}
+
+func (p *postgresQuerier) ListUnitGrants(ctx context.Context) ([]ListUnitGrantsRow, error) {
+	rows, err := p.q.ListUnitGrants(ctx)
+	return convertRows(rows, err, func(r postgres.ListUnitGrantsRow) ListUnitGrantsRow { return ListUnitGrantsRow(r) })
+}
+
+func (p *postgresQuerier) ListUserSessions(ctx context.Context, arg ListUserSessionsParams) ([]Session, error) {
+	rows, err := p.q.ListUserSessions(ctx, postgres.ListUserSessionsParams(arg))
+	return convertRows(rows, err, func(r postgres.Session) Session { return Session(r) })
+}
+
+func (p *postgresQuerier) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := p.q.ListUsers(ctx)
+	return convertRows(rows, err, func(r postgres.User) User { return User(r) })
+}
+
+func (p *postgresQuerier) MarkOutboxMessageFailed(ctx context.Context, arg MarkOutboxMessageFailedParams) error {
+	return p.q.MarkOutboxMessageFailed(ctx, postgres.MarkOutboxMessageFailedParams(arg))
+}
+
+func (p *postgresQuerier) MarkOutboxMessageSent(ctx context.Context, arg MarkOutboxMessageSentParams) error {
+	return p.q.MarkOutboxMessageSent(ctx, postgres.MarkOutboxMessageSentParams(arg))
+}
+
+func (p *postgresQuerier) RemoveAccessToken(ctx context.Context, arg RemoveAccessTokenParams) (int64, error) {
+	return p.q.RemoveAccessToken(ctx, postgres.RemoveAccessTokenParams(arg))
+}
+
+func (p *postgresQuerier) RemoveAccessTokensByUser(ctx context.Context, userID int64) error {
+	return p.q.RemoveAccessTokensByUser(ctx, userID)
+}
+
+func (p *postgresQuerier) RemoveAllSessions(ctx context.Context, id string) (int64, error) {
+	return p.q.RemoveAllSessions(ctx, id)
+}
+
+func (p *postgresQuerier) RemoveExpiredSessions(ctx context.Context, now time.Time) (int64, error) {
+	return p.q.RemoveExpiredSessions(ctx, now)
+}
+
+func (p *postgresQuerier) RemoveExternalAccount(ctx context.Context, arg RemoveExternalAccountParams) (int64, error) {
+	return p.q.RemoveExternalAccount(ctx, postgres.RemoveExternalAccountParams(arg))
+}
+
+func (p *postgresQuerier) RemoveExternalAccountsByUser(ctx context.Context, userID int64) error {
+	return p.q.RemoveExternalAccountsByUser(ctx, userID)
+}
+
+func (p *postgresQuerier) RemoveNotificationPreference(ctx context.Context, arg RemoveNotificationPreferenceParams) (int64, error) {
+	return p.q.RemoveNotificationPreference(ctx, postgres.RemoveNotificationPreferenceParams(arg))
+}
+
+func (p *postgresQuerier) RemoveNotificationPreferencesByUser(ctx context.Context, userID int64) error {
+	return p.q.RemoveNotificationPreferencesByUser(ctx, userID)
+}
+
+func (p *postgresQuerier) RemoveOtherUserSessions(ctx context.Context, arg RemoveOtherUserSessionsParams) (int64, error) {
+	return p.q.RemoveOtherUserSessions(ctx, postgres.RemoveOtherUserSessionsParams(arg))
+}
+
+func (p *postgresQuerier) RemovePasskey(ctx context.Context, arg RemovePasskeyParams) (int64, error) {
+	return p.q.RemovePasskey(ctx, postgres.RemovePasskeyParams(arg))
+}
+
+func (p *postgresQuerier) RemovePasskeysByUser(ctx context.Context, userID int64) error {
+	return p.q.RemovePasskeysByUser(ctx, userID)
+}
+
+func (p *postgresQuerier) RemovePushSubscription(ctx context.Context, arg RemovePushSubscriptionParams) (int64, error) {
+	return p.q.RemovePushSubscription(ctx, postgres.RemovePushSubscriptionParams(arg))
+}
+
+func (p *postgresQuerier) RemovePushSubscriptionByEndpoint(ctx context.Context, endpoint string) error {
+	return p.q.RemovePushSubscriptionByEndpoint(ctx, endpoint)
+}
+
+func (p *postgresQuerier) RemovePushSubscriptionsByUser(ctx context.Context, userID int64) error {
+	return p.q.RemovePushSubscriptionsByUser(ctx, userID)
+}
+
+func (p *postgresQuerier) RemoveRecoveryCodes(ctx context.Context, userID int64) error {
+	return p.q.RemoveRecoveryCodes(ctx, userID)
+}
+
+func (p *postgresQuerier) RemoveSentOutboxMessages(ctx context.Context, before *time.Time) (int64, error) {
+	return p.q.RemoveSentOutboxMessages(ctx, before)
+}
+
+func (p *postgresQuerier) RemoveSession(ctx context.Context, id string) (int64, error) {
+	return p.q.RemoveSession(ctx, id)
+}
+
+func (p *postgresQuerier) RemoveUnitGrant(ctx context.Context, arg RemoveUnitGrantParams) (int64, error) {
+	return p.q.RemoveUnitGrant(ctx, postgres.RemoveUnitGrantParams(arg))
+}
+
+func (p *postgresQuerier) RemoveUnitGrantsByUser(ctx context.Context, userID int64) error {
+	return p.q.RemoveUnitGrantsByUser(ctx, userID)
+}
+
+func (p *postgresQuerier) RemoveUser(ctx context.Context, id int64) (int64, error) {
+	return p.q.RemoveUser(ctx, id)
+}
+
+func (p *postgresQuerier) RemoveUserAvatar(ctx context.Context, userID int64) error {
+	return p.q.RemoveUserAvatar(ctx, userID)
+}
+
+func (p *postgresQuerier) RemoveUserSession(ctx context.Context, arg RemoveUserSessionParams) (int64, error) {
+	return p.q.RemoveUserSession(ctx, postgres.RemoveUserSessionParams(arg))
+}
+
+func (p *postgresQuerier) RemoveUserSessions(ctx context.Context, userID int64) (int64, error) {
+	return p.q.RemoveUserSessions(ctx, userID)
+}
+
+func (p *postgresQuerier) RemoveUserTOTP(ctx context.Context, userID int64) error {
+	return p.q.RemoveUserTOTP(ctx, userID)
+}
+
+func (p *postgresQuerier) RenamePasskey(ctx context.Context, arg RenamePasskeyParams) (int64, error) {
+	return p.q.RenamePasskey(ctx, postgres.RenamePasskeyParams(arg))
+}
+
+func (p *postgresQuerier) ResetUserPassword(ctx context.Context, arg ResetUserPasswordParams) (int64, error) {
+	return p.q.ResetUserPassword(ctx, postgres.ResetUserPasswordParams(arg))
+}
+
+func (p *postgresQuerier) RetryOutboxMessage(ctx context.Context, arg RetryOutboxMessageParams) (int64, error) {
+	return p.q.RetryOutboxMessage(ctx, postgres.RetryOutboxMessageParams(arg))
+}
+
+func (p *postgresQuerier) RevokeInvite(ctx context.Context, arg RevokeInviteParams) (int64, error) {
+	return p.q.RevokeInvite(ctx, postgres.RevokeInviteParams(arg))
+}
+
+func (p *postgresQuerier) TouchSession(ctx context.Context, arg TouchSessionParams) error {
+	return p.q.TouchSession(ctx, postgres.TouchSessionParams(arg))
+}
+
+func (p *postgresQuerier) UpdateUser(ctx context.Context, arg UpdateUserParams) (int64, error) {
+	return p.q.UpdateUser(ctx, postgres.UpdateUserParams(arg))
+}
+
+func (p *postgresQuerier) UpdateUserAvatarSource(ctx context.Context, arg UpdateUserAvatarSourceParams) (int64, error) {
+	return p.q.UpdateUserAvatarSource(ctx, postgres.UpdateUserAvatarSourceParams(arg))
+}
+
+func (p *postgresQuerier) UpdateUserDisabled(ctx context.Context, arg UpdateUserDisabledParams) (int64, error) {
+	return p.q.UpdateUserDisabled(ctx, postgres.UpdateUserDisabledParams(arg))
+}
+
+func (p *postgresQuerier) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (int64, error) {
+	return p.q.UpdateUserEmail(ctx, postgres.UpdateUserEmailParams(arg))
+}
+
+func (p *postgresQuerier) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (int64, error) {
+	return p.q.UpdateUserPassword(ctx, postgres.UpdateUserPasswordParams(arg))
+}
+
+func (p *postgresQuerier) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (int64, error) {
+	return p.q.UpdateUserProfile(ctx, postgres.UpdateUserProfileParams(arg))
+}
+
+func (p *postgresQuerier) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (int64, error) {
+	return p.q.UpdateUserRole(ctx, postgres.UpdateUserRoleParams(arg))
+}
+
+func (p *postgresQuerier) UpsertRolePolicy(ctx context.Context, arg UpsertRolePolicyParams) error {
+	return p.q.UpsertRolePolicy(ctx, postgres.UpsertRolePolicyParams(arg))
+}
+
+func (p *postgresQuerier) UpsertUserAvatar(ctx context.Context, arg UpsertUserAvatarParams) error {
+	return p.q.UpsertUserAvatar(ctx, postgres.UpsertUserAvatarParams(arg))
+}
+
+func (p *postgresQuerier) UpsertUserTOTP(ctx context.Context, arg UpsertUserTOTPParams) error {
+	return p.q.UpsertUserTOTP(ctx, postgres.UpsertUserTOTPParams(arg))
+}
+
+func (p *postgresQuerier) UseAccessToken(ctx context.Context, arg UseAccessTokenParams) error {
+	return p.q.UseAccessToken(ctx, postgres.UseAccessTokenParams(arg))
+}
+
+func (p *postgresQuerier) UseExternalAccount(ctx context.Context, arg UseExternalAccountParams) error {
+	return p.q.UseExternalAccount(ctx, postgres.UseExternalAccountParams(arg))
+}
+
+func (p *postgresQuerier) UsePasskey(ctx context.Context, arg UsePasskeyParams) error {
+	return p.q.UsePasskey(ctx, postgres.UsePasskeyParams(arg))
+}
+
+func (p *postgresQuerier) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	return p.q.UseRecoveryCode(ctx, postgres.UseRecoveryCodeParams(arg))
+}
+
+func (p *postgresQuerier) UseUserTOTPStep(ctx context.Context, arg UseUserTOTPStepParams) (int64, error) {
+	return p.q.UseUserTOTPStep(ctx, postgres.UseUserTOTPStepParams(arg))
+}
+
+func (p *postgresQuerier) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	return p.q.VerifyUserEmail(ctx, postgres.VerifyUserEmailParams(arg))
+}
@@ -0,0 +1,261 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bdreece/herobrian/pkg/database/postgres"
+)
+
+// recordingDriver fails every statement, recording its SQL.
+type recordingDriver struct {
+	queries *[]string
+}
+
+func (d recordingDriver) Open(string) (driver.Conn, error) { return recordingConn(d), nil }
+
+type recordingConn recordingDriver
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	*c.queries = append(*c.queries, query)
+	return nil, errRecorded
+}
+
+func (recordingConn) Close() error              { return nil }
+func (recordingConn) Begin() (driver.Tx, error) { return nil, errRecorded }
+
+var errRecorded = errors.New("recorded")
+
+// TestPostgresQueries runs every query through the PostgreSQL querier
+// without a server, checking that each is sent as generated for PostgreSQL.
+func TestPostgresQueries(t *testing.T) {
+	var queries []string
+	sql.Register("recording", recordingDriver{&queries})
+
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var q Querier = &postgresQuerier{postgres.New(db)}
+	v := reflect.ValueOf(q)
+	typ := reflect.TypeOf((*Querier)(nil)).Elem()
+	for i := 0; i < typ.NumMethod(); i++ {
+		m := typ.Method(i)
+		args := []reflect.Value{reflect.ValueOf(context.Background())}
+		for j := 1; j < m.Type.NumIn(); j++ {
+			args = append(args, reflect.Zero(m.Type.In(j)))
+		}
+
+		queries = queries[:0]
+		out := v.MethodByName(m.Name).Call(args)
+		if err, _ := out[len(out)-1].Interface().(error); !errors.Is(err, errRecorded) {
+			t.Errorf("%s returned %v, want the recorded error", m.Name, err)
+		}
+
+		if len(queries) != 1 {
+			t.Errorf("%s sent %d queries, want 1", m.Name, len(queries))
+			continue
+		}
+		if !strings.Contains(queries[0], "-- name: "+m.Name+" ") {
+			t.Errorf("%s sent another query:\n%s", m.Name, queries[0])
+		}
+		if sqlitePlaceholder.MatchString(queries[0]) {
+			t.Errorf("%s sent SQLite placeholders:\n%s", m.Name, queries[0])
+		}
+	}
+}
+
+var sqlitePlaceholder = regexp.MustCompile(`\?\d`)
+
+// openPostgres connects to the server named by HEROBRIAN_TEST_POSTGRES_DSN,
+// in a schema of its own which is dropped after the test.
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("HEROBRIAN_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("HEROBRIAN_TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open(Postgres, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// the search path is set per connection, so keep to one
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("herobrian_test_%d", time.Now().UnixNano())
+	if _, err = db.ExecContext(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.ExecContext(context.Background(), `DROP SCHEMA `+schema+` CASCADE`); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+	if _, err = db.ExecContext(ctx, `SET search_path TO `+schema); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestPostgres(t *testing.T) {
+	ctx := context.Background()
+	db := openPostgres(t)
+
+	if Driver(db) != Postgres {
+		t.Fatalf("driver is %q, want %q", Driver(db), Postgres)
+	}
+
+	steps, err := Migrations(Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := Migrate(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if len(applied) != len(steps) {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(steps))
+	}
+
+	query := NewQuerier(db)
+
+	id, err := query.CreateUser(ctx, CreateUserParams{Username: "steve", PasswordHash: "hash", RoleID: 3})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err = query.CreateUser(ctx, CreateUserParams{Username: "steve", PasswordHash: "hash", RoleID: 0}); !IsUniqueViolation(err) {
+		t.Errorf("creating a duplicate user returned %v, want a unique violation", err)
+	}
+
+	email := "steve@example.com"
+	if _, err = query.UpdateUserEmail(ctx, UpdateUserEmailParams{Email: &email, ID: id}); err != nil {
+		t.Fatalf("failed to update email: %v", err)
+	}
+
+	user, err := query.FindUserByEmail(ctx, &email)
+	if err != nil {
+		t.Fatalf("failed to find user by email: %v", err)
+	}
+	if user.ID != id || user.Username != "steve" || user.RoleID != 3 || user.Disabled || user.EmailVerified {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	// a transaction sees its own writes through the querier
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = WithTx(db, tx).UpdateUserDisabled(ctx, UpdateUserDisabledParams{Disabled: true, ID: id}); err != nil {
+		t.Fatalf("failed to disable user: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if user, err = query.FindUser(ctx, id); err != nil || !user.Disabled {
+		t.Errorf("user is not disabled after commit: %+v, %v", user, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if err = query.CreateInvite(ctx, CreateInviteParams{
+		ID:        "00000000-0000-0000-0000-000000000001",
+		InviterID: id,
+		RoleID:    0,
+		Email:     &email,
+		MaxUses:   1,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("failed to create invite: %v", err)
+	}
+
+	invites, err := query.ListInvites(ctx)
+	if err != nil {
+		t.Fatalf("failed to list invites: %v", err)
+	}
+	if len(invites) != 1 || invites[0].InviterName == nil || *invites[0].InviterName != "steve" || !invites[0].ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected invites: %+v", invites)
+	}
+
+	messageID, err := query.CreateOutboxMessage(ctx, CreateOutboxMessageParams{
+		Recipients: email,
+		Subject:    "You're invited",
+		Message:    "{}",
+		CreatedAt:  now,
+	})
+	if err != nil {
+		t.Fatalf("failed to queue message: %v", err)
+	}
+	if err = query.CreateInviteDelivery(ctx, CreateInviteDeliveryParams{
+		InviteID:        invites[0].ID,
+		Email:           email,
+		AttemptedAt:     now,
+		OutboxMessageID: &messageID,
+	}); err != nil {
+		t.Fatalf("failed to record delivery: %v", err)
+	}
+
+	sentAt := now.Add(time.Minute)
+	if err = query.MarkOutboxMessageSent(ctx, MarkOutboxMessageSentParams{SentAt: &sentAt, ID: messageID}); err != nil {
+		t.Fatalf("failed to mark message sent: %v", err)
+	}
+
+	deliveries, err := query.ListInviteDeliveries(ctx)
+	if err != nil {
+		t.Fatalf("failed to list deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].OutboxStatus == nil || *deliveries[0].OutboxStatus != "sent" {
+		t.Errorf("unexpected deliveries: %+v", deliveries)
+	}
+
+	messages, err := query.ListOutboxMessages(ctx, ListOutboxMessagesParams{Status: "sent", Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to list messages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ID != messageID {
+		t.Errorf("unexpected messages: %+v", messages)
+	}
+
+	if err = query.CreateAuditEvent(ctx, CreateAuditEventParams{
+		CreatedAt:  now,
+		ActorID:    &id,
+		ActorName:  "steve",
+		Action:     "invite.create",
+		Target:     "user",
+		RemoteAddr: "127.0.0.1",
+		Outcome:    "success",
+	}); err != nil {
+		t.Fatalf("failed to record audit event: %v", err)
+	}
+
+	events, err := query.ListAuditEvents(ctx, ListAuditEventsParams{
+		ActorName: "steve",
+		Since:     now.Add(-time.Hour),
+		Until:     now.Add(time.Hour),
+		Limit:     10,
+	})
+	if err != nil {
+		t.Fatalf("failed to list audit events: %v", err)
+	}
+	if len(events) != 1 || events[0].ActorID == nil || *events[0].ActorID != id {
+		t.Errorf("unexpected audit events: %+v", events)
+	}
+}
@@ -0,0 +1,50 @@
+-- name: FindSession :one
+SELECT *
+FROM sessions
+WHERE id = @id
+  AND expires_at > @now
+LIMIT 1;
+
+-- name: ListUserSessions :many
+SELECT *
+FROM sessions
+WHERE user_id = @user_id
+  AND expires_at > @now
+ORDER BY last_seen_at DESC;
+
+-- name: CreateSession :exec
+INSERT INTO sessions (id, user_id, created_at, last_seen_at, expires_at, user_agent, remote_addr)
+VALUES (@id, @user_id, @created_at, @last_seen_at, @expires_at, @user_agent, @remote_addr);
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = @last_seen_at,
+    expires_at = @expires_at,
+    remote_addr = @remote_addr
+WHERE id = @id;
+
+-- name: RemoveSession :execrows
+DELETE FROM sessions
+WHERE id = @id;
+
+-- name: RemoveUserSession :execrows
+DELETE FROM sessions
+WHERE id = @id
+  AND user_id = @user_id;
+
+-- name: RemoveUserSessions :execrows
+DELETE FROM sessions
+WHERE user_id = @user_id;
+
+-- name: RemoveOtherUserSessions :execrows
+DELETE FROM sessions
+WHERE user_id = @user_id
+  AND id <> @id;
+
+-- name: RemoveAllSessions :execrows
+DELETE FROM sessions
+WHERE id <> @id;
+
+-- name: RemoveExpiredSessions :execrows
+DELETE FROM sessions
+WHERE expires_at <= @now;
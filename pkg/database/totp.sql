@@ -0,0 +1,73 @@
+-- name: ListRolePolicies :many
+SELECT roles.id, roles.name, CAST(COALESCE(role_policies.require_totp, FALSE) AS BOOLEAN) AS require_totp
+FROM roles
+    LEFT JOIN role_policies ON role_policies.role_id = roles.id
+ORDER BY roles.id ASC;
+
+-- name: FindRoleRequiresTOTP :one
+SELECT CAST(EXISTS (
+    SELECT 1
+    FROM role_policies
+    WHERE role_id = @role_id
+      AND require_totp = TRUE
+) AS BOOLEAN);
+
+-- name: UpsertRolePolicy :exec
+INSERT INTO role_policies (role_id, require_totp)
+VALUES (@role_id, @require_totp)
+ON CONFLICT (role_id) DO UPDATE
+SET require_totp = excluded.require_totp;
+
+-- name: FindUserTOTP :one
+SELECT *
+FROM user_totp
+WHERE user_id = @user_id
+LIMIT 1;
+
+-- name: UpsertUserTOTP :exec
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES (@user_id, @secret, @created_at)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = excluded.secret,
+    confirmed_at = NULL,
+    last_used_step = 0,
+    created_at = excluded.created_at;
+
+-- name: ConfirmUserTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = @confirmed_at,
+    last_used_step = @last_used_step
+WHERE user_id = @user_id
+  AND confirmed_at IS NULL;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = @last_used_step
+WHERE user_id = @user_id
+  AND confirmed_at IS NOT NULL
+  AND last_used_step < @last_used_step;
+
+-- name: RemoveUserTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = @user_id;
+
+-- name: CountRecoveryCodes :one
+SELECT COUNT(*)
+FROM recovery_codes
+WHERE user_id = @user_id
+  AND used_at IS NULL;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (user_id, code_hash)
+VALUES (@user_id, @code_hash);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = @used_at
+WHERE user_id = @user_id
+  AND code_hash = @code_hash
+  AND used_at IS NULL;
+
+-- name: RemoveRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = @user_id;
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DeleteUser removes a user along with everything they own, in one
+// transaction.
+func DeleteUser(ctx context.Context, db *sql.DB, id int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := WithTx(db, tx)
+	if err = query.RemoveUnitGrantsByUser(ctx, id); err != nil {
+		return err
+	}
+	if _, err = query.RemoveUserSessions(ctx, id); err != nil {
+		return err
+	}
+	if err = query.RemoveNotificationPreferencesByUser(ctx, id); err != nil {
+		return err
+	}
+	if err = query.RemovePushSubscriptionsByUser(ctx, id); err != nil {
+		return err
+	}
+	if err = query.RemoveRecoveryCodes(ctx, id); err != nil {
+		return err
+	}
+	if err = query.RemoveUserTOTP(ctx, id); err != nil {
+		return err
+	}
+	if err = query.RemovePasskeysByUser(ctx, id); err != nil {
+		return err
+	}
+	if err = query.RemoveExternalAccountsByUser(ctx, id); err != nil {
+		return err
+	}
+	if err = query.RemoveAccessTokensByUser(ctx, id); err != nil {
+		return err
+	}
+	if err = query.RemoveUserAvatar(ctx, id); err != nil {
+		return err
+	}
+	if _, err = query.RemoveUser(ctx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -10,15 +10,28 @@ FROM users
 WHERE username = @username
 LIMIT 1;
 
+-- name: FindUserByEmail :one
+SELECT *
+FROM users
+WHERE email = @email
+  AND email_verified
+LIMIT 1;
+
+-- name: CountUsersByRole :one
+SELECT COUNT(*)
+FROM users
+WHERE role_id = @role_id;
+
+-- name: ListUsers :many
+SELECT *
+FROM users
+ORDER BY username ASC;
+
 -- name: CreateUser :one
 INSERT INTO users (username, password_hash, role_id)
 VALUES (@username, @password_hash, @role_id)
 RETURNING id;
 
--- name: UpsertUser :execrows
-REPLACE INTO users (id, username, password_hash, role_id)
-VALUES (@id, @username, @password_hash, @role_id);
-
 -- name: UpdateUser :execrows
 UPDATE users
 SET username = @username,
@@ -26,6 +39,57 @@ SET username = @username,
     role_id = @role_id
 WHERE id = @id;
 
+-- name: UpdateUserRole :execrows
+UPDATE users
+SET role_id = @role_id,
+    session_version = session_version + 1
+WHERE id = @id;
+
+-- name: UpdateUserPassword :execrows
+UPDATE users
+SET password_hash = @password_hash,
+    session_version = session_version + 1
+WHERE id = @id;
+
+-- name: ResetUserPassword :execrows
+UPDATE users
+SET password_hash = @password_hash,
+    session_version = session_version + 1
+WHERE id = @id
+  AND session_version = @session_version;
+
+-- name: UpdateUserEmail :execrows
+UPDATE users
+SET email = @email,
+    email_verified = FALSE
+WHERE id = @id;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users
+SET email_verified = TRUE
+WHERE id = @id
+  AND email = @email;
+
+-- name: UpdateUserProfile :execrows
+UPDATE users
+SET first_name = @first_name,
+    last_name = @last_name,
+    display_name = @display_name,
+    minecraft_username = @minecraft_username,
+    minecraft_uuid = @minecraft_uuid
+WHERE id = @id;
+
+-- name: UpdateUserAvatarSource :execrows
+UPDATE users
+SET avatar_source = @avatar_source
+WHERE id = @id;
+
+-- name: UpdateUserDisabled :execrows
+UPDATE users
+SET disabled = @disabled,
+    session_version = session_version + 1
+WHERE id = @id;
+
 -- name: RemoveUser :execrows
 DELETE FROM users
 WHERE id = @id;
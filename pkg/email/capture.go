@@ -0,0 +1,49 @@
+package email
+
+import (
+	"context"
+	"sync"
+)
+
+// CaptureClient is an in-memory Client which records messages instead of
+// delivering them. Setting Err makes every Send fail, to exercise delivery
+// failures.
+type CaptureClient struct {
+	Err error
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send implements Client.
+func (c *CaptureClient) Send(_ context.Context, msg *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Err != nil {
+		return c.Err
+	}
+
+	c.messages = append(c.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of the messages sent so far.
+func (c *CaptureClient) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Message(nil), c.messages...)
+}
+
+// Reset discards the captured messages.
+func (c *CaptureClient) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages = nil
+}
+
+func NewCaptureClient() *CaptureClient {
+	return new(CaptureClient)
+}
@@ -1,18 +1,44 @@
 package email
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.uber.org/config"
+)
+
+const (
+	ProviderMailchimp Provider = "mailchimp"
+	ProviderSendGrid  Provider = "sendgrid"
+	ProviderMailgun   Provider = "mailgun"
+	ProviderSMTP      Provider = "smtp"
+	ProviderLog       Provider = "log"
+)
 
 type (
+	Provider string
+
 	Address struct {
-		Name  string
-		Email string
+		Name  string `json:"name,omitempty"`
+		Email string `json:"email"`
+	}
+
+	Attachment struct {
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+		Data        []byte `json:"data"`
 	}
 
 	Message struct {
-		To      Address
-		Subject string
-		Text    string
-		HTML    string
+		To          []Address    `json:"to"`
+		Cc          []Address    `json:"cc,omitempty"`
+		Bcc         []Address    `json:"bcc,omitempty"`
+		ReplyTo     *Address     `json:"reply_to,omitempty"`
+		Subject     string       `json:"subject"`
+		Text        string       `json:"text"`
+		HTML        string       `json:"html,omitempty"`
+		Attachments []Attachment `json:"attachments,omitempty"`
 	}
 
 	ClientOptions[T any] struct {
@@ -20,7 +46,61 @@ type (
 		Transport T
 	}
 
+	// Options selects the email provider at startup. Only the transport of
+	// the selected provider needs to be configured.
+	Options struct {
+		Provider  Provider           `yaml:"provider"`
+		From      Address            `yaml:"from"`
+		Mailchimp MailchimpTransport `yaml:"mailchimp"`
+		SendGrid  SendGridTransport  `yaml:"sendgrid"`
+		Mailgun   MailgunTransport   `yaml:"mailgun"`
+		SMTP      SMTPTransport      `yaml:"smtp"`
+		Outbox    OutboxOptions      `yaml:"outbox"`
+	}
+
 	Client interface {
 		Send(context.Context, *Message) error
 	}
 )
+
+// Recipients returns every address the message is delivered to, including
+// blind copies.
+func (msg *Message) Recipients() []Address {
+	recipients := make([]Address, 0, len(msg.To)+len(msg.Cc)+len(msg.Bcc))
+	recipients = append(recipients, msg.To...)
+	recipients = append(recipients, msg.Cc...)
+	recipients = append(recipients, msg.Bcc...)
+
+	return recipients
+}
+
+func Configure(provider config.Provider) (*Options, error) {
+	opts := new(Options)
+	if err := provider.Get("email").Populate(opts); err != nil {
+		return nil, fmt.Errorf("failed to configure email options: %w", err)
+	}
+
+	if opts.Provider == "" {
+		opts.Provider = ProviderLog
+	}
+
+	return opts, nil
+}
+
+// New creates the client for the configured provider.
+func New(opts *Options, logger *slog.Logger) (Client, error) {
+	switch opts.Provider {
+	case ProviderMailchimp:
+		return NewMailchimpClient(&ClientOptions[MailchimpTransport]{opts.From, opts.Mailchimp}), nil
+	case ProviderSendGrid:
+		return NewSendGridClient(&ClientOptions[SendGridTransport]{opts.From, opts.SendGrid}), nil
+	case ProviderMailgun:
+		return NewMailgunClient(&ClientOptions[MailgunTransport]{opts.From, opts.Mailgun}), nil
+	case ProviderSMTP:
+		return NewSMTPClient(&ClientOptions[SMTPTransport]{opts.From, opts.SMTP}), nil
+	case ProviderLog:
+		return NewLogClient(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown email provider %q", opts.Provider)
+	}
+}
@@ -0,0 +1,38 @@
+package email
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bdreece/herobrian/pkg/health"
+)
+
+func NewHealthCheck(opts *Options) health.Check {
+	return health.NewCheck("email", func(context.Context) error {
+		var errs []error
+		if opts.Provider != ProviderLog && opts.From.Email == "" {
+			errs = append(errs, errors.New("missing sender email address"))
+		}
+
+		switch opts.Provider {
+		case ProviderMailchimp:
+			if opts.Mailchimp.APIKey == "" {
+				errs = append(errs, errors.New("missing mailchimp api key"))
+			}
+		case ProviderSendGrid:
+			if opts.SendGrid.APIKey == "" {
+				errs = append(errs, errors.New("missing sendgrid api key"))
+			}
+		case ProviderMailgun:
+			if opts.Mailgun.Domain == "" || opts.Mailgun.APIKey == "" {
+				errs = append(errs, errors.New("missing mailgun domain or api key"))
+			}
+		case ProviderSMTP:
+			if opts.SMTP.Host == "" {
+				errs = append(errs, errors.New("missing smtp host"))
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
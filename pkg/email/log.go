@@ -0,0 +1,31 @@
+package email
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogClient writes messages to the logger instead of delivering them, for
+// development and installations without a mail provider.
+type LogClient struct {
+	logger *slog.Logger
+}
+
+// Send implements Client.
+func (client *LogClient) Send(ctx context.Context, msg *Message) error {
+	client.logger.InfoContext(ctx, "email",
+		slog.String("to", formatAddresses(msg.To)),
+		slog.String("subject", msg.Subject),
+		slog.Int("attachments", len(msg.Attachments)),
+		slog.String("text", msg.Text))
+
+	return nil
+}
+
+func NewLogClient(logger *slog.Logger) *LogClient {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &LogClient{logger}
+}
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"net/http"
 
-	"go.uber.org/config"
 	"go.uber.org/multierr"
 )
 
@@ -31,16 +30,24 @@ type (
 		RejectReason string `json:"reject_reason"`
 	}
 	mailchimpMessage struct {
-		HTML      string               `json:"html"`
-		Text      string               `json:"text"`
-		Subject   string               `json:"subject"`
-		FromName  string               `json:"from_name"`
-		FromEmail string               `json:"from_email"`
-		To        []mailchimpRecipient `json:"to"`
+		HTML        string                `json:"html"`
+		Text        string                `json:"text"`
+		Subject     string                `json:"subject"`
+		FromName    string                `json:"from_name"`
+		FromEmail   string                `json:"from_email"`
+		To          []mailchimpRecipient  `json:"to"`
+		Headers     map[string]string     `json:"headers,omitempty"`
+		Attachments []mailchimpAttachment `json:"attachments,omitempty"`
 	}
 	mailchimpRecipient struct {
 		Name  string `json:"name"`
 		Email string `json:"email"`
+		Type  string `json:"type"`
+	}
+	mailchimpAttachment struct {
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Content []byte `json:"content"`
 	}
 )
 
@@ -56,12 +63,33 @@ func (client *MailchimpClient) Send(ctx context.Context, msg *Message) (err erro
 			Subject:   msg.Subject,
 			HTML:      msg.HTML,
 			Text:      msg.Text,
-			To: []mailchimpRecipient{
-				{Name: msg.To.Name, Email: msg.To.Email},
-			},
 		},
 	}
 
+	for _, r := range []struct {
+		kind  string
+		addrs []Address
+	}{{"to", msg.To}, {"cc", msg.Cc}, {"bcc", msg.Bcc}} {
+		for _, addr := range r.addrs {
+			reqBody.Message.To = append(reqBody.Message.To, mailchimpRecipient{
+				Name:  addr.Name,
+				Email: addr.Email,
+				Type:  r.kind,
+			})
+		}
+	}
+	if msg.ReplyTo != nil {
+		reqBody.Message.Headers = map[string]string{"Reply-To": formatAddress(*msg.ReplyTo)}
+	}
+	for _, a := range msg.Attachments {
+		// content is base64 encoded by encoding/json
+		reqBody.Message.Attachments = append(reqBody.Message.Attachments, mailchimpAttachment{
+			Type:    a.ContentType,
+			Name:    a.Filename,
+			Content: a.Data,
+		})
+	}
+
 	if err = json.NewEncoder(&buf).Encode(&reqBody); err != nil {
 		return
 	}
@@ -77,26 +105,24 @@ func (client *MailchimpClient) Send(ctx context.Context, msg *Message) (err erro
 	}
 
 	defer multierr.AppendInvoke(&err, multierr.Close(res.Body))
-	resBody := new(mailchimpResponse)
-	if err = json.NewDecoder(res.Body).Decode(resBody); err != nil {
+	if res.StatusCode >= 400 {
+		err = fmt.Errorf("received invalid status code: %d", res.StatusCode)
 		return
 	}
 
-	if resBody.Status != "sent" {
-		err = fmt.Errorf("received invalid status %q: %q", resBody.Status, resBody.RejectReason)
+	// the response holds one status per recipient
+	var resBody []mailchimpResponse
+	if err = json.NewDecoder(res.Body).Decode(&resBody); err != nil {
 		return
 	}
 
-	return
-}
-
-func ConfigureMailchimp(provider config.Provider) (*ClientOptions[MailchimpTransport], error) {
-	opts := new(ClientOptions[MailchimpTransport])
-	if err := provider.Get("email.mailchimp").Populate(opts); err != nil {
-		return nil, fmt.Errorf("failed to configure mailchimp options: %w", err)
+	for _, r := range resBody {
+		if r.Status != "sent" && r.Status != "queued" {
+			err = multierr.Append(err, fmt.Errorf("received invalid status %q for %s: %q", r.Status, r.Email, r.RejectReason))
+		}
 	}
 
-	return opts, nil
+	return
 }
 
 func NewMailchimpClient(opts *ClientOptions[MailchimpTransport]) *MailchimpClient {
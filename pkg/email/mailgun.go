@@ -1,6 +1,13 @@
 package email
 
-import "github.com/mailgun/mailgun-go"
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/mailgun/mailgun-go"
+)
 
 type (
 	MailgunTransport struct {
@@ -14,9 +21,58 @@ type (
 	}
 )
 
+// Send implements Client. The mailgun API client does not accept a context,
+// so cancellation is only observed before the request is made.
+func (client *MailgunClient) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m := client.NewMessage(formatAddress(client.opts.From), msg.Subject, msg.Text)
+	for _, to := range msg.To {
+		if err := m.AddRecipient(formatAddress(to)); err != nil {
+			return err
+		}
+	}
+	for _, cc := range msg.Cc {
+		m.AddCC(formatAddress(cc))
+	}
+	for _, bcc := range msg.Bcc {
+		m.AddBCC(formatAddress(bcc))
+	}
+	if msg.ReplyTo != nil {
+		m.SetReplyTo(formatAddress(*msg.ReplyTo))
+	}
+	if msg.HTML != "" {
+		m.SetHtml(msg.HTML)
+	}
+	for _, a := range msg.Attachments {
+		m.AddBufferAttachment(a.Filename, a.Data)
+	}
+
+	if _, _, err := client.Mailgun.Send(m); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
 func NewMailgunClient(opts *ClientOptions[MailgunTransport]) *MailgunClient {
 	return &MailgunClient{
 		Mailgun: mailgun.NewMailgun(opts.Transport.Domain, opts.Transport.APIKey),
 		opts:    opts,
 	}
 }
+
+func formatAddress(addr Address) string {
+	return (&mail.Address{Name: addr.Name, Address: addr.Email}).String()
+}
+
+func formatAddresses(addrs []Address) string {
+	formatted := make([]string, len(addrs))
+	for i, addr := range addrs {
+		formatted[i] = formatAddress(addr)
+	}
+
+	return strings.Join(formatted, ", ")
+}
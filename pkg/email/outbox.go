@@ -0,0 +1,288 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/worker"
+	"go.uber.org/fx"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+const (
+	outboxBatchSize   = 20
+	outboxSendTimeout = 30 * time.Second
+)
+
+var (
+	ErrNoRecipients          = errors.New("message has no recipients")
+	ErrOutboxMessageNotFound = errors.New("outbox message not found or already sent")
+)
+
+var DefaultOutboxOptions = OutboxOptions{
+	Interval:       10 * time.Second,
+	MaxAttempts:    8,
+	InitialBackoff: 30 * time.Second,
+	MaxBackoff:     time.Hour,
+	Retention:      7 * 24 * time.Hour,
+}
+
+type (
+	// OutboxOptions controls delivery of queued messages. A message is
+	// dead-lettered after MaxAttempts failed deliveries, and sent messages
+	// are deleted after Retention.
+	OutboxOptions struct {
+		Interval       time.Duration `yaml:"interval"`
+		MaxAttempts    int64         `yaml:"max_attempts"`
+		InitialBackoff time.Duration `yaml:"initial_backoff"`
+		MaxBackoff     time.Duration `yaml:"max_backoff"`
+		Retention      time.Duration `yaml:"retention"`
+	}
+
+	// Outbox is a Client which queues messages in the database, so that
+	// callers are not failed by provider outages. Its worker delivers them
+	// through the configured transport.
+	Outbox struct {
+		worker.Supervisor
+
+		db        database.Querier
+		transport Client
+		opts      OutboxOptions
+		logger    *slog.Logger
+		wake      chan struct{}
+	}
+
+	OutboxParams struct {
+		fx.In
+
+		Querier   database.Querier
+		Transport Client `name:"email_transport"`
+		Options   *Options
+		Registry  *worker.Registry
+		Logger    *slog.Logger
+	}
+)
+
+// Send implements Client by queueing the message for delivery.
+func (o *Outbox) Send(ctx context.Context, msg *Message) error {
+	_, err := o.Enqueue(ctx, msg)
+	return err
+}
+
+// Enqueue queues the message for delivery, returning its ID so the caller
+// can follow its status.
+func (o *Outbox) Enqueue(ctx context.Context, msg *Message) (int64, error) {
+	recipients := msg.Recipients()
+	if len(recipients) == 0 {
+		return 0, ErrNoRecipients
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	id, err := o.db.CreateOutboxMessage(ctx, database.CreateOutboxMessageParams{
+		Recipients: formatAddresses(recipients),
+		Subject:    msg.Subject,
+		Message:    string(data),
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue message: %w", err)
+	}
+
+	o.notify()
+	return id, nil
+}
+
+func (o *Outbox) List(ctx context.Context, status string, limit int64) ([]database.ListOutboxMessagesRow, error) {
+	return o.db.ListOutboxMessages(ctx, database.ListOutboxMessagesParams{
+		Status: status,
+		Limit:  limit,
+	})
+}
+
+// Retry queues a failed or dead-lettered message for immediate delivery,
+// resetting its attempts.
+func (o *Outbox) Retry(ctx context.Context, id int64) error {
+	n, err := o.db.RetryOutboxMessage(ctx, database.RetryOutboxMessageParams{
+		Now: time.Now().UTC(),
+		ID:  id,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to retry message: %w", err)
+	}
+
+	if n == 0 {
+		return ErrOutboxMessageNotFound
+	}
+
+	o.notify()
+	return nil
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) run(ctx context.Context) error {
+	ticker := time.NewTicker(o.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := o.flush(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// flush delivers every message which is due, returning only database
+// errors. Delivery failures are recorded against the message.
+func (o *Outbox) flush(ctx context.Context) error {
+	now := time.Now().UTC()
+	before := now.Add(-o.opts.Retention)
+	if _, err := o.db.RemoveSentOutboxMessages(ctx, &before); err != nil {
+		return fmt.Errorf("failed to remove sent messages: %w", err)
+	}
+
+	for {
+		due, err := o.db.ListDueOutboxMessages(ctx, database.ListDueOutboxMessagesParams{
+			Now:   now,
+			Limit: outboxBatchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list queued messages: %w", err)
+		}
+
+		for _, m := range due {
+			if err = o.deliver(ctx, &m); err != nil {
+				return err
+			}
+		}
+
+		if len(due) < outboxBatchSize {
+			return nil
+		}
+	}
+}
+
+func (o *Outbox) deliver(ctx context.Context, m *database.EmailOutbox) error {
+	msg := new(Message)
+	err := json.Unmarshal([]byte(m.Message), msg)
+	if err == nil {
+		sendCtx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+		err = o.transport.Send(sendCtx, msg)
+		cancel()
+	}
+
+	now := time.Now().UTC()
+	if err == nil {
+		return o.db.MarkOutboxMessageSent(ctx, database.MarkOutboxMessageSentParams{
+			SentAt: &now,
+			ID:     m.ID,
+		})
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	attempts := m.Attempts + 1
+	status := OutboxStatusPending
+	if attempts >= o.opts.MaxAttempts {
+		status = OutboxStatusDead
+	}
+
+	reason := err.Error()
+	if status == OutboxStatusDead {
+		o.logger.Error("email delivery failed, giving up",
+			slog.Int64("id", m.ID),
+			slog.Int64("attempts", attempts),
+			slog.String("error", reason))
+	} else {
+		o.logger.Warn("email delivery failed, retrying",
+			slog.Int64("id", m.ID),
+			slog.Int64("attempts", attempts),
+			slog.String("error", reason))
+	}
+
+	return o.db.MarkOutboxMessageFailed(ctx, database.MarkOutboxMessageFailedParams{
+		Status:        status,
+		LastError:     &reason,
+		NextAttemptAt: now.Add(o.backoff(attempts)),
+		ID:            m.ID,
+	})
+}
+
+// backoff doubles the delay after each failed attempt, up to the maximum.
+func (o *Outbox) backoff(attempts int64) time.Duration {
+	d := o.opts.InitialBackoff
+	for i := int64(1); i < attempts && d < o.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, o.opts.MaxBackoff)
+}
+
+func NewOutbox(p OutboxParams) *Outbox {
+	opts := p.Options.Outbox
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultOutboxOptions.Interval
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultOutboxOptions.MaxAttempts
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = DefaultOutboxOptions.InitialBackoff
+	}
+	if opts.MaxBackoff < opts.InitialBackoff {
+		opts.MaxBackoff = max(DefaultOutboxOptions.MaxBackoff, opts.InitialBackoff)
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultOutboxOptions.Retention
+	}
+
+	logger := p.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	o := &Outbox{
+		db:        p.Querier,
+		transport: p.Transport,
+		opts:      opts,
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+	}
+
+	o.Supervisor = worker.NewSupervisor(worker.SupervisorParams{
+		Name:   "email",
+		Policy: worker.DefaultRestartPolicy,
+		Logger: logger,
+		Run:    o.run,
+	})
+	p.Registry.Register(o.Supervisor)
+
+	return o
+}
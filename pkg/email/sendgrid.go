@@ -2,20 +2,16 @@ package email
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
-	"go.uber.org/config"
 )
 
 type (
-	SendGridOptions struct {
+	SendGridTransport struct {
 		APIKey string `yaml:"api_key"`
-		From   struct {
-			Name  string `yaml:"name"`
-			Email string `yaml:"email"`
-		} `yaml:"from"`
 	}
 
 	SendGridClient struct {
@@ -25,8 +21,35 @@ type (
 )
 
 func (c *SendGridClient) Send(ctx context.Context, msg *Message) error {
-	to := mail.NewEmail(msg.To.Name, msg.To.Email)
-	mailMsg := mail.NewSingleEmail(c.from, msg.Subject, to, msg.Text, msg.HTML)
+	p := mail.NewPersonalization()
+	for _, to := range msg.To {
+		p.AddTos(mail.NewEmail(to.Name, to.Email))
+	}
+	for _, cc := range msg.Cc {
+		p.AddCCs(mail.NewEmail(cc.Name, cc.Email))
+	}
+	for _, bcc := range msg.Bcc {
+		p.AddBCCs(mail.NewEmail(bcc.Name, bcc.Email))
+	}
+
+	mailMsg := mail.NewV3Mail().
+		SetFrom(c.from).
+		AddPersonalizations(p).
+		AddContent(mail.NewContent("text/plain", msg.Text))
+	mailMsg.Subject = msg.Subject
+	if msg.HTML != "" {
+		mailMsg.AddContent(mail.NewContent("text/html", msg.HTML))
+	}
+	if msg.ReplyTo != nil {
+		mailMsg.SetReplyTo(mail.NewEmail(msg.ReplyTo.Name, msg.ReplyTo.Email))
+	}
+	for _, a := range msg.Attachments {
+		mailMsg.AddAttachment(mail.NewAttachment().
+			SetFilename(a.Filename).
+			SetType(a.ContentType).
+			SetContent(base64.StdEncoding.EncodeToString(a.Data)))
+	}
+
 	res, err := c.Client.SendWithContext(ctx, mailMsg)
 	if err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
@@ -39,18 +62,9 @@ func (c *SendGridClient) Send(ctx context.Context, msg *Message) error {
 	return nil
 }
 
-func ConfigureSendGrid(provider config.Provider) (*SendGridOptions, error) {
-	opts := new(SendGridOptions)
-	if err := provider.Get("sendgrid").Populate(opts); err != nil {
-		return nil, fmt.Errorf("failed to configure sendgrid options: %w", err)
-	}
-
-	return opts, nil
-}
-
-func NewSendGridClient(opts *SendGridOptions) *SendGridClient {
+func NewSendGridClient(opts *ClientOptions[SendGridTransport]) *SendGridClient {
 	return &SendGridClient{
-		Client: sendgrid.NewSendClient(opts.APIKey),
+		Client: sendgrid.NewSendClient(opts.Transport.APIKey),
 		from:   mail.NewEmail(opts.From.Name, opts.From.Email),
 	}
 }
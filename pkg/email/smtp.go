@@ -0,0 +1,340 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SMTPSecurityStartTLS upgrades a plain connection with STARTTLS, and
+	// fails if the server does not offer it.
+	SMTPSecurityStartTLS SMTPSecurity = "starttls"
+	// SMTPSecurityTLS connects over implicit TLS, usually on port 465.
+	SMTPSecurityTLS SMTPSecurity = "tls"
+	// SMTPSecurityNone sends in plain text. Authentication is refused
+	// unless the server is on localhost.
+	SMTPSecurityNone SMTPSecurity = "none"
+)
+
+var ErrSTARTTLSUnsupported = errors.New("smtp server does not support STARTTLS")
+
+type (
+	SMTPSecurity string
+
+	SMTPTransport struct {
+		Host     string       `yaml:"host"`
+		Port     int          `yaml:"port"`
+		Username string       `yaml:"username"`
+		Password string       `yaml:"password"`
+		Security SMTPSecurity `yaml:"security"`
+		// TLSConfig is used for STARTTLS and implicit TLS, defaulting to
+		// verifying the server against Host.
+		TLSConfig *tls.Config `yaml:"-"`
+	}
+
+	SMTPClient struct {
+		opts *ClientOptions[SMTPTransport]
+	}
+)
+
+// Send implements Client.
+func (client *SMTPClient) Send(ctx context.Context, msg *Message) error {
+	body, err := client.compose(msg)
+	if err != nil {
+		return fmt.Errorf("failed to compose email: %w", err)
+	}
+
+	c, err := client.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+
+	if err = client.transmit(c, msg.Recipients(), body); err != nil {
+		return errors.Join(fmt.Errorf("failed to send email: %w", err), c.Close())
+	}
+
+	return c.Quit()
+}
+
+func (client *SMTPClient) transmit(c *smtp.Client, recipients []Address, body []byte) error {
+	if err := c.Mail(client.opts.From.Email); err != nil {
+		return err
+	}
+	for _, to := range recipients {
+		if err := c.Rcpt(to.Email); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// dial connects, negotiates TLS and authenticates. The context deadline
+// bounds the whole conversation.
+func (client *SMTPClient) dial(ctx context.Context) (*smtp.Client, error) {
+	t := client.opts.Transport
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if t.Security == SMTPSecurityTLS {
+		conn = tls.Client(conn, client.tlsConfig())
+	}
+
+	c, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err = client.handshake(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (client *SMTPClient) handshake(c *smtp.Client) error {
+	t := client.opts.Transport
+	if t.Security == SMTPSecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrSTARTTLSUnsupported
+		}
+		if err := c.StartTLS(client.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if t.Username != "" {
+		auth := smtp.PlainAuth("", t.Username, t.Password, t.Host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (client *SMTPClient) tlsConfig() *tls.Config {
+	if cfg := client.opts.Transport.TLSConfig; cfg != nil {
+		return cfg
+	}
+
+	return &tls.Config{ServerName: client.opts.Transport.Host}
+}
+
+// compose renders the message as MIME. The text and HTML bodies are sent as
+// multipart/alternative, wrapped in multipart/mixed when there are
+// attachments. Blind copies are left out of the header.
+func (client *SMTPClient) compose(msg *Message) ([]byte, error) {
+	id, err := messageID(client.opts.From.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	header := [][2]string{
+		{"From", formatAddress(client.opts.From)},
+		{"To", formatAddresses(msg.To)},
+	}
+	if len(msg.Cc) > 0 {
+		header = append(header, [2]string{"Cc", formatAddresses(msg.Cc)})
+	}
+	if msg.ReplyTo != nil {
+		header = append(header, [2]string{"Reply-To", formatAddress(*msg.ReplyTo)})
+	}
+	header = append(header,
+		[2]string{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		[2]string{"Date", time.Now().Format(time.RFC1123Z)},
+		[2]string{"Message-ID", id},
+		[2]string{"MIME-Version", "1.0"},
+	)
+
+	contentHeader, content, err := composeContent(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if len(msg.Attachments) == 0 {
+		writeHeader(&buf, append(header, contentHeader...))
+		buf.Write(content)
+
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	writeHeader(&buf, append(header,
+		[2]string{"Content-Type", "multipart/mixed; boundary=" + mw.Boundary()},
+	))
+
+	w, err := mw.CreatePart(toMIMEHeader(contentHeader))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(content); err != nil {
+		return nil, err
+	}
+
+	for _, a := range msg.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeBase64(w, a.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// composeContent renders the message body, as a single text part when there
+// is no HTML.
+func composeContent(msg *Message) ([][2]string, []byte, error) {
+	var buf bytes.Buffer
+	if msg.HTML == "" {
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, nil, err
+		}
+
+		return [][2]string{
+			{"Content-Type", "text/plain; charset=utf-8"},
+			{"Content-Transfer-Encoding", "quoted-printable"},
+		}, buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = writeQuotedPrintable(w, part.body); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return [][2]string{
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	}, buf.Bytes(), nil
+}
+
+func NewSMTPClient(opts *ClientOptions[SMTPTransport]) *SMTPClient {
+	if opts.Transport.Port == 0 {
+		opts.Transport.Port = 587
+	}
+	if opts.Transport.Security == "" {
+		opts.Transport.Security = SMTPSecurityStartTLS
+	}
+
+	return &SMTPClient{opts}
+}
+
+func writeHeader(buf *bytes.Buffer, header [][2]string) {
+	for _, field := range header {
+		fmt.Fprintf(buf, "%s: %s\r\n", field[0], field[1])
+	}
+	buf.WriteString("\r\n")
+}
+
+func toMIMEHeader(header [][2]string) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader, len(header))
+	for _, field := range header {
+		h.Add(field[0], field[1])
+	}
+
+	return h
+}
+
+// writeBase64 encodes data in lines of 76 characters, as required by MIME.
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(body)); err != nil {
+		return err
+	}
+
+	return qw.Close()
+}
+
+func messageID(from string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if i := strings.LastIndexByte(from, '@'); i >= 0 {
+		domain = from[i+1:]
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
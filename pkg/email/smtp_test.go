@@ -0,0 +1,449 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type (
+	// smtpStub is an SMTP server which accepts one username and password
+	// and records the messages it is sent. STARTTLS is offered when it has
+	// a certificate.
+	smtpStub struct {
+		listener net.Listener
+		tls      *tls.Config
+		username string
+		password string
+		// reject fails RCPT for these addresses with a permanent error.
+		reject map[string]bool
+
+		mu       sync.Mutex
+		messages []smtpMessage
+		commands []string
+	}
+
+	smtpMessage struct {
+		from       string
+		recipients []string
+		data       []byte
+		tls        bool
+		authed     bool
+	}
+)
+
+func newSMTPStub(t *testing.T, tlsConfig *tls.Config) *smtpStub {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &smtpStub{
+		listener: l,
+		tls:      tlsConfig,
+		username: "herobrian",
+		password: "hunter2",
+		reject:   make(map[string]bool),
+	}
+	go s.serve()
+
+	return s
+}
+
+func (s *smtpStub) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStub) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 stub ESMTP")
+
+	var (
+		msg    smtpMessage
+		secure bool
+		authed bool
+	)
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			lines := []string{"stub"}
+			if s.tls != nil && !secure {
+				lines = append(lines, "STARTTLS")
+			}
+			lines = append(lines, "AUTH PLAIN")
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				_ = tp.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			if s.tls == nil || secure {
+				_ = tp.PrintfLine("502 not supported")
+				continue
+			}
+			_ = tp.PrintfLine("220 go ahead")
+
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, tp, secure = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(decoded), "\x00")
+			if mechanism != "PLAIN" || err != nil || len(parts) != 3 || parts[1] != s.username || parts[2] != s.password {
+				_ = tp.PrintfLine("535 authentication failed")
+				continue
+			}
+			authed = true
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			msg = smtpMessage{from: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>"), tls: secure, authed: authed}
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if s.reject[to] {
+				_ = tp.PrintfLine("550 5.1.1 mailbox unavailable")
+				continue
+			}
+			msg.recipients = append(msg.recipients, to)
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = data
+
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			_ = tp.PrintfLine("250 queued")
+		case "RSET", "NOOP":
+			_ = tp.PrintfLine("250 ok")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("500 unknown command")
+		}
+	}
+}
+
+func (s *smtpStub) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+// selfSigned returns a server config for 127.0.0.1 and a client config
+// trusting it.
+func selfSigned(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtp stub"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+}
+
+func newTestSMTPClient(s *smtpStub, transport SMTPTransport) *SMTPClient {
+	transport.Host = "127.0.0.1"
+	transport.Port = s.port()
+
+	return NewSMTPClient(&ClientOptions[SMTPTransport]{
+		From:      Address{Name: "herobrian", Email: "herobrian@example.com"},
+		Transport: transport,
+	})
+}
+
+func testMessage() *Message {
+	return &Message{
+		To:      []Address{{Name: "Steve", Email: "steve@example.com"}},
+		Cc:      []Address{{Email: "alex@example.com"}},
+		Bcc:     []Address{{Email: "audit@example.com"}},
+		Subject: "Server restarted ✓",
+		Text:    "The server was restarted.",
+		HTML:    "<p>The server was <strong>restarted</strong>.</p>",
+	}
+}
+
+func sendTimeout(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+func TestSMTPStartTLSAuth(t *testing.T) {
+	serverTLS, clientTLS := selfSigned(t)
+	stub := newSMTPStub(t, serverTLS)
+	client := newTestSMTPClient(stub, SMTPTransport{
+		Username:  "herobrian",
+		Password:  "hunter2",
+		Security:  SMTPSecurityStartTLS,
+		TLSConfig: clientTLS,
+	})
+
+	if err := client.Send(sendTimeout(t), testMessage()); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	received := stub.received()
+	if len(received) != 1 {
+		t.Fatalf("received %d messages, want 1", len(received))
+	}
+
+	msg := received[0]
+	if !msg.tls || !msg.authed {
+		t.Errorf("message was sent with tls %v and auth %v", msg.tls, msg.authed)
+	}
+	if msg.from != "herobrian@example.com" {
+		t.Errorf("MAIL FROM is %q", msg.from)
+	}
+	if got := strings.Join(msg.recipients, ","); got != "steve@example.com,alex@example.com,audit@example.com" {
+		t.Errorf("recipients are %q", got)
+	}
+
+	stub.mu.Lock()
+	commands := strings.Join(stub.commands, "\n")
+	stub.mu.Unlock()
+	if strings.Index(commands, "STARTTLS") > strings.Index(commands, "AUTH") {
+		t.Errorf("authenticated before STARTTLS:\n%s", commands)
+	}
+}
+
+func TestSMTPMultipartBody(t *testing.T) {
+	stub := newSMTPStub(t, nil)
+	client := newTestSMTPClient(stub, SMTPTransport{Security: SMTPSecurityNone})
+
+	in := testMessage()
+	in.Attachments = []Attachment{{Filename: "latest.log", ContentType: "text/plain", Data: bytes.Repeat([]byte("[Server thread/INFO] Done\n"), 10)}}
+	if err := client.Send(sendTimeout(t), in); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	received := stub.received()
+	if len(received) != 1 {
+		t.Fatalf("received %d messages, want 1", len(received))
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(received[0].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != in.Subject {
+		t.Errorf("subject is %q, %v", subject, err)
+	}
+	if to := msg.Header.Get("To"); !strings.Contains(to, "steve@example.com") {
+		t.Errorf("To is %q", to)
+	}
+	if cc := msg.Header.Get("Cc"); cc != "<alex@example.com>" && cc != "alex@example.com" {
+		t.Errorf("Cc is %q", cc)
+	}
+	if _, ok := msg.Header["Bcc"]; ok || bytes.Contains(received[0].data, []byte("audit@example.com")) {
+		t.Error("blind copy is visible in the message")
+	}
+	if msg.Header.Get("Message-Id") == "" || msg.Header.Get("Date") == "" {
+		t.Error("message is missing its Message-ID or Date")
+	}
+
+	mixed := readParts(t, msg.Header.Get("Content-Type"), msg.Body, "multipart/mixed")
+	if len(mixed) != 2 {
+		t.Fatalf("multipart/mixed has %d parts, want 2", len(mixed))
+	}
+
+	alternative := readParts(t, mixed[0].header.Get("Content-Type"), bytes.NewReader(mixed[0].body), "multipart/alternative")
+	if len(alternative) != 2 {
+		t.Fatalf("multipart/alternative has %d parts, want 2", len(alternative))
+	}
+	for i, want := range []struct{ contentType, body string }{
+		{"text/plain", in.Text},
+		{"text/html", in.HTML},
+	} {
+		mediaType, _, _ := mime.ParseMediaType(alternative[i].header.Get("Content-Type"))
+		if mediaType != want.contentType || string(alternative[i].body) != want.body {
+			t.Errorf("part %d is %s %q, want %s %q", i, mediaType, alternative[i].body, want.contentType, want.body)
+		}
+	}
+
+	attachment := mixed[1]
+	if _, params, _ := mime.ParseMediaType(attachment.header.Get("Content-Disposition")); params["filename"] != "latest.log" {
+		t.Errorf("attachment disposition is %q", attachment.header.Get("Content-Disposition"))
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(attachment.body), "\r\n", ""))
+	if err != nil || !bytes.Equal(data, in.Attachments[0].Data) {
+		t.Errorf("attachment is %q, %v", data, err)
+	}
+}
+
+func TestSMTPErrors(t *testing.T) {
+	serverTLS, clientTLS := selfSigned(t)
+
+	t.Run("rejected recipient", func(t *testing.T) {
+		stub := newSMTPStub(t, nil)
+		stub.reject["alex@example.com"] = true
+		client := newTestSMTPClient(stub, SMTPTransport{Security: SMTPSecurityNone})
+
+		err := client.Send(sendTimeout(t), testMessage())
+		var protoErr *textproto.Error
+		if !errors.As(err, &protoErr) || protoErr.Code != 550 {
+			t.Errorf("got %v, want a 550 error", err)
+		}
+		if len(stub.received()) != 0 {
+			t.Error("message was delivered")
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		stub := newSMTPStub(t, serverTLS)
+		client := newTestSMTPClient(stub, SMTPTransport{
+			Username:  "herobrian",
+			Password:  "wrong",
+			Security:  SMTPSecurityStartTLS,
+			TLSConfig: clientTLS,
+		})
+
+		err := client.Send(sendTimeout(t), testMessage())
+		var protoErr *textproto.Error
+		if !errors.As(err, &protoErr) || protoErr.Code != 535 {
+			t.Errorf("got %v, want a 535 error", err)
+		}
+	})
+
+	t.Run("STARTTLS not offered", func(t *testing.T) {
+		stub := newSMTPStub(t, nil)
+		client := newTestSMTPClient(stub, SMTPTransport{
+			Username:  "herobrian",
+			Password:  "hunter2",
+			Security:  SMTPSecurityStartTLS,
+			TLSConfig: clientTLS,
+		})
+
+		if err := client.Send(sendTimeout(t), testMessage()); !errors.Is(err, ErrSTARTTLSUnsupported) {
+			t.Errorf("got %v, want ErrSTARTTLSUnsupported", err)
+		}
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		stub := newSMTPStub(t, serverTLS)
+		client := newTestSMTPClient(stub, SMTPTransport{Security: SMTPSecurityStartTLS})
+
+		if err := client.Send(sendTimeout(t), testMessage()); err == nil {
+			t.Error("sent to a server with an untrusted certificate")
+		}
+		if len(stub.received()) != 0 {
+			t.Error("message was delivered")
+		}
+	})
+}
+
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// readParts reads a multipart body of the given type. Quoted-printable
+// parts are decoded by the reader.
+func readParts(t *testing.T, contentType string, body io.Reader, want string) []mimePart {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != want {
+		t.Fatalf("content type is %q, want %s", contentType, want)
+	}
+
+	var parts []mimePart
+	mr := multipart.NewReader(bufio.NewReader(body), params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return parts
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, mimePart{p.Header, data})
+	}
+}
@@ -0,0 +1,50 @@
+package email
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates renders messages from pairs of "<name>.html.gotmpl" and
+// "<name>.txt.gotmpl" templates. The text template must also define a
+// "subject" template.
+type Templates struct {
+	fsys fs.FS
+}
+
+func (t *Templates) Render(name string, to Address, data any) (*Message, error) {
+	html, err := htmltemplate.ParseFS(t.fsys, name+".html.gotmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := texttemplate.ParseFS(t.fsys, name+".txt.gotmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, textBuf, htmlBuf bytes.Buffer
+	if err = text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err = text.Execute(&textBuf, data); err != nil {
+		return nil, err
+	}
+	if err = html.Execute(&htmlBuf, data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      []Address{to},
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    textBuf.String(),
+		HTML:    htmlBuf.String(),
+	}, nil
+}
+
+func NewTemplates(fsys fs.FS) *Templates {
+	return &Templates{fsys}
+}
@@ -9,10 +9,11 @@ import (
 
 type Subscription uuid.UUID
 
-type Emitter[Topic, Msg any] interface {
+type Emitter[Topic comparable, Msg any] interface {
 	io.Closer
 
 	Ready() bool
+	Subscribers() map[Topic]int
 	Publish(topic Topic, msg Msg)
 	Subscribe(topic Topic, ch chan Msg) Subscription
 	Unsubscribe(topic Topic, sub Subscription)
@@ -44,6 +45,19 @@ func (e *emitter[_, _]) Ready() bool {
 	return !empty
 }
 
+// Subscribers implements Emitter.
+func (e *emitter[Topic, _]) Subscribers() map[Topic]int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	counts := make(map[Topic]int, len(e.subs))
+	for topic, subs := range e.subs {
+		counts[topic] = len(subs)
+	}
+
+	return counts
+}
+
 // Close implements Emitter.
 func (e *emitter[_, _]) Close() error {
 	e.mu.Lock()
@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+)
+
+type (
+	// Check is a single readiness probe. Subsystems contribute checks to
+	// the "health_checks" fx value group.
+	Check interface {
+		Name() string
+		Check(context.Context) error
+	}
+
+	CheckFunc func(context.Context) error
+
+	Result struct {
+		Name     string        `json:"name"`
+		Status   string        `json:"status"`
+		Error    string        `json:"error,omitempty"`
+		Duration time.Duration `json:"duration"`
+	}
+
+	Report struct {
+		Status string   `json:"status"`
+		Checks []Result `json:"checks"`
+	}
+
+	check struct {
+		name string
+		fn   CheckFunc
+	}
+)
+
+func (c check) Name() string { return c.name }
+
+func (c check) Check(ctx context.Context) error { return c.fn(ctx) }
+
+func (r Report) OK() bool { return r.Status == StatusPass }
+
+func NewCheck(name string, fn CheckFunc) Check {
+	return check{name, fn}
+}
+
+// Run executes every check concurrently, bounding each by the given timeout.
+func Run(ctx context.Context, timeout time.Duration, checks ...Check) Report {
+	var wg sync.WaitGroup
+
+	results := make([]Result, len(checks))
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.Check(ctx)
+
+			results[i] = Result{
+				Name:     c.Name(),
+				Status:   StatusPass,
+				Duration: time.Since(start),
+			}
+
+			if err != nil {
+				results[i].Status = StatusFail
+				results[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+
+	wg.Wait()
+
+	report := Report{Status: StatusPass, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusFail {
+			report.Status = StatusFail
+			break
+		}
+	}
+
+	return report
+}
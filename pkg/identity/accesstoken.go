@@ -0,0 +1,173 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bdreece/herobrian/pkg/database"
+)
+
+// accessTokenPrefix marks herobrian tokens, so they are recognisable to
+// secret scanners and in logs.
+const accessTokenPrefix = "hbp_"
+
+var (
+	ErrInvalidAccessToken = errors.New("access token is invalid or has expired")
+	ErrInvalidScope       = errors.New("access tokens may only hold permissions of your role or unit permissions")
+)
+
+type (
+	// AccessTokens issues personal access tokens for the API and
+	// authenticates requests bearing them. Only a SHA-256 hash of each token
+	// is stored; the tokens are random, so a slow hash is not needed.
+	AccessTokens struct {
+		db database.Querier
+	}
+
+	// IssuedToken is a newly created token. Value is shown to the user once
+	// and cannot be recovered.
+	IssuedToken struct {
+		ID    int64
+		Value string
+	}
+)
+
+// Scopes lists the permissions a token for the role may be issued. Unit
+// permissions are included, as they may be held through grants.
+func Scopes(role Role) []Permission {
+	scopes := role.Permissions()
+	for _, p := range UnitPermissions {
+		if !slices.Contains(scopes, p) {
+			scopes = append(scopes, p)
+		}
+	}
+
+	return scopes
+}
+
+// Issue creates a token for the user restricted to the permissions. A nil
+// expiry never expires.
+func (t *AccessTokens) Issue(ctx context.Context, claims *ClaimSet, name string, permissions []Permission, expiresAt *time.Time) (*IssuedToken, error) {
+	scopes := Scopes(Role(claims.Role))
+	for _, p := range permissions {
+		if !slices.Contains(scopes, p) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, p)
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	value := accessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	hash := sha256.Sum256([]byte(value))
+
+	id, err := t.db.CreateAccessToken(ctx, database.CreateAccessTokenParams{
+		UserID:      claims.ID,
+		Name:        name,
+		TokenHash:   hash[:],
+		Permissions: joinPermissions(permissions),
+		CreatedAt:   time.Now().UTC(),
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access token: %w", err)
+	}
+
+	return &IssuedToken{ID: id, Value: value}, nil
+}
+
+// Authenticate implements Authenticator, reading a bearer token from the
+// Authorization header. The claims are limited to the token's permissions.
+func (t *AccessTokens) Authenticate(c echo.Context) (*ClaimSet, error) {
+	scheme, value, ok := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || !strings.HasPrefix(value, accessTokenPrefix) {
+		return nil, errors.Join(
+			fmt.Errorf("request has no bearer token"),
+			ErrUnauthenticated,
+		)
+	}
+
+	ctx := c.Request().Context()
+	hash := sha256.Sum256([]byte(value))
+	token, err := t.db.FindAccessTokenByHash(ctx, hash[:])
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Join(ErrInvalidAccessToken, ErrUnauthenticated)
+	} else if err != nil {
+		return nil, errors.Join(
+			fmt.Errorf("failed to find access token: %w", err),
+			ErrUnauthenticated,
+		)
+	}
+
+	now := time.Now().UTC()
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return nil, errors.Join(ErrInvalidAccessToken, ErrUnauthenticated)
+	}
+
+	user, err := t.db.FindUser(ctx, token.UserID)
+	if err != nil {
+		return nil, errors.Join(
+			fmt.Errorf("failed to find user: %w", err),
+			ErrUnauthenticated,
+		)
+	}
+	if user.Disabled {
+		return nil, errors.Join(
+			fmt.Errorf("user is disabled"),
+			ErrUnauthenticated,
+		)
+	}
+
+	err = t.db.UseAccessToken(ctx, database.UseAccessTokenParams{
+		LastUsedAt: &now,
+		ID:         token.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record access token use: %w", err)
+	}
+
+	claims := NewClaimSet(&user)
+	claims.Scopes = SplitPermissions(token.Permissions)
+
+	return claims, nil
+}
+
+// SplitPermissions parses the comma-separated permissions of a token. It
+// never returns nil, so a token without permissions holds none.
+func SplitPermissions(s string) []Permission {
+	permissions := make([]Permission, 0)
+	for _, p := range strings.Split(s, ",") {
+		if p != "" {
+			permissions = append(permissions, Permission(p))
+		}
+	}
+
+	return permissions
+}
+
+func joinPermissions(permissions []Permission) string {
+	s := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		s = append(s, string(p))
+	}
+
+	return strings.Join(s, ",")
+}
+
+func NewAccessTokens(db database.Querier) *AccessTokens {
+	return &AccessTokens{db}
+}
+
+var _ Authenticator = (*AccessTokens)(nil)
@@ -8,8 +8,9 @@ import (
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
-	"github.com/mitchellh/mapstructure"
 	"go.uber.org/config"
+
+	"github.com/bdreece/herobrian/pkg/database"
 )
 
 type (
@@ -25,6 +26,7 @@ type (
 
 	CookieAuthenticator struct {
 		opts *CookieOptions
+		db   database.Querier
 	}
 )
 
@@ -56,31 +58,51 @@ func (ca *CookieAuthenticator) Authenticate(c echo.Context) (*ClaimSet, error) {
 		)
 	}
 
-	claims := new(ClaimSet)
-	if err = mapstructure.Decode(sess.Values, &claims); err != nil {
+	userID, ok := sess.Values[UserIDKey].(int64)
+	if !ok {
+		return nil, errors.Join(
+			fmt.Errorf("session has no user"),
+			ErrUnauthenticated,
+		)
+	}
+
+	// claims are read from the database on every request, so changes to
+	// the user take effect immediately
+	user, err := ca.db.FindUser(c.Request().Context(), userID)
+	if err != nil {
+		return nil, errors.Join(
+			fmt.Errorf("failed to find user: %w", err),
+			ErrUnauthenticated,
+		)
+	}
+
+	if user.Disabled {
 		return nil, errors.Join(
-			fmt.Errorf("failed to decode claims: %w", err),
+			fmt.Errorf("user is disabled"),
 			ErrUnauthenticated,
 		)
 	}
 
+	claims := NewClaimSet(&user)
+	claims.SessionID = sess.ID
+
 	return claims, nil
 }
 
 // SignIn implements SignInManager.
 func (ca *CookieAuthenticator) SignIn(c echo.Context, claims *ClaimSet) error {
+	// a cookie from before an upgrade or key rotation is replaced like any
+	// other
 	sess, err := session.Get(ca.opts.Name, c)
-	if err != nil {
+	if err != nil && !errors.Is(err, ErrInvalidSessionCookie) {
 		return fmt.Errorf("failed to get session: %w", err)
 	}
 
-	if sess.IsNew {
-		sess.Options = ca.opts.SessionOptions()
-	}
-
-	if err = mapstructure.Decode(claims, &sess.Values); err != nil {
-		return fmt.Errorf("failed to encode claims: %w", err)
-	}
+	// always start a fresh session, so a session ID is never reused
+	// across sign-ins
+	sess.ID = ""
+	sess.Options = ca.opts.SessionOptions()
+	sess.Values = map[any]any{UserIDKey: claims.ID}
 
 	if err = sess.Save(c.Request(), c.Response()); err != nil {
 		return err
@@ -92,11 +114,13 @@ func (ca *CookieAuthenticator) SignIn(c echo.Context, claims *ClaimSet) error {
 // SignOut implements SignInManager.
 func (ca *CookieAuthenticator) SignOut(c echo.Context) error {
 	sess, err := session.Get(ca.opts.Name, c)
-	if err != nil {
+	invalid := errors.Is(err, ErrInvalidSessionCookie)
+	if err != nil && !invalid {
 		return fmt.Errorf("failed to get session: %w", err)
 	}
 
-	if sess.IsNew {
+	// an undecodable cookie is still cleared
+	if sess.IsNew && !invalid {
 		return nil
 	}
 
@@ -117,8 +141,8 @@ func ConfigureCookie(provider config.Provider) (*CookieOptions, error) {
 	return opts, nil
 }
 
-func NewCookieAuthenticator(opts *CookieOptions) *CookieAuthenticator {
-	return &CookieAuthenticator{opts}
+func NewCookieAuthenticator(opts *CookieOptions, db database.Querier) *CookieAuthenticator {
+	return &CookieAuthenticator{opts, db}
 }
 
 var (
@@ -0,0 +1,127 @@
+package identity
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+
+	"github.com/bdreece/herobrian/pkg/database"
+)
+
+// staleCookies are session cookies the store cannot decode: one from
+// gorilla's CookieStore under other keys, as before an upgrade or a key
+// rotation, and one which is not a cookie value at all.
+func staleCookies(t *testing.T) map[string]string {
+	t.Helper()
+
+	rotated := securecookie.New([]byte(strings.Repeat("r", 32)), []byte(strings.Repeat("r", 32)))
+	value, err := rotated.Encode(testCookie.Name, map[any]any{UserIDKey: int64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]string{
+		"rotated keys": value,
+		"garbage":      base64.URLEncoding.EncodeToString([]byte("garbage")),
+	}
+}
+
+type cookieTest struct {
+	*testing.T
+
+	store *SessionStore
+	auth  *CookieAuthenticator
+	query database.Querier
+	echo  *echo.Echo
+}
+
+func newCookieTest(t *testing.T) *cookieTest {
+	// sessions expire with the cookie
+	cookie := *testCookie
+	cookie.MaxAge = 3600
+
+	query := database.NewQuerier(openDB(t))
+	store, err := NewSessionStore(testSessionOptions(), &cookie, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &cookieTest{t, store, NewCookieAuthenticator(&cookie, query), query, echo.New()}
+}
+
+// serve runs fn with the session middleware for a request with the cookie.
+func (ct *cookieTest) serve(cookie string, fn func(echo.Context) error) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(&http.Cookie{Name: testCookie.Name, Value: cookie})
+
+	rec := httptest.NewRecorder()
+	err := session.Middleware(ct.store)(fn)(ct.echo.NewContext(req, rec))
+	return rec, err
+}
+
+func TestSignInReplacesStaleCookie(t *testing.T) {
+	for name, cookie := range staleCookies(t) {
+		t.Run(name, func(t *testing.T) {
+			ct := newCookieTest(t)
+			steve := createUser(t, ct.query, "steve", RoleUser)
+
+			rec, err := ct.serve(cookie, func(c echo.Context) error {
+				return ct.auth.SignIn(c, &ClaimSet{ID: steve.ID})
+			})
+			if err != nil {
+				t.Fatalf("failed to sign in: %v", err)
+			}
+
+			sessions, err := ct.query.ListUserSessions(context.Background(), database.ListUserSessionsParams{UserID: steve.ID, Now: time.Now().UTC()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions) != 1 {
+				t.Fatalf("found %d sessions, want 1", len(sessions))
+			}
+
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Value == cookie {
+				t.Fatalf("stale cookie was not replaced: %+v", cookies)
+			}
+
+			// the new cookie authenticates
+			_, err = ct.serve(cookies[0].Value, func(c echo.Context) error {
+				claims, err := ct.auth.Authenticate(c)
+				if err == nil && claims.ID != steve.ID {
+					t.Errorf("authenticated as %d, want %d", claims.ID, steve.ID)
+				}
+				return err
+			})
+			if err != nil {
+				t.Errorf("failed to authenticate with the new cookie: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignOutClearsStaleCookie(t *testing.T) {
+	for name, cookie := range staleCookies(t) {
+		t.Run(name, func(t *testing.T) {
+			ct := newCookieTest(t)
+
+			rec, err := ct.serve(cookie, ct.auth.SignOut)
+			if err != nil {
+				t.Fatalf("failed to sign out: %v", err)
+			}
+
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Value != "" || cookies[0].MaxAge >= 0 {
+				t.Errorf("stale cookie was not cleared: %+v", cookies)
+			}
+		})
+	}
+}
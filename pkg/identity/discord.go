@@ -0,0 +1,81 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
+
+const discordAPI = "https://discord.com/api/v10"
+
+var discordEndpoint = oauth2.Endpoint{
+	AuthURL:   "https://discord.com/oauth2/authorize",
+	TokenURL:  "https://discord.com/api/oauth2/token",
+	AuthStyle: oauth2.AuthStyleInHeader,
+}
+
+type (
+	discordUser struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+	}
+
+	discordMember struct {
+		Roles []string `json:"roles"`
+	}
+)
+
+// identifyDiscord reads the user and, if a guild is configured, the IDs of
+// their roles in it. Users outside the guild have no roles.
+func identifyDiscord(ctx context.Context, p *oauthProvider, token *oauth2.Token, _ string) (*ExternalIdentity, error) {
+	client := p.config.Client(ctx, token)
+
+	user := new(discordUser)
+	if _, err := discordGet(client, "/users/@me", user); err != nil {
+		return nil, err
+	}
+
+	ext := &ExternalIdentity{Subject: user.ID, Username: user.Username}
+	if p.opts.GuildID == "" {
+		return ext, nil
+	}
+
+	member := new(discordMember)
+	found, err := discordGet(client, "/users/@me/guilds/"+url.PathEscape(p.opts.GuildID)+"/member", member)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		ext.Roles = member.Roles
+	}
+
+	return ext, nil
+}
+
+// discordGet decodes the response into v, returning false if it was not
+// found.
+func discordGet(client *http.Client, path string, v any) (bool, error) {
+	res, err := client.Get(discordAPI + path)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("discord returned %s for %s", res.Status, path)
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(v); err != nil {
+		return false, fmt.Errorf("failed to decode discord response: %w", err)
+	}
+
+	return true, nil
+}
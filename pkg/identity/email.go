@@ -0,0 +1,121 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/email"
+	"github.com/bdreece/herobrian/pkg/token"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("email verification token is invalid or has expired")
+	ErrEmailTaken               = errors.New("email address is verified by another account")
+)
+
+type (
+	// EmailManager changes a user's email address, which remains unverified
+	// until the link sent to it is followed.
+	EmailManager interface {
+		SetEmail(ctx context.Context, claims *ClaimSet, address, verifyURL string) error
+		ConfirmEmail(ctx context.Context, verificationToken string) error
+	}
+
+	emailManager struct {
+		db        database.Querier
+		client    email.Client
+		templates *email.Templates
+		handler   token.Handler[token.EmailVerificationClaims]
+		opts      *token.Options
+	}
+
+	EmailManagerParams struct {
+		fx.In
+
+		Querier      database.Querier
+		EmailClient  email.Client
+		Templates    *email.Templates
+		TokenHandler token.Handler[token.EmailVerificationClaims]
+		TokenOptions *token.Options `name:"email_verification"`
+	}
+)
+
+// SetEmail implements EmailManager.
+func (m *emailManager) SetEmail(ctx context.Context, claims *ClaimSet, address, verifyURL string) error {
+	// several users may enter an address, but only one may verify it
+	owner, err := m.db.FindUserByEmail(ctx, &address)
+	if err == nil && owner.ID != claims.ID {
+		return ErrEmailTaken
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to find user by email: %w", err)
+	}
+
+	_, err = m.db.UpdateUserEmail(ctx, database.UpdateUserEmailParams{
+		Email: &address,
+		ID:    claims.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+
+	t, err := m.handler.Sign(&token.EmailVerificationClaims{
+		UserID: int(claims.ID),
+		Email:  address,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign email verification token: %w", err)
+	}
+
+	msg, err := m.templates.Render("verify-email", email.Address{
+		Name:  claims.Username,
+		Email: address,
+	}, map[string]any{
+		"Username": claims.Username,
+		"URL":      verifyURL + "/" + t,
+		"ValidFor": m.opts.ValidFor,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render verification email: %w", err)
+	}
+
+	return m.client.Send(ctx, msg)
+}
+
+// ConfirmEmail implements EmailManager. The token only verifies the address
+// it was sent to, so changing the email again invalidates it.
+func (m *emailManager) ConfirmEmail(ctx context.Context, verificationToken string) error {
+	claims, err := m.handler.Verify(verificationToken)
+	if err != nil {
+		return errors.Join(ErrInvalidVerificationToken, err)
+	}
+
+	n, err := m.db.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+		ID:    int64(claims.UserID),
+		Email: &claims.Email,
+	})
+	if database.IsUniqueViolation(err) {
+		return ErrEmailTaken
+	} else if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	if n == 0 {
+		return ErrInvalidVerificationToken
+	}
+
+	return nil
+}
+
+func NewEmailManager(p EmailManagerParams) EmailManager {
+	return &emailManager{
+		db:        p.Querier,
+		client:    p.EmailClient,
+		templates: p.Templates,
+		handler:   p.TokenHandler,
+		opts:      p.TokenOptions,
+	}
+}
@@ -0,0 +1,79 @@
+package identity
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/email"
+	"github.com/bdreece/herobrian/pkg/token"
+	"github.com/bdreece/herobrian/web"
+)
+
+func TestEmailVerifiedByOneUser(t *testing.T) {
+	ctx := context.Background()
+	query := database.NewQuerier(openDB(t))
+	opts := &token.Options{
+		Audience:  "herobrian",
+		Issuer:    "herobrian",
+		ValidFor:  "1h",
+		SecretKey: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))),
+	}
+	handler := token.NewHandler[token.EmailVerificationClaims](opts)
+	manager := NewEmailManager(EmailManagerParams{
+		Querier:      query,
+		EmailClient:  email.NewCaptureClient(),
+		Templates:    email.NewTemplates(web.EmailTemplates),
+		TokenHandler: handler,
+		TokenOptions: opts,
+	})
+
+	steve := createUser(t, query, "steve", RoleUser)
+	alex := createUser(t, query, "alex", RoleUser)
+	herobrian := createUser(t, query, "herobrian", RoleUser)
+
+	verify := func(user *database.User) error {
+		t.Helper()
+
+		tok, err := handler.Sign(&token.EmailVerificationClaims{UserID: int(user.ID), Email: "steve@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return manager.ConfirmEmail(ctx, tok)
+	}
+
+	// an address may be pending for several users
+	for _, user := range []*database.User{alex, steve} {
+		if err := manager.SetEmail(ctx, NewClaimSet(user), "steve@example.com", "https://herobrian.test/account/email"); err != nil {
+			t.Fatalf("failed to set email of %s: %v", user.Username, err)
+		}
+	}
+
+	if err := verify(steve); err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if err := verify(alex); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("verifying a taken address returned %v, want ErrEmailTaken", err)
+	}
+
+	// once verified, nobody else may enter it
+	err := manager.SetEmail(ctx, NewClaimSet(herobrian), "steve@example.com", "https://herobrian.test/account/email")
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("entering a verified address returned %v, want ErrEmailTaken", err)
+	}
+
+	address := "steve@example.com"
+	user, err := query.FindUserByEmail(ctx, &address)
+	if err != nil || user.ID != steve.ID {
+		t.Errorf("address belongs to %+v, %v, want steve", user, err)
+	}
+
+	// but its owner may send the link again
+	if err = manager.SetEmail(ctx, NewClaimSet(&user), "steve@example.com", "https://herobrian.test/account/email"); err != nil {
+		t.Errorf("failed to set own address: %v", err)
+	}
+}
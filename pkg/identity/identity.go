@@ -4,17 +4,28 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
 type (
 	ClaimSet struct {
-		ID        int64  `mapstructure:"id"`
-		Username  string `mapstructure:"username"`
-		FirstName string `mapstructure:"first_name"`
-		LastName  string `mapstructure:"last_name"`
-		Role      int64  `mapstructure:"role"`
+		ID          int64  `mapstructure:"id"`
+		Username    string `mapstructure:"username"`
+		FirstName   string `mapstructure:"first_name"`
+		LastName    string `mapstructure:"last_name"`
+		DisplayName string `mapstructure:"display_name"`
+		Email       string `mapstructure:"email"`
+		Role        int64  `mapstructure:"role"`
+		HasAvatar   bool   `mapstructure:"has_avatar"`
+		// SessionID identifies the session the claims were read from.
+		SessionID string `mapstructure:"-"`
+		// Scopes restricts the claims to these permissions, when they were
+		// read from an access token. Nil claims hold every permission of
+		// their role.
+		Scopes []Permission `mapstructure:"-"`
 	}
 
 	Authenticator interface {
@@ -34,8 +45,10 @@ type (
 
 	PasswordManager interface {
 		SetPassword(ctx context.Context, claims *ClaimSet, oldPassword, newPassword string) error
-		SendPasswordReset(ctx context.Context, email string) error
-		ConfirmPasswordReset(ctx context.Context, email, password, confirmation string) error
+		// SendPasswordReset emails a single-use link, formed by appending the
+		// reset token to resetURL, to the user with the verified address.
+		SendPasswordReset(ctx context.Context, email, resetURL string) error
+		ConfirmPasswordReset(ctx context.Context, token, password string) error
 	}
 )
 
@@ -44,6 +57,25 @@ var (
 	ErrUnauthorized    = errors.New("user is unauthorized")
 )
 
+// Name is what the user would like to be called: their display name, else
+// their full name, else their username.
+func (cs *ClaimSet) Name() string {
+	if cs.DisplayName != "" {
+		return cs.DisplayName
+	}
+	if name := strings.TrimSpace(cs.FirstName + " " + cs.LastName); name != "" {
+		return name
+	}
+
+	return cs.Username
+}
+
+// InScope reports whether the claims may use the permission at all,
+// regardless of their role.
+func (cs *ClaimSet) InScope(p Permission) bool {
+	return cs.Scopes == nil || slices.Contains(cs.Scopes, p)
+}
+
 func (fn AuthorizerFunc) Authorize(claims *ClaimSet) error {
 	return fn(claims)
 }
@@ -0,0 +1,55 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bdreece/herobrian/pkg/database"
+)
+
+var testCookie = &CookieOptions{Name: "herobrian", Path: "/", HttpOnly: true}
+
+func testSessionOptions() *SessionOptions {
+	return &SessionOptions{
+		SigningKey:    base64.StdEncoding.EncodeToString([]byte(strings.Repeat("s", 64))),
+		EncryptionKey: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("e", 32))),
+	}
+}
+
+// openDB returns a migrated SQLite database which is removed after the test.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open(database.SQLite, "file:"+filepath.Join(t.TempDir(), "herobrian.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err = database.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func createUser(t *testing.T, query database.Querier, username string, role Role) *database.User {
+	t.Helper()
+
+	ctx := context.Background()
+	id, err := query.CreateUser(ctx, database.CreateUserParams{Username: username, PasswordHash: "hash", RoleID: int64(role)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := query.FindUser(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &user
+}
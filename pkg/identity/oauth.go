@@ -0,0 +1,644 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gorilla/securecookie"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/config"
+	"go.uber.org/fx"
+	"golang.org/x/oauth2"
+
+	"github.com/bdreece/herobrian/pkg/database"
+)
+
+const (
+	ProviderTypeDiscord = "discord"
+	ProviderTypeOIDC    = "oidc"
+
+	// flowMaxAge bounds the time the user may spend at the provider.
+	flowMaxAge   = 10 * time.Minute
+	oauthTimeout = 10 * time.Second
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown sign-in provider")
+	ErrInvalidOAuthFlow = errors.New("sign-in request is missing, has expired or does not match")
+	ErrOAuthDenied      = errors.New("sign-in was cancelled at the provider")
+	ErrAccountNotLinked = errors.New("no user is linked to this account")
+	ErrAccountLinked    = errors.New("this account is already linked to another user")
+)
+
+var usernameInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+type (
+	OAuthOptions struct {
+		// BaseURL is the external address of herobrian. The callback for
+		// each provider is BaseURL/login/oauth/<name>/callback.
+		BaseURL   string                 `yaml:"base_url"`
+		Providers []OAuthProviderOptions `yaml:"providers"`
+	}
+
+	OAuthProviderOptions struct {
+		// Name identifies the provider in URLs and linked accounts.
+		Name         string   `yaml:"name"`
+		DisplayName  string   `yaml:"display_name"`
+		Type         string   `yaml:"type"`
+		ClientID     string   `yaml:"client_id"`
+		ClientSecret string   `yaml:"client_secret"`
+		Scopes       []string `yaml:"scopes"`
+		// Issuer is the OpenID Connect issuer URL.
+		Issuer string `yaml:"issuer"`
+		// RolesClaim names the ID token claim listing the user's groups or
+		// roles at an OpenID Connect provider.
+		RolesClaim string `yaml:"roles_claim"`
+		// GuildID is the Discord server whose member roles are read.
+		GuildID string `yaml:"guild_id"`
+		// Roles maps external roles to herobrian roles. Users without a
+		// linked account are created if they hold a mapped role, with the
+		// highest role they map to.
+		Roles map[string]string `yaml:"roles"`
+	}
+
+	// OAuthProvider describes a configured provider for the login page.
+	OAuthProvider struct {
+		Name        string
+		DisplayName string
+	}
+
+	// ExternalIdentity is the user as described by the provider.
+	ExternalIdentity struct {
+		Provider string
+		Subject  string
+		Username string
+		Roles    []string
+	}
+
+	OAuthResult struct {
+		User     *database.User
+		Identity *ExternalIdentity
+		// Linked is set when the flow linked the account to the signed-in
+		// user rather than signing in.
+		Linked bool
+		// Provisioned is set when a user was created for the account.
+		Provisioned bool
+	}
+
+	// OAuthManager signs users in with an OAuth2 authorization code and
+	// PKCE, through Discord or an OpenID Connect provider, and links the
+	// external accounts to users. The state, PKCE verifier and nonce are
+	// kept in a short-lived cookie while the user is at the provider.
+	OAuthManager struct {
+		db        *sql.DB
+		query     database.Querier
+		client    *http.Client
+		baseURL   string
+		providers map[string]*oauthProvider
+		order     []OAuthProvider
+		codecs    []securecookie.Codec
+		cookie    *CookieOptions
+	}
+
+	OAuthParams struct {
+		fx.In
+
+		Options *OAuthOptions
+		Session *SessionOptions
+		Cookie  *CookieOptions
+		DB      *sql.DB
+		Querier database.Querier
+	}
+
+	oauthProvider struct {
+		opts  OAuthProviderOptions
+		roles map[string]Role
+
+		// identify reads the user from the provider once the code is
+		// exchanged.
+		identify func(ctx context.Context, p *oauthProvider, token *oauth2.Token, nonce string) (*ExternalIdentity, error)
+
+		redirectURL string
+
+		mu       sync.Mutex
+		config   *oauth2.Config
+		verifier *oidc.IDTokenVerifier
+	}
+
+	oauthFlow struct {
+		Provider string
+		State    string
+		Verifier string
+		Nonce    string
+		// Link is set when the account is linked to UserID on return.
+		Link   bool
+		UserID int64
+	}
+)
+
+// Providers lists the configured providers in configuration order.
+func (m *OAuthManager) Providers() []OAuthProvider {
+	return m.order
+}
+
+// Begin returns the provider's authorization URL to sign in.
+func (m *OAuthManager) Begin(c echo.Context, name string) (string, error) {
+	return m.begin(c, name, &oauthFlow{})
+}
+
+// BeginLink returns the provider's authorization URL to link the account to
+// the user, instead of signing in.
+func (m *OAuthManager) BeginLink(c echo.Context, name string, userID int64) (string, error) {
+	return m.begin(c, name, &oauthFlow{Link: true, UserID: userID})
+}
+
+func (m *OAuthManager) begin(c echo.Context, name string, flow *oauthFlow) (string, error) {
+	p, ok := m.providers[name]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	ctx, cancel := m.context(c.Request().Context())
+	defer cancel()
+
+	cfg, err := p.oauthConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	flow.Provider = name
+	flow.State = randomString()
+	flow.Verifier = oauth2.GenerateVerifier()
+	flow.Nonce = randomString()
+
+	value, err := securecookie.EncodeMulti(m.flowName(), flow, m.codecs...)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode sign-in request: %w", err)
+	}
+	c.SetCookie(m.flowCookie(value, int(flowMaxAge.Seconds())))
+
+	return cfg.AuthCodeURL(flow.State,
+		oauth2.S256ChallengeOption(flow.Verifier),
+		oidc.Nonce(flow.Nonce),
+	), nil
+}
+
+// Complete handles the provider redirecting back with a code. claims is the
+// signed-in user, if any, and must match the user a link was begun for.
+func (m *OAuthManager) Complete(c echo.Context, name string, claims *ClaimSet) (*OAuthResult, error) {
+	p, ok := m.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	flow, err := m.flow(c)
+	if err != nil {
+		return nil, err
+	}
+	m.clearFlow(c)
+
+	state := c.QueryParam("state")
+	if flow.Provider != name || subtle.ConstantTimeCompare([]byte(flow.State), []byte(state)) != 1 {
+		return nil, ErrInvalidOAuthFlow
+	}
+	if flow.Link && (claims == nil || claims.ID != flow.UserID) {
+		return nil, ErrInvalidOAuthFlow
+	}
+	if c.QueryParam("error") != "" {
+		return nil, ErrOAuthDenied
+	}
+
+	ctx, cancel := m.context(c.Request().Context())
+	defer cancel()
+
+	cfg, err := p.oauthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := cfg.Exchange(ctx, c.QueryParam("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	ext, err := p.identify(ctx, p, token, flow.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to identify %s user: %w", name, err)
+	}
+	ext.Provider = name
+
+	if flow.Link {
+		return m.link(c.Request().Context(), flow.UserID, ext)
+	}
+
+	return m.signIn(c.Request().Context(), p, ext)
+}
+
+func (m *OAuthManager) link(ctx context.Context, userID int64, ext *ExternalIdentity) (*OAuthResult, error) {
+	account, err := m.query.FindExternalAccount(ctx, database.FindExternalAccountParams{
+		Provider: ext.Provider,
+		Subject:  ext.Subject,
+	})
+	switch {
+	case err == nil && account.UserID != userID:
+		return nil, ErrAccountLinked
+	case errors.Is(err, sql.ErrNoRows):
+		err = m.query.CreateExternalAccount(ctx, database.CreateExternalAccountParams{
+			UserID:    userID,
+			Provider:  ext.Provider,
+			Subject:   ext.Subject,
+			Username:  ext.Username,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to link account: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to find linked account: %w", err)
+	}
+
+	user, err := m.query.FindUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	return &OAuthResult{User: &user, Identity: ext, Linked: true}, nil
+}
+
+func (m *OAuthManager) signIn(ctx context.Context, p *oauthProvider, ext *ExternalIdentity) (*OAuthResult, error) {
+	account, err := m.query.FindExternalAccount(ctx, database.FindExternalAccountParams{
+		Provider: ext.Provider,
+		Subject:  ext.Subject,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return m.provision(ctx, p, ext)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find linked account: %w", err)
+	}
+
+	now := time.Now().UTC()
+	err = m.query.UseExternalAccount(ctx, database.UseExternalAccountParams{
+		Username:   ext.Username,
+		LastUsedAt: &now,
+		ID:         account.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record account use: %w", err)
+	}
+
+	user, err := m.query.FindUser(ctx, account.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	return &OAuthResult{User: &user, Identity: ext}, nil
+}
+
+// provision creates a user for an unlinked account holding a mapped role.
+// The user has no password; they sign in through the provider until they
+// reset one.
+func (m *OAuthManager) provision(ctx context.Context, p *oauthProvider, ext *ExternalIdentity) (*OAuthResult, error) {
+	role, ok := p.mapRole(ext.Roles)
+	if !ok {
+		return nil, ErrAccountNotLinked
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := database.WithTx(m.db, tx)
+	username, err := availableUsername(ctx, query, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := query.CreateUser(ctx, database.CreateUserParams{
+		Username: username,
+		RoleID:   int64(role),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	err = query.CreateExternalAccount(ctx, database.CreateExternalAccountParams{
+		UserID:    id,
+		Provider:  ext.Provider,
+		Subject:   ext.Subject,
+		Username:  ext.Username,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link account: %w", err)
+	}
+
+	user, err := query.FindUser(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &OAuthResult{User: &user, Identity: ext, Provisioned: true}, nil
+}
+
+// availableUsername derives a username from the external one, adding a
+// number if it is taken.
+func availableUsername(ctx context.Context, query database.Querier, ext *ExternalIdentity) (string, error) {
+	base := strings.Trim(usernameInvalid.ReplaceAllString(ext.Username, "_"), "_.-")
+	if len(base) < 3 {
+		base = ext.Provider + "_" + ext.Subject
+	}
+	if len(base) > 100 {
+		base = base[:100]
+	}
+
+	for i := 1; i <= 100; i++ {
+		username := base
+		if i > 1 {
+			username += strconv.Itoa(i)
+		}
+
+		_, err := query.FindUserByUsername(ctx, username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return username, nil
+		} else if err != nil {
+			return "", fmt.Errorf("failed to find user: %w", err)
+		}
+	}
+
+	return "", fmt.Errorf("no username available for %q", ext.Username)
+}
+
+// mapRole returns the highest herobrian role the external roles map to.
+func (p *oauthProvider) mapRole(roles []string) (Role, bool) {
+	var (
+		role  Role
+		found bool
+	)
+	for _, r := range roles {
+		if mapped, ok := p.roles[r]; ok && (!found || mapped > role) {
+			role, found = mapped, true
+		}
+	}
+
+	return role, found
+}
+
+// oauthConfig discovers OpenID Connect endpoints on first use, so an
+// unreachable issuer does not prevent startup.
+func (p *oauthProvider) oauthConfig(ctx context.Context) (*oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.config != nil {
+		return p.config, nil
+	}
+
+	oidcProvider, err := oidc.NewProvider(ctx, p.opts.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", p.opts.Name, err)
+	}
+
+	scopes := p.opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile"}
+	}
+
+	p.verifier = oidcProvider.Verifier(&oidc.Config{ClientID: p.opts.ClientID})
+	p.config = &oauth2.Config{
+		ClientID:     p.opts.ClientID,
+		ClientSecret: p.opts.ClientSecret,
+		Endpoint:     oidcProvider.Endpoint(),
+		Scopes:       scopes,
+		RedirectURL:  p.redirectURL,
+	}
+
+	return p.config, nil
+}
+
+// identifyOIDC reads the user from the verified ID token.
+func identifyOIDC(ctx context.Context, p *oauthProvider, token *oauth2.Token, nonce string) (*ExternalIdentity, error) {
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims map[string]any
+	if err = idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	ext := &ExternalIdentity{Subject: idToken.Subject}
+	for _, key := range []string{"preferred_username", "name", "email"} {
+		if s, ok := claims[key].(string); ok && s != "" {
+			ext.Username = s
+			break
+		}
+	}
+
+	switch v := claims[p.opts.RolesClaim].(type) {
+	case string:
+		ext.Roles = strings.Fields(v)
+	case []any:
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				ext.Roles = append(ext.Roles, s)
+			}
+		}
+	}
+
+	return ext, nil
+}
+
+func (m *OAuthManager) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, m.client)
+	ctx = oidc.ClientContext(ctx, m.client)
+	return context.WithTimeout(ctx, oauthTimeout)
+}
+
+func (m *OAuthManager) flow(c echo.Context) (*oauthFlow, error) {
+	cookie, err := c.Cookie(m.flowName())
+	if err != nil {
+		return nil, ErrInvalidOAuthFlow
+	}
+
+	flow := new(oauthFlow)
+	if err = securecookie.DecodeMulti(m.flowName(), cookie.Value, flow, m.codecs...); err != nil {
+		return nil, ErrInvalidOAuthFlow
+	}
+
+	return flow, nil
+}
+
+func (m *OAuthManager) clearFlow(c echo.Context) {
+	c.SetCookie(m.flowCookie("", -1))
+}
+
+func (m *OAuthManager) flowName() string {
+	return m.cookie.Name + "-oauth"
+}
+
+// flowCookie is sent on the provider's top-level redirect back, so it must
+// not be SameSite strict.
+func (m *OAuthManager) flowCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.flowName(),
+		Value:    value,
+		Path:     m.cookie.Path,
+		Domain:   m.cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   m.cookie.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseRole returns the role with the given name, ignoring case.
+func ParseRole(name string) (Role, error) {
+	for r := RoleUser; r <= RoleSuper; r++ {
+		if strings.EqualFold(r.String(), name) {
+			return r, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown role %q", name)
+}
+
+func ConfigureOAuth(provider config.Provider) (*OAuthOptions, error) {
+	opts := new(OAuthOptions)
+	if err := provider.Get("oauth").Populate(opts); err != nil {
+		return nil, fmt.Errorf("failed to configure oauth options: %w", err)
+	}
+
+	return opts, nil
+}
+
+// NewOAuthManager skips providers without a client ID, so they may be left
+// in the configuration until credentials are issued.
+func NewOAuthManager(p OAuthParams) (*OAuthManager, error) {
+	m := &OAuthManager{
+		db:        p.DB,
+		query:     p.Querier,
+		client:    &http.Client{Timeout: oauthTimeout},
+		baseURL:   strings.TrimSuffix(p.Options.BaseURL, "/"),
+		providers: make(map[string]*oauthProvider),
+		cookie:    p.Cookie,
+	}
+
+	for _, opts := range p.Options.Providers {
+		if opts.ClientID == "" {
+			continue
+		}
+		if opts.Name == "" || url.PathEscape(opts.Name) != opts.Name {
+			return nil, fmt.Errorf("invalid oauth provider name %q", opts.Name)
+		}
+		if _, ok := m.providers[opts.Name]; ok {
+			return nil, fmt.Errorf("duplicate oauth provider %q", opts.Name)
+		}
+
+		provider, err := newOAuthProvider(opts, m.baseURL+"/login/oauth/"+opts.Name+"/callback")
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure oauth provider %q: %w", opts.Name, err)
+		}
+
+		m.providers[opts.Name] = provider
+		m.order = append(m.order, OAuthProvider{Name: opts.Name, DisplayName: opts.DisplayName})
+	}
+
+	codecs, err := p.Session.Codecs(flowMaxAge, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.codecs = codecs
+
+	return m, nil
+}
+
+func newOAuthProvider(opts OAuthProviderOptions, redirectURL string) (*oauthProvider, error) {
+	if opts.DisplayName == "" {
+		opts.DisplayName = opts.Name
+	}
+
+	p := &oauthProvider{
+		opts:        opts,
+		roles:       make(map[string]Role, len(opts.Roles)),
+		redirectURL: redirectURL,
+	}
+	for external, name := range opts.Roles {
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, err
+		}
+		if role >= RoleSuper {
+			return nil, fmt.Errorf("role %q cannot be provisioned", name)
+		}
+
+		p.roles[external] = role
+	}
+
+	switch opts.Type {
+	case ProviderTypeDiscord:
+		scopes := opts.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"identify"}
+			if opts.GuildID != "" {
+				scopes = append(scopes, "guilds.members.read")
+			}
+		}
+
+		p.identify = identifyDiscord
+		p.config = &oauth2.Config{
+			ClientID:     opts.ClientID,
+			ClientSecret: opts.ClientSecret,
+			Endpoint:     discordEndpoint,
+			Scopes:       scopes,
+			RedirectURL:  redirectURL,
+		}
+	case ProviderTypeOIDC:
+		if opts.Issuer == "" {
+			return nil, errors.New("missing issuer")
+		}
+		if p.opts.RolesClaim == "" {
+			p.opts.RolesClaim = "groups"
+		}
+
+		// the endpoints are discovered from the issuer on first use
+		p.identify = identifyOIDC
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", opts.Type)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,283 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity/oauthtest"
+)
+
+type oauthTest struct {
+	*testing.T
+
+	provider *oauthtest.Server
+	manager  *OAuthManager
+	query    database.Querier
+	echo     *echo.Echo
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	provider, err := oauthtest.NewServer("herobrian", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+
+	db := openDB(t)
+	query := database.NewQuerier(db)
+	manager, err := NewOAuthManager(OAuthParams{
+		Options: &OAuthOptions{
+			BaseURL: "http://herobrian.test",
+			Providers: []OAuthProviderOptions{{
+				Name:         "test",
+				Type:         ProviderTypeOIDC,
+				ClientID:     provider.ClientID,
+				ClientSecret: provider.ClientSecret,
+				Issuer:       provider.URL,
+				Roles: map[string]string{
+					"players": "user",
+					"staff":   "admin",
+				},
+			}},
+		},
+		Session: testSessionOptions(),
+		Cookie:  testCookie,
+		DB:      db,
+		Querier: query,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &oauthTest{t, provider, manager, query, echo.New()}
+}
+
+// begin starts a flow, linking to the user if linkTo is non-zero, and
+// returns the authorization URL with the flow cookie.
+func (ot *oauthTest) begin(linkTo int64) (*url.URL, []*http.Cookie) {
+	ot.Helper()
+
+	rec := httptest.NewRecorder()
+	c := ot.echo.NewContext(httptest.NewRequest(http.MethodGet, "/login/oauth/test", nil), rec)
+
+	var (
+		authURL string
+		err     error
+	)
+	if linkTo != 0 {
+		authURL, err = ot.manager.BeginLink(c, "test", linkTo)
+	} else {
+		authURL, err = ot.manager.Begin(c, "test")
+	}
+	if err != nil {
+		ot.Fatalf("failed to begin: %v", err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		ot.Fatal(err)
+	}
+
+	return u, rec.Result().Cookies()
+}
+
+// authorize visits the provider, returning the callback it redirects to.
+func (ot *oauthTest) authorize(authURL *url.URL) *url.URL {
+	ot.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL.String())
+	if err != nil {
+		ot.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		ot.Fatalf("provider responded %s", res.Status)
+	}
+
+	callback, err := res.Location()
+	if err != nil {
+		ot.Fatal(err)
+	}
+
+	return callback
+}
+
+func (ot *oauthTest) complete(callback *url.URL, cookies []*http.Cookie, claims *ClaimSet) (*OAuthResult, error) {
+	ot.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	return ot.manager.Complete(ot.echo.NewContext(req, httptest.NewRecorder()), "test", claims)
+}
+
+// signIn runs a whole flow as the identity.
+func (ot *oauthTest) signIn(identity oauthtest.Identity, claims *ClaimSet, linkTo int64) (*OAuthResult, error) {
+	ot.Helper()
+
+	ot.provider.SignInAs(identity)
+	authURL, cookies := ot.begin(linkTo)
+	return ot.complete(ot.authorize(authURL), cookies, claims)
+}
+
+func TestOAuthLogin(t *testing.T) {
+	ot := newOAuthTest(t)
+	steve := oauthtest.Identity{Subject: "1", Username: "steve", Groups: []string{"players"}}
+
+	res, err := ot.signIn(steve, nil, 0)
+	if err != nil {
+		t.Fatalf("failed to sign in: %v", err)
+	}
+	if !res.Provisioned || res.User.Username != "steve" || res.User.RoleID != int64(RoleUser) {
+		t.Errorf("unexpected first sign-in: %+v, %+v", res, res.User)
+	}
+
+	again, err := ot.signIn(steve, nil, 0)
+	if err != nil {
+		t.Fatalf("failed to sign in again: %v", err)
+	}
+	if again.Provisioned || again.User.ID != res.User.ID {
+		t.Errorf("second sign-in did not use the linked user: %+v, %+v", again, again.User)
+	}
+
+	// a taken username is numbered, and the highest mapped role is used
+	other := oauthtest.Identity{Subject: "2", Username: "steve", Groups: []string{"players", "staff"}}
+	res, err = ot.signIn(other, nil, 0)
+	if err != nil {
+		t.Fatalf("failed to sign in: %v", err)
+	}
+	if res.User.Username != "steve2" || res.User.RoleID != int64(RoleAdmin) {
+		t.Errorf("unexpected user %+v", res.User)
+	}
+
+	// accounts without a mapped role are not provisioned
+	_, err = ot.signIn(oauthtest.Identity{Subject: "3", Username: "alex", Groups: []string{"visitors"}}, nil, 0)
+	if !errors.Is(err, ErrAccountNotLinked) {
+		t.Errorf("got %v, want ErrAccountNotLinked", err)
+	}
+}
+
+func TestOAuthLink(t *testing.T) {
+	ot := newOAuthTest(t)
+	alex := createUser(t, ot.query, "alex", RoleUser)
+	herobrian := createUser(t, ot.query, "herobrian", RoleUser)
+	identity := oauthtest.Identity{Subject: "1", Username: "alex_mc"}
+
+	res, err := ot.signIn(identity, &ClaimSet{ID: alex.ID}, alex.ID)
+	if err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if !res.Linked || res.User.ID != alex.ID {
+		t.Errorf("unexpected link: %+v, %+v", res, res.User)
+	}
+
+	accounts, err := ot.query.ListExternalAccounts(context.Background(), alex.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Provider != "test" || accounts[0].Subject != "1" {
+		t.Errorf("unexpected linked accounts: %+v", accounts)
+	}
+
+	// the linked account now signs in without a mapped role
+	res, err = ot.signIn(identity, nil, 0)
+	if err != nil {
+		t.Fatalf("failed to sign in: %v", err)
+	}
+	if res.Linked || res.Provisioned || res.User.ID != alex.ID {
+		t.Errorf("unexpected sign-in: %+v, %+v", res, res.User)
+	}
+
+	if _, err = ot.signIn(identity, &ClaimSet{ID: herobrian.ID}, herobrian.ID); !errors.Is(err, ErrAccountLinked) {
+		t.Errorf("linking to a second user returned %v, want ErrAccountLinked", err)
+	}
+
+	// a link begun for one user cannot be completed by another
+	if _, err = ot.signIn(identity, &ClaimSet{ID: herobrian.ID}, alex.ID); !errors.Is(err, ErrInvalidOAuthFlow) {
+		t.Errorf("completing another user's link returned %v, want ErrInvalidOAuthFlow", err)
+	}
+	if _, err = ot.signIn(identity, nil, alex.ID); !errors.Is(err, ErrInvalidOAuthFlow) {
+		t.Errorf("completing a link signed out returned %v, want ErrInvalidOAuthFlow", err)
+	}
+}
+
+func TestOAuthStateMismatch(t *testing.T) {
+	ot := newOAuthTest(t)
+	ot.provider.SignInAs(oauthtest.Identity{Subject: "1", Username: "steve", Groups: []string{"players"}})
+
+	authURL, cookies := ot.begin(0)
+	callback := ot.authorize(authURL)
+
+	q := callback.Query()
+	q.Set("state", strings.Repeat("A", len(q.Get("state"))))
+	callback.RawQuery = q.Encode()
+
+	if _, err := ot.complete(callback, cookies, nil); !errors.Is(err, ErrInvalidOAuthFlow) {
+		t.Errorf("got %v, want ErrInvalidOAuthFlow", err)
+	}
+
+	// nor is the flow accepted without its cookie
+	authURL, _ = ot.begin(0)
+	if _, err := ot.complete(ot.authorize(authURL), nil, nil); !errors.Is(err, ErrInvalidOAuthFlow) {
+		t.Errorf("got %v without the flow cookie, want ErrInvalidOAuthFlow", err)
+	}
+}
+
+func TestOAuthNonceMismatch(t *testing.T) {
+	ot := newOAuthTest(t)
+	ot.provider.SignInAs(oauthtest.Identity{Subject: "1", Username: "steve", Groups: []string{"players"}})
+
+	// the provider puts the nonce it was sent into the ID token
+	authURL, cookies := ot.begin(0)
+	q := authURL.Query()
+	q.Set("nonce", "replayed")
+	authURL.RawQuery = q.Encode()
+
+	_, err := ot.complete(ot.authorize(authURL), cookies, nil)
+	if err == nil || !strings.Contains(err.Error(), "nonce does not match") {
+		t.Errorf("got %v, want a nonce mismatch", err)
+	}
+
+	users, err := ot.query.ListUsers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("a user was provisioned: %+v", users)
+	}
+}
+
+func TestOAuthRefusesSuperRole(t *testing.T) {
+	for _, role := range []string{"super", "Super"} {
+		_, err := NewOAuthManager(OAuthParams{
+			Options: &OAuthOptions{
+				Providers: []OAuthProviderOptions{{
+					Name:     "test",
+					Type:     ProviderTypeOIDC,
+					ClientID: "herobrian",
+					Issuer:   "https://issuer.test",
+					Roles:    map[string]string{"owners": role},
+				}},
+			},
+			Session: testSessionOptions(),
+			Cookie:  testCookie,
+		})
+		if err == nil || !strings.Contains(err.Error(), "cannot be provisioned") {
+			t.Errorf("mapping to %q returned %v, want an error", role, err)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/securecookie"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/config"
+	"go.uber.org/fx"
+
+	"github.com/bdreece/herobrian/pkg/database"
+)
+
+// ceremonyMaxAge bounds the time between beginning and finishing a passkey
+// registration or sign-in.
+const ceremonyMaxAge = 5 * time.Minute
+
+var (
+	ErrNoCeremony     = errors.New("passkey ceremony is missing or has expired")
+	ErrInvalidPasskey = errors.New("passkey could not be verified")
+	ErrPasskeyCloned  = errors.New("passkey signature counter went backwards, it may have been cloned")
+)
+
+type (
+	PasskeyOptions struct {
+		// RPID is the domain passkeys are scoped to. It must be the host of
+		// every origin, or a registrable suffix of it.
+		RPID          string   `yaml:"rp_id"`
+		RPDisplayName string   `yaml:"rp_display_name"`
+		RPOrigins     []string `yaml:"rp_origins"`
+	}
+
+	// PasskeyManager registers WebAuthn credentials and verifies passkey
+	// sign-ins. Ceremony state is kept in a short-lived cookie between the
+	// begin and finish requests.
+	PasskeyManager struct {
+		db       database.Querier
+		webauthn *webauthn.WebAuthn
+		codecs   []securecookie.Codec
+		cookie   *CookieOptions
+	}
+
+	PasskeyParams struct {
+		fx.In
+
+		Options *PasskeyOptions
+		Session *SessionOptions
+		Cookie  *CookieOptions
+		Querier database.Querier
+	}
+
+	// passkeyUser adapts a user and their stored passkeys to webauthn.User.
+	passkeyUser struct {
+		user        *database.User
+		credentials []webauthn.Credential
+	}
+)
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return userHandle(u.user.ID) }
+func (u *passkeyUser) WebAuthnName() string                       { return u.user.Username }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return u.user.Username }
+func (u *passkeyUser) WebAuthnIcon() string                       { return "" }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// BeginRegistration returns the options passed to navigator.credentials.create.
+// Passkeys the user already has are excluded so an authenticator is not
+// registered twice.
+func (m *PasskeyManager) BeginRegistration(c echo.Context, claims *ClaimSet) (*protocol.CredentialCreation, error) {
+	user, err := m.findUser(c.Request().Context(), claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, len(user.credentials))
+	for i, cred := range user.credentials {
+		exclusions[i] = cred.Descriptor()
+	}
+
+	creation, session, err := m.webauthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin passkey registration: %w", err)
+	}
+
+	if err = m.setCeremony(c, session); err != nil {
+		return nil, err
+	}
+
+	return creation, nil
+}
+
+// FinishRegistration verifies the credential in the request body and stores
+// it under the given name.
+func (m *PasskeyManager) FinishRegistration(c echo.Context, claims *ClaimSet, name string) error {
+	session, err := m.ceremony(c)
+	if err != nil {
+		return err
+	}
+	m.ClearCeremony(c)
+
+	ctx := c.Request().Context()
+	user, err := m.findUser(ctx, claims.ID)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(c.Request().Body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPasskey, err)
+	}
+
+	cred, err := m.webauthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPasskey, err)
+	}
+
+	transports := make([]string, len(cred.Transport))
+	for i, t := range cred.Transport {
+		transports[i] = string(t)
+	}
+
+	_, err = m.db.CreatePasskey(ctx, database.CreatePasskeyParams{
+		UserID:          claims.ID,
+		CredentialID:    cred.ID,
+		Name:            name,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		Aaguid:          cred.Authenticator.AAGUID,
+		SignCount:       int64(cred.Authenticator.SignCount),
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store passkey: %w", err)
+	}
+
+	return nil
+}
+
+// BeginLogin returns the options passed to navigator.credentials.get. No
+// username is needed; the authenticator offers the passkeys it holds.
+func (m *PasskeyManager) BeginLogin(c echo.Context) (*protocol.CredentialAssertion, error) {
+	assertion, session, err := m.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationPreferred),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin passkey login: %w", err)
+	}
+
+	if err = m.setCeremony(c, session); err != nil {
+		return nil, err
+	}
+
+	return assertion, nil
+}
+
+// FinishLogin verifies the assertion in the request body and returns the
+// user it belongs to. verified reports whether the authenticator checked the
+// user's PIN or biometric, rather than only their presence.
+func (m *PasskeyManager) FinishLogin(c echo.Context) (user *database.User, verified bool, err error) {
+	session, err := m.ceremony(c)
+	if err != nil {
+		return nil, false, err
+	}
+	m.ClearCeremony(c)
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(c.Request().Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrInvalidPasskey, err)
+	}
+
+	ctx := c.Request().Context()
+	var owner *passkeyUser
+	cred, err := m.webauthn.ValidateDiscoverableLogin(func(rawID, handle []byte) (webauthn.User, error) {
+		passkey, err := m.db.FindPasskeyByCredentialID(ctx, rawID)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(handle, userHandle(passkey.UserID)) {
+			return nil, errors.New("user handle does not match passkey")
+		}
+
+		owner, err = m.findUser(ctx, passkey.UserID)
+		return owner, err
+	}, *session, parsed)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrInvalidPasskey, err)
+	}
+	if cred.Authenticator.CloneWarning {
+		return nil, false, ErrPasskeyCloned
+	}
+
+	passkey, err := m.db.FindPasskeyByCredentialID(ctx, cred.ID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find passkey: %w", err)
+	}
+
+	now := time.Now().UTC()
+	err = m.db.UsePasskey(ctx, database.UsePasskeyParams{
+		SignCount:   int64(cred.Authenticator.SignCount),
+		BackupState: cred.Flags.BackupState,
+		LastUsedAt:  &now,
+		ID:          passkey.ID,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to record passkey use: %w", err)
+	}
+
+	return owner.user, cred.Flags.UserVerified, nil
+}
+
+// ClearCeremony removes the ceremony cookie.
+func (m *PasskeyManager) ClearCeremony(c echo.Context) {
+	c.SetCookie(m.ceremonyCookie("", -1))
+}
+
+func (m *PasskeyManager) findUser(ctx context.Context, id int64) (*passkeyUser, error) {
+	user, err := m.db.FindUser(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	passkeys, err := m.db.ListPasskeys(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+
+	credentials := make([]webauthn.Credential, len(passkeys))
+	for i, p := range passkeys {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(p.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              p.CredentialID,
+			PublicKey:       p.PublicKey,
+			AttestationType: p.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: p.BackupEligible,
+				BackupState:    p.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    p.Aaguid,
+				SignCount: uint32(p.SignCount),
+			},
+		}
+	}
+
+	return &passkeyUser{&user, credentials}, nil
+}
+
+func (m *PasskeyManager) setCeremony(c echo.Context, session *webauthn.SessionData) error {
+	value, err := securecookie.EncodeMulti(m.ceremonyName(), session, m.codecs...)
+	if err != nil {
+		return fmt.Errorf("failed to encode passkey ceremony: %w", err)
+	}
+
+	c.SetCookie(m.ceremonyCookie(value, int(ceremonyMaxAge.Seconds())))
+	return nil
+}
+
+func (m *PasskeyManager) ceremony(c echo.Context) (*webauthn.SessionData, error) {
+	cookie, err := c.Cookie(m.ceremonyName())
+	if err != nil {
+		return nil, ErrNoCeremony
+	}
+
+	session := new(webauthn.SessionData)
+	if err = securecookie.DecodeMulti(m.ceremonyName(), cookie.Value, session, m.codecs...); err != nil {
+		return nil, ErrNoCeremony
+	}
+
+	return session, nil
+}
+
+func (m *PasskeyManager) ceremonyName() string {
+	return m.cookie.Name + "-passkey"
+}
+
+func (m *PasskeyManager) ceremonyCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.ceremonyName(),
+		Value:    value,
+		Path:     m.cookie.Path,
+		Domain:   m.cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   m.cookie.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// userHandle is the opaque WebAuthn user ID. It is returned by the
+// authenticator on sign-in, identifying the user without a username.
+func userHandle(id int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+func ConfigurePasskey(provider config.Provider) (*PasskeyOptions, error) {
+	opts := new(PasskeyOptions)
+	if err := provider.Get("passkey").Populate(opts); err != nil {
+		return nil, fmt.Errorf("failed to configure passkey options: %w", err)
+	}
+
+	return opts, nil
+}
+
+func NewPasskeyManager(p PasskeyParams) (*PasskeyManager, error) {
+	displayName := p.Options.RPDisplayName
+	if displayName == "" {
+		displayName = "herobrian"
+	}
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          p.Options.RPID,
+		RPDisplayName: displayName,
+		RPOrigins:     p.Options.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: ceremonyMaxAge, TimeoutUVD: ceremonyMaxAge},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: ceremonyMaxAge, TimeoutUVD: ceremonyMaxAge},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure webauthn: %w", err)
+	}
+
+	// session data holds protocol types that gob cannot encode without
+	// registration, so the ceremony is serialized as JSON
+	codecs, err := p.Session.Codecs(ceremonyMaxAge, securecookie.JSONEncoder{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyManager{
+		db:       p.Querier,
+		webauthn: wa,
+		codecs:   codecs,
+		cookie:   p.Cookie,
+	}, nil
+}
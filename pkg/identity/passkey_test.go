@@ -0,0 +1,229 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/identity/passkeytest"
+)
+
+const passkeyOrigin = "https://herobrian.test"
+
+type passkeyTest struct {
+	*testing.T
+
+	manager *PasskeyManager
+	query   database.Querier
+	echo    *echo.Echo
+}
+
+func newPasskeyTest(t *testing.T) *passkeyTest {
+	query := database.NewQuerier(openDB(t))
+	manager, err := NewPasskeyManager(PasskeyParams{
+		Options: &PasskeyOptions{
+			RPID:      "herobrian.test",
+			RPOrigins: []string{passkeyOrigin},
+		},
+		Session: testSessionOptions(),
+		Cookie:  testCookie,
+		Querier: query,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &passkeyTest{t, manager, query, echo.New()}
+}
+
+// context returns a request carrying the cookies and body, and the recorder
+// of its response.
+func (pt *passkeyTest) context(cookies []*http.Cookie, body []byte) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	return pt.echo.NewContext(req, rec), rec
+}
+
+func (pt *passkeyTest) register(authenticator *passkeytest.Authenticator, claims *ClaimSet, name string) error {
+	pt.Helper()
+
+	c, rec := pt.context(nil, nil)
+	creation, err := pt.manager.BeginRegistration(c, claims)
+	if err != nil {
+		pt.Fatalf("failed to begin registration: %v", err)
+	}
+
+	body, err := authenticator.Create(creation)
+	if err != nil {
+		return err
+	}
+
+	c, _ = pt.context(rec.Result().Cookies(), body)
+	return pt.manager.FinishRegistration(c, claims, name)
+}
+
+func (pt *passkeyTest) login(authenticator *passkeytest.Authenticator) (*database.User, bool, error) {
+	pt.Helper()
+
+	c, rec := pt.context(nil, nil)
+	assertion, err := pt.manager.BeginLogin(c)
+	if err != nil {
+		pt.Fatalf("failed to begin login: %v", err)
+	}
+
+	body, err := authenticator.Get(assertion)
+	if err != nil {
+		pt.Fatalf("authenticator refused to sign: %v", err)
+	}
+
+	c, _ = pt.context(rec.Result().Cookies(), body)
+	return pt.manager.FinishLogin(c)
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	pt := newPasskeyTest(t)
+	steve := createUser(t, pt.query, "steve", RoleUser)
+	claims := &ClaimSet{ID: steve.ID, Username: steve.Username}
+	authenticator := &passkeytest.Authenticator{Origin: passkeyOrigin, UserVerification: true}
+
+	if err := pt.register(authenticator, claims, "laptop"); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+
+	passkeys, err := pt.query.ListPasskeys(context.Background(), steve.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 || passkeys[0].Name != "laptop" || passkeys[0].SignCount != 0 || len(passkeys[0].PublicKey) == 0 {
+		t.Errorf("unexpected passkeys: %+v", passkeys)
+	}
+
+	// the registered passkey is excluded from a second registration
+	if err = pt.register(authenticator, claims, "again"); !errors.Is(err, passkeytest.ErrExcluded) {
+		t.Errorf("registering twice returned %v, want ErrExcluded", err)
+	}
+
+	// nor can a response be finished without its ceremony
+	c, _ := pt.context(nil, nil)
+	if err = pt.manager.FinishRegistration(c, claims, "laptop"); !errors.Is(err, ErrNoCeremony) {
+		t.Errorf("finishing without a ceremony returned %v, want ErrNoCeremony", err)
+	}
+
+	// a response for another origin is refused
+	phishing := &passkeytest.Authenticator{Origin: "https://herobrian.example", UserVerification: true}
+	if err = pt.register(phishing, claims, "phone"); !errors.Is(err, ErrInvalidPasskey) {
+		t.Errorf("registering from another origin returned %v, want ErrInvalidPasskey", err)
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	pt := newPasskeyTest(t)
+	steve := createUser(t, pt.query, "steve", RoleUser)
+	alex := createUser(t, pt.query, "alex", RoleUser)
+
+	steveKey := &passkeytest.Authenticator{Origin: passkeyOrigin, UserVerification: true}
+	alexKey := &passkeytest.Authenticator{Origin: passkeyOrigin, UserVerification: true}
+	if err := pt.register(steveKey, &ClaimSet{ID: steve.ID}, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pt.register(alexKey, &ClaimSet{ID: alex.ID}, "phone"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []*database.User{steve, alex, steve} {
+		key := steveKey
+		if want.ID == alex.ID {
+			key = alexKey
+		}
+
+		user, verified, err := pt.login(key)
+		if err != nil {
+			t.Fatalf("failed to sign in as %s: %v", want.Username, err)
+		}
+		if user.ID != want.ID || !verified {
+			t.Errorf("signed in as %s (verified %v), want %s", user.Username, verified, want.Username)
+		}
+	}
+
+	passkeys, err := pt.query.ListPasskeys(context.Background(), steve.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 || passkeys[0].SignCount != 2 || passkeys[0].LastUsedAt == nil {
+		t.Errorf("passkey use was not recorded: %+v", passkeys)
+	}
+
+	// a removed passkey is refused
+	if err = pt.query.RemovePasskeysByUser(context.Background(), steve.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = pt.login(steveKey); !errors.Is(err, ErrInvalidPasskey) {
+		t.Errorf("signing in with a removed passkey returned %v, want ErrInvalidPasskey", err)
+	}
+}
+
+func TestPasskeyCloneDetection(t *testing.T) {
+	pt := newPasskeyTest(t)
+	steve := createUser(t, pt.query, "steve", RoleUser)
+	original := &passkeytest.Authenticator{Origin: passkeyOrigin, UserVerification: true}
+	if err := pt.register(original, &ClaimSet{ID: steve.ID}, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pt.login(original); err != nil {
+		t.Fatal(err)
+	}
+
+	// the clone starts from the same counter, which the original advances
+	clone := original.Clone()
+	if _, _, err := pt.login(original); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := pt.login(clone); !errors.Is(err, ErrPasskeyCloned) {
+		t.Errorf("signing in with a stale counter returned %v, want ErrPasskeyCloned", err)
+	}
+
+	passkeys, err := pt.query.ListPasskeys(context.Background(), steve.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 || passkeys[0].SignCount != 2 {
+		t.Errorf("the counter was changed by the clone: %+v", passkeys)
+	}
+}
+
+func TestPasskeyUserVerification(t *testing.T) {
+	pt := newPasskeyTest(t)
+	steve := createUser(t, pt.query, "steve", RoleUser)
+
+	// a security key without a PIN only proves the user is present
+	authenticator := &passkeytest.Authenticator{Origin: passkeyOrigin}
+	if err := pt.register(authenticator, &ClaimSet{ID: steve.ID}, "key"); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+
+	user, verified, err := pt.login(authenticator)
+	if err != nil {
+		t.Fatalf("failed to sign in: %v", err)
+	}
+	if user.ID != steve.ID || verified {
+		t.Errorf("signed in as %s with verified %v, want %s unverified", user.Username, verified, steve.Username)
+	}
+
+	authenticator.UserVerification = true
+	if _, verified, err = pt.login(authenticator); err != nil || !verified {
+		t.Errorf("sign-in with user verification returned verified %v, %v", verified, err)
+	}
+}
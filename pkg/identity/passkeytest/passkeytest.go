@@ -0,0 +1,262 @@
+// Package passkeytest provides a software WebAuthn authenticator for
+// exercising passkey registration and sign-in without a browser.
+package passkeytest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+var (
+	ErrExcluded     = errors.New("authenticator already holds an excluded credential")
+	ErrNoCredential = errors.New("authenticator holds no matching credential")
+)
+
+type (
+	// Authenticator holds discoverable ES256 credentials and answers
+	// navigator.credentials.create and get as a browser would for Origin.
+	// Responses are the JSON bodies posted to the finish endpoints.
+	Authenticator struct {
+		Origin string
+		// UserVerification sets the UV flag, as if the user entered a PIN
+		// or used a biometric.
+		UserVerification bool
+
+		mu          sync.Mutex
+		credentials []*credential
+	}
+
+	credential struct {
+		id         []byte
+		rpID       string
+		userHandle []byte
+		key        *ecdsa.PrivateKey
+		counter    uint32
+	}
+
+	attestationObject struct {
+		Format    string         `cbor:"fmt"`
+		Statement map[string]any `cbor:"attStmt"`
+		AuthData  []byte         `cbor:"authData"`
+	}
+
+	clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+)
+
+// Create makes a new credential for the relying party and user in the
+// options, returning the registration response.
+func (a *Authenticator) Create(creation *protocol.CredentialCreation) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	opts := creation.Response
+	for _, excluded := range opts.CredentialExcludeList {
+		if a.find(opts.RelyingParty.ID, excluded.CredentialID) != nil {
+			return nil, ErrExcluded
+		}
+	}
+
+	handle, err := userHandle(opts.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &credential{
+		id:         make([]byte, 16),
+		rpID:       opts.RelyingParty.ID,
+		userHandle: handle,
+		key:        key,
+	}
+	if _, err = rand.Read(cred.id); err != nil {
+		return nil, err
+	}
+
+	publicKey, err := webauthncbor.Marshal(&webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: key.X.FillBytes(make([]byte, 32)),
+		YCoord: key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authData(cred, flagAttestedData)
+	authData = append(authData, make([]byte, 16)...) // zero AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(cred.id)))
+	authData = append(authData, cred.id...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(&attestationObject{
+		Format:    "none",
+		Statement: map[string]any{},
+		AuthData:  authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataJSON, err := a.clientData("webauthn.create", opts.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.credentials = append(a.credentials, cred)
+
+	return json.Marshal(map[string]any{
+		"id":    encode(cred.id),
+		"rawId": encode(cred.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encode(clientDataJSON),
+			"attestationObject": encode(attestation),
+			"transports":        []string{"internal"},
+		},
+	})
+}
+
+// Get signs the challenge with a credential for the relying party, limited
+// to the allowed credentials if any are given, returning the sign-in
+// response.
+func (a *Authenticator) Get(assertion *protocol.CredentialAssertion) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	opts := assertion.Response
+
+	var cred *credential
+	if len(opts.AllowedCredentials) == 0 {
+		cred = a.find(opts.RelyingPartyID, nil)
+	}
+	for _, allowed := range opts.AllowedCredentials {
+		if cred = a.find(opts.RelyingPartyID, allowed.CredentialID); cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return nil, ErrNoCredential
+	}
+
+	cred.counter++
+	authData := a.authData(cred, 0)
+
+	clientDataJSON, err := a.clientData("webauthn.get", opts.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(slices.Clone(authData), hash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"id":    encode(cred.id),
+		"rawId": encode(cred.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encode(clientDataJSON),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(cred.userHandle),
+		},
+	})
+}
+
+// Clone returns an authenticator holding copies of the credentials, with the
+// same signature counters, for simulating a cloned key.
+func (a *Authenticator) Clone() *Authenticator {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	clone := &Authenticator{Origin: a.Origin, UserVerification: a.UserVerification}
+	for _, cred := range a.credentials {
+		c := *cred
+		clone.credentials = append(clone.credentials, &c)
+	}
+
+	return clone
+}
+
+// find returns the newest credential for the relying party, matching id if
+// it is not nil.
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for i := len(a.credentials) - 1; i >= 0; i-- {
+		cred := a.credentials[i]
+		if cred.rpID == rpID && (id == nil || string(cred.id) == string(id)) {
+			return cred
+		}
+	}
+
+	return nil
+}
+
+func (a *Authenticator) authData(cred *credential, flags byte) []byte {
+	flags |= flagUserPresent
+	if a.UserVerification {
+		flags |= flagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, cred.counter)
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) ([]byte, error) {
+	return json.Marshal(&clientData{
+		Type:      ceremony,
+		Challenge: encode(challenge),
+		Origin:    a.Origin,
+	})
+}
+
+// userHandle decodes the user ID, which the relying party may send as raw
+// bytes or as a base64url string.
+func userHandle(id any) ([]byte, error) {
+	switch v := id.(type) {
+	case []byte:
+		return v, nil
+	case protocol.URLEncodedBase64:
+		return v, nil
+	case string:
+		return base64.RawURLEncoding.DecodeString(v)
+	default:
+		return nil, errors.New("unsupported user id type")
+	}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
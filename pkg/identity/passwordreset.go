@@ -2,40 +2,189 @@ package identity
 
 import (
 	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bdreece/herobrian/pkg/database"
 	"github.com/bdreece/herobrian/pkg/email"
 	"github.com/bdreece/herobrian/pkg/token"
 	"go.uber.org/fx"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidPassword   = errors.New("invalid password")
+	ErrInvalidResetToken = errors.New("password reset token is invalid or has already been used")
 )
 
 type (
 	passwordManager struct {
-		client  email.Client
-		handler token.Handler[token.PasswordResetClaims]
+		db        database.Querier
+		client    email.Client
+		templates *email.Templates
+		handler   token.Handler[token.PasswordResetClaims]
+		opts      *token.Options
 	}
 
 	PasswordManagerParams struct {
 		fx.In
 
+		Querier      database.Querier
 		EmailClient  email.Client
+		Templates    *email.Templates
 		TokenHandler token.Handler[token.PasswordResetClaims]
+		TokenOptions *token.Options `name:"password_reset"`
 	}
 )
 
 // ConfirmPasswordReset implements PasswordManager.
-func (p *passwordManager) ConfirmPasswordReset(ctx context.Context, email string, password string, confirmation string) error {
-	panic("unimplemented")
+func (p *passwordManager) ConfirmPasswordReset(ctx context.Context, resetToken string, password string) error {
+	claims, err := p.handler.Verify(resetToken)
+	if err != nil {
+		return errors.Join(ErrInvalidResetToken, err)
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// the session version only matches until the first reset succeeds
+	n, err := p.db.ResetUserPassword(ctx, database.ResetUserPasswordParams{
+		PasswordHash:   hash,
+		ID:             int64(claims.UserID),
+		SessionVersion: claims.Version,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	if n == 0 {
+		return ErrInvalidResetToken
+	}
+
+	if _, err = p.db.RemoveUserSessions(ctx, int64(claims.UserID)); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
 }
 
-// SendPasswordReset implements PasswordManager.
-func (p *passwordManager) SendPasswordReset(ctx context.Context, email string) error {
-	panic("unimplemented")
+// SendPasswordReset implements PasswordManager. No error is returned for
+// addresses without a verified account, so as not to disclose them.
+func (p *passwordManager) SendPasswordReset(ctx context.Context, address string, resetURL string) error {
+	user, err := p.db.FindUserByEmail(ctx, &address)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if user.Disabled {
+		return nil
+	}
+
+	t, err := p.handler.Sign(&token.PasswordResetClaims{
+		UserID:  int(user.ID),
+		Version: user.SessionVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign password reset token: %w", err)
+	}
+
+	msg, err := p.templates.Render("password-reset", email.Address{
+		Name:  user.Username,
+		Email: address,
+	}, map[string]any{
+		"Username": user.Username,
+		"URL":      resetURL + "/" + t,
+		"ValidFor": p.opts.ValidFor,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render password reset email: %w", err)
+	}
+
+	return p.client.Send(ctx, msg)
 }
 
 // SetPassword implements PasswordManager.
 func (p *passwordManager) SetPassword(ctx context.Context, claims *ClaimSet, oldPassword string, newPassword string) error {
-	panic("unimplemented")
+	user, err := p.db.FindUser(ctx, claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if err = ComparePassword(user.PasswordHash, oldPassword); err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		PasswordHash: hash,
+		ID:           user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	// every other session is signed out
+	_, err = p.db.RemoveOtherUserSessions(ctx, database.RemoveOtherUserSessionsParams{
+		UserID: user.ID,
+		ID:     claims.SessionID,
+	})
+
+	return err
+}
+
+// dummyHash is compared against when there is no stored hash, so an unknown
+// user or one without a password takes as long to reject as a wrong password.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("herobrian"), bcrypt.DefaultCost)
+	return hash
+})
+
+// ComparePassword checks a password against a stored, base64-encoded bcrypt
+// hash. An empty hash never matches.
+func ComparePassword(encodedHash, password string) error {
+	if encodedHash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return ErrInvalidPassword
+	}
+
+	hash, err := base64.StdEncoding.DecodeString(encodedHash)
+	if err != nil {
+		return fmt.Errorf("failed to decode user password hash: %w", err)
+	}
+
+	if err = bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return errors.Join(ErrInvalidPassword, err)
+	}
+
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(hash), nil
 }
 
 func NewPasswordResetManager(p PasswordManagerParams) PasswordManager {
-	return &passwordManager{p.EmailClient, p.TokenHandler}
+	return &passwordManager{
+		db:        p.Querier,
+		client:    p.EmailClient,
+		templates: p.Templates,
+		handler:   p.TokenHandler,
+		opts:      p.TokenOptions,
+	}
 }
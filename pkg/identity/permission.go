@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+type Permission string
+
+const (
+	PermissionLinodeBoot      Permission = "linode.boot"
+	PermissionLinodePower     Permission = "linode.power"
+	PermissionUnitStart       Permission = "unit.start"
+	PermissionUnitStop        Permission = "unit.stop"
+	PermissionUnitEnable      Permission = "unit.enable"
+	PermissionUnitConsole     Permission = "unit.console"
+	PermissionInviteCreate    Permission = "invite.create"
+	PermissionUsersManage     Permission = "users.manage"
+	PermissionAuditView       Permission = "audit.view"
+	PermissionDiagnosticsView Permission = "diagnostics.view"
+	PermissionOutboxManage    Permission = "outbox.manage"
+)
+
+// UnitPermissions may be granted to individual users for a single unit.
+var UnitPermissions = []Permission{
+	PermissionUnitStart,
+	PermissionUnitStop,
+	PermissionUnitEnable,
+	PermissionUnitConsole,
+}
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser: {
+		PermissionLinodeBoot,
+		PermissionUnitStart,
+	},
+	RoleModerator: {
+		PermissionLinodePower,
+		PermissionUnitStop,
+		PermissionUnitConsole,
+		PermissionInviteCreate,
+	},
+	RoleAdmin: {
+		PermissionUnitEnable,
+		PermissionUsersManage,
+		PermissionAuditView,
+		PermissionDiagnosticsView,
+		PermissionOutboxManage,
+	},
+}
+
+// Permissions returns the permissions held by the role, including those
+// inherited from every lesser role.
+func (r Role) Permissions() []Permission {
+	perms := make([]Permission, 0)
+	for role := RoleUser; role <= r; role++ {
+		perms = append(perms, rolePermissions[role]...)
+	}
+
+	return perms
+}
+
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(r.Permissions(), p)
+}
+
+func (p Permission) IsUnitPermission() bool {
+	return slices.Contains(UnitPermissions, p)
+}
+
+// Authorize implements Authorizer, checking only the permissions granted
+// by the claimed role.
+func (p Permission) Authorize(claims *ClaimSet) error {
+	if !Role(claims.Role).Can(p) || !claims.InScope(p) {
+		return errors.Join(
+			fmt.Errorf("failed to authorize user for permission: %q", p),
+			ErrUnauthorized,
+		)
+	}
+
+	return nil
+}
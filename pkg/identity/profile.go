@@ -0,0 +1,349 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"time"
+
+	"go.uber.org/fx"
+
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/mojang"
+)
+
+const (
+	AvatarSize = 128
+	// MaxAvatarBytes bounds an uploaded avatar before it is decoded.
+	MaxAvatarBytes = 1 << 20
+	// maxAvatarPixels bounds the dimensions of an uploaded avatar, so a
+	// small file cannot decode into a huge image.
+	maxAvatarPixels = 4096 * 4096
+)
+
+// AvatarSource records where the avatar of a user came from.
+type AvatarSource string
+
+const (
+	AvatarNone   AvatarSource = ""
+	AvatarMojang AvatarSource = "mojang"
+	AvatarUpload AvatarSource = "upload"
+)
+
+var (
+	ErrMinecraftUsernameTaken = errors.New("minecraft account is linked to another user")
+	ErrNoMinecraftUsername    = errors.New("no minecraft username is set")
+	ErrInvalidAvatar          = errors.New("avatar must be a PNG, JPEG or GIF image of at most 1 MiB and 4096x4096 pixels")
+)
+
+type (
+	Profile struct {
+		FirstName         string
+		LastName          string
+		DisplayName       string
+		MinecraftUsername string
+	}
+
+	// ProfileManager updates the names and avatars of users. Minecraft
+	// usernames are checked against Mojang, and their avatars are drawn
+	// from the account's skin.
+	ProfileManager struct {
+		db     *sql.DB
+		query  database.Querier
+		mojang mojang.Client
+	}
+
+	ProfileParams struct {
+		fx.In
+
+		DB      *sql.DB
+		Querier database.Querier
+		Mojang  mojang.Client
+	}
+)
+
+// NewClaimSet reads the claims of a user. The email address is only
+// claimed once it is verified.
+func NewClaimSet(user *database.User) *ClaimSet {
+	claims := &ClaimSet{
+		ID:          user.ID,
+		Username:    user.Username,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		DisplayName: user.DisplayName,
+		Role:        user.RoleID,
+		HasAvatar:   AvatarSource(user.AvatarSource) != AvatarNone,
+	}
+	if user.EmailVerified && user.Email != nil {
+		claims.Email = *user.Email
+	}
+
+	return claims
+}
+
+// UpdateProfile saves the profile of a user. A Minecraft username is
+// replaced by its canonical spelling, and a Mojang avatar follows the
+// account when it changes.
+func (m *ProfileManager) UpdateProfile(ctx context.Context, claims *ClaimSet, profile *Profile) error {
+	user, err := m.query.FindUser(ctx, claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	params := database.UpdateUserProfileParams{
+		FirstName:   strings.TrimSpace(profile.FirstName),
+		LastName:    strings.TrimSpace(profile.LastName),
+		DisplayName: strings.TrimSpace(profile.DisplayName),
+		ID:          claims.ID,
+	}
+
+	// an unchanged username is not looked up again, so the rest of the
+	// profile can be saved while Mojang is unreachable
+	var account *mojang.Profile
+	name := strings.TrimSpace(profile.MinecraftUsername)
+	if user.MinecraftUsername != nil && strings.EqualFold(*user.MinecraftUsername, name) {
+		params.MinecraftUsername = user.MinecraftUsername
+		params.MinecraftUuid = user.MinecraftUuid
+	} else if name != "" {
+		account, err = m.mojang.Profile(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to find minecraft account: %w", err)
+		}
+
+		params.MinecraftUsername = &account.Name
+		params.MinecraftUuid = &account.ID
+	}
+
+	var avatar []byte
+	changed := !equalPtr(user.MinecraftUuid, params.MinecraftUuid)
+	if changed && account != nil && AvatarSource(user.AvatarSource) == AvatarMojang {
+		if avatar, err = m.mojangAvatar(ctx, account.ID); err != nil {
+			return err
+		}
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := database.WithTx(m.db, tx)
+	if _, err = query.UpdateUserProfile(ctx, params); err != nil {
+		if database.IsUniqueViolation(err) {
+			return ErrMinecraftUsernameTaken
+		}
+
+		return fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	// an avatar drawn from an account the user unlinked is dropped
+	if changed && AvatarSource(user.AvatarSource) == AvatarMojang {
+		if avatar != nil {
+			err = setAvatar(ctx, query, claims.ID, AvatarMojang, avatar)
+		} else {
+			err = setAvatar(ctx, query, claims.ID, AvatarNone, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseMojangAvatar replaces the avatar of a user with the face of their
+// Minecraft skin.
+func (m *ProfileManager) UseMojangAvatar(ctx context.Context, claims *ClaimSet) error {
+	user, err := m.query.FindUser(ctx, claims.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+	if user.MinecraftUuid == nil {
+		return ErrNoMinecraftUsername
+	}
+
+	avatar, err := m.mojangAvatar(ctx, *user.MinecraftUuid)
+	if err != nil {
+		return err
+	}
+
+	return m.withTx(ctx, func(query database.Querier) error {
+		return setAvatar(ctx, query, claims.ID, AvatarMojang, avatar)
+	})
+}
+
+// UploadAvatar replaces the avatar of a user with an image, cropped to
+// a square and scaled to AvatarSize.
+func (m *ProfileManager) UploadAvatar(ctx context.Context, claims *ClaimSet, r io.Reader) error {
+	b, err := io.ReadAll(io.LimitReader(r, MaxAvatarBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(b) > MaxAvatarBytes {
+		return ErrInvalidAvatar
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil || cfg.Width*cfg.Height > maxAvatarPixels {
+		return ErrInvalidAvatar
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return ErrInvalidAvatar
+	}
+
+	avatar, err := encodeAvatar(resizeSquare(img, AvatarSize))
+	if err != nil {
+		return err
+	}
+
+	return m.withTx(ctx, func(query database.Querier) error {
+		return setAvatar(ctx, query, claims.ID, AvatarUpload, avatar)
+	})
+}
+
+// RemoveAvatar clears the avatar of a user.
+func (m *ProfileManager) RemoveAvatar(ctx context.Context, claims *ClaimSet) error {
+	return m.withTx(ctx, func(query database.Querier) error {
+		return setAvatar(ctx, query, claims.ID, AvatarNone, nil)
+	})
+}
+
+// Avatar reads the PNG avatar of a user, or sql.ErrNoRows if they have
+// none.
+func (m *ProfileManager) Avatar(ctx context.Context, userID int64) (*database.UserAvatar, error) {
+	avatar, err := m.query.FindUserAvatar(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &avatar, nil
+}
+
+func (m *ProfileManager) mojangAvatar(ctx context.Context, id string) ([]byte, error) {
+	skin, err := m.mojang.Skin(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download minecraft skin: %w", err)
+	}
+
+	face, err := mojang.Face(skin, AvatarSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeAvatar(face)
+}
+
+func (m *ProfileManager) withTx(ctx context.Context, fn func(database.Querier) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = fn(database.WithTx(m.db, tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func NewProfileManager(p ProfileParams) *ProfileManager {
+	return &ProfileManager{
+		db:     p.DB,
+		query:  p.Querier,
+		mojang: p.Mojang,
+	}
+}
+
+func setAvatar(ctx context.Context, query database.Querier, userID int64, source AvatarSource, image []byte) error {
+	var err error
+	if source == AvatarNone {
+		err = query.RemoveUserAvatar(ctx, userID)
+	} else {
+		err = query.UpsertUserAvatar(ctx, database.UpsertUserAvatarParams{
+			UserID:    userID,
+			Image:     image,
+			UpdatedAt: time.Now().UTC(),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save avatar: %w", err)
+	}
+
+	_, err = query.UpdateUserAvatarSource(ctx, database.UpdateUserAvatarSourceParams{
+		AvatarSource: string(source),
+		ID:           userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update avatar source: %w", err)
+	}
+
+	return nil
+}
+
+func encodeAvatar(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode avatar: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// resizeSquare crops the centre square of an image and scales it to size,
+// averaging the source pixels under each destination pixel.
+func resizeSquare(img image.Image, size int) *image.NRGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	out := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy0, sy1 := y0+y*side/size, y0+max((y+1)*side/size, y*side/size+1)
+		for x := 0; x < size; x++ {
+			sx0, sx1 := x0+x*side/size, x0+max((x+1)*side/size, x*side/size+1)
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					c := color.NRGBA64Model.Convert(img.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+
+			out.Set(x, y, color.NRGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return out
+}
+
+func equalPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
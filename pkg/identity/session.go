@@ -1,16 +1,210 @@
 package identity
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"time"
 
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"go.uber.org/config"
+
+	"github.com/bdreece/herobrian/pkg/database"
+)
+
+// ErrInvalidSessionCookie is returned with a new session when the cookie
+// was issued by another store or under other keys.
+var ErrInvalidSessionCookie = errors.New("session cookie cannot be decoded")
+
+// UserIDKey is the session value holding the signed in user's ID. It is the
+// only value persisted by SessionStore.
+const UserIDKey = "user_id"
+
+// touchInterval limits how often a session's last-seen time is written.
+const touchInterval = time.Minute
+
+// sessionKeySize is the length of the HMAC key and of the AES-256 key which
+// protect cookies.
+const sessionKeySize = 32
+
+type (
+	SessionOptions struct {
+		SigningKey    string `yaml:"signing_key"`
+		EncryptionKey string `yaml:"encryption_key"`
+	}
+
+	// SessionStore is a [sessions.Store] which keeps sessions in the
+	// database. The cookie carries only the signed and encrypted session ID,
+	// so sessions can be listed and revoked server-side.
+	SessionStore struct {
+		db     database.Querier
+		codecs []securecookie.Codec
+		opts   *sessions.Options
+	}
 )
 
-type SessionOptions struct {
-	SigningKey    string `yaml:"signing_key"`
-	EncryptionKey string `yaml:"encryption_key"`
+// Get implements sessions.Store.
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New implements sessions.Store.
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	sess := sessions.NewSession(s, name)
+	opts := *s.opts
+	sess.Options = &opts
+	sess.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return sess, nil
+	}
+
+	var id string
+	if err = securecookie.DecodeMulti(name, cookie.Value, &id, s.codecs...); err != nil {
+		return sess, fmt.Errorf("%w: %w", ErrInvalidSessionCookie, err)
+	}
+
+	now := time.Now().UTC()
+	row, err := s.db.FindSession(r.Context(), database.FindSessionParams{
+		ID:  id,
+		Now: now,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return sess, nil
+	} else if err != nil {
+		return sess, fmt.Errorf("failed to find session: %w", err)
+	}
+
+	if now.Sub(row.LastSeenAt) > touchInterval {
+		err = s.db.TouchSession(r.Context(), database.TouchSessionParams{
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(time.Duration(s.opts.MaxAge) * time.Second),
+			RemoteAddr: remoteAddr(r),
+			ID:         row.ID,
+		})
+		if err != nil {
+			return sess, fmt.Errorf("failed to touch session: %w", err)
+		}
+	}
+
+	sess.ID = row.ID
+	sess.Values[UserIDKey] = row.UserID
+	sess.IsNew = false
+
+	return sess, nil
+}
+
+// Save implements sessions.Store. Deleting the session requires a negative
+// MaxAge; otherwise a session without an ID is created for the user in
+// [UserIDKey].
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, sess *sessions.Session) error {
+	ctx := r.Context()
+	if sess.Options.MaxAge < 0 {
+		if sess.ID != "" {
+			if _, err := s.db.RemoveSession(ctx, sess.ID); err != nil {
+				return fmt.Errorf("failed to remove session: %w", err)
+			}
+		}
+
+		http.SetCookie(w, sessions.NewCookie(sess.Name(), "", sess.Options))
+		return nil
+	}
+
+	if sess.ID == "" {
+		userID, ok := sess.Values[UserIDKey].(int64)
+		if !ok {
+			return fmt.Errorf("session has no %q value", UserIDKey)
+		}
+
+		if err := s.create(ctx, r, sess, userID); err != nil {
+			return err
+		}
+	}
+
+	encoded, err := securecookie.EncodeMulti(sess.Name(), sess.ID, s.codecs...)
+	if err != nil {
+		return fmt.Errorf("failed to encode session cookie: %w", err)
+	}
+
+	http.SetCookie(w, sessions.NewCookie(sess.Name(), encoded, sess.Options))
+	return nil
+}
+
+func (s *SessionStore) create(ctx context.Context, r *http.Request, sess *sessions.Session, userID int64) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	sess.ID = base64.RawURLEncoding.EncodeToString(b)
+
+	// expired sessions are swept whenever a new one is created
+	if _, err := s.db.RemoveExpiredSessions(ctx, now); err != nil {
+		return fmt.Errorf("failed to remove expired sessions: %w", err)
+	}
+
+	err := s.db.CreateSession(ctx, database.CreateSessionParams{
+		ID:         sess.ID,
+		UserID:     userID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(time.Duration(sess.Options.MaxAge) * time.Second),
+		UserAgent:  r.UserAgent(),
+		RemoteAddr: remoteAddr(r),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the user's unexpired sessions, most recently used first.
+func (s *SessionStore) List(ctx context.Context, userID int64) ([]database.Session, error) {
+	return s.db.ListUserSessions(ctx, database.ListUserSessionsParams{
+		UserID: userID,
+		Now:    time.Now().UTC(),
+	})
+}
+
+// Revoke removes one of the user's sessions.
+func (s *SessionStore) Revoke(ctx context.Context, userID int64, id string) error {
+	_, err := s.db.RemoveUserSession(ctx, database.RemoveUserSessionParams{
+		ID:     id,
+		UserID: userID,
+	})
+
+	return err
+}
+
+// RevokeOthers removes every session of the user except the one given.
+func (s *SessionStore) RevokeOthers(ctx context.Context, userID int64, id string) error {
+	_, err := s.db.RemoveOtherUserSessions(ctx, database.RemoveOtherUserSessionsParams{
+		UserID: userID,
+		ID:     id,
+	})
+
+	return err
+}
+
+// RevokeUser removes every session of the user.
+func (s *SessionStore) RevokeUser(ctx context.Context, userID int64) error {
+	_, err := s.db.RemoveUserSessions(ctx, userID)
+	return err
+}
+
+// RevokeAll removes every session except the one given.
+func (s *SessionStore) RevokeAll(ctx context.Context, id string) error {
+	_, err := s.db.RemoveAllSessions(ctx, id)
+	return err
 }
 
 func ConfigureSession(provider config.Provider) (*SessionOptions, error) {
@@ -22,16 +216,69 @@ func ConfigureSession(provider config.Provider) (*SessionOptions, error) {
 	return opts, nil
 }
 
-func NewSessionStore(opts *SessionOptions) (*sessions.CookieStore, error) {
+// Codecs returns the cookie codecs for the keys, which expire values after
+// maxAge and encode them with serializer, or gob if it is nil. Both keys
+// must be at least 32 bytes; only the first 32 are used.
+func (opts *SessionOptions) Codecs(maxAge time.Duration, serializer securecookie.Serializer) ([]securecookie.Codec, error) {
 	signingKey, err := base64.StdEncoding.DecodeString(opts.SigningKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode signing key: %w", err)
 	}
+	if len(signingKey) < sessionKeySize {
+		return nil, fmt.Errorf("signing key must be at least %d bytes, got %d", sessionKeySize, len(signingKey))
+	}
 
 	encryptionKey, err := base64.StdEncoding.DecodeString(opts.EncryptionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode encryption key: %w", err)
 	}
+	if len(encryptionKey) < sessionKeySize {
+		return nil, fmt.Errorf("encryption key must be at least %d bytes, got %d", sessionKeySize, len(encryptionKey))
+	}
+
+	codecs := securecookie.CodecsFromPairs(signingKey[:sessionKeySize], encryptionKey[:sessionKeySize])
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(int(maxAge.Seconds()))
+			if serializer != nil {
+				sc.SetSerializer(serializer)
+			}
+		}
+	}
+
+	return codecs, nil
+}
+
+func NewSessionStore(opts *SessionOptions, cookie *CookieOptions, db database.Querier) (*SessionStore, error) {
+	codecs, err := opts.Codecs(time.Duration(cookie.MaxAge)*time.Second, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	return sessions.NewCookieStore(signingKey[:32], encryptionKey[:32]), nil
+	return &SessionStore{
+		db:     db,
+		codecs: codecs,
+		opts:   cookie.SessionOptions(),
+	}, nil
 }
+
+type remoteAddrKey struct{}
+
+// WithRemoteAddr records the client address of a request, as extracted by
+// echo, for the store, which only has access to the request.
+func WithRemoteAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, remoteAddrKey{}, addr)
+}
+
+// remoteAddr falls back to the peer address when the request did not pass
+// through echo, so forwarding headers are never trusted here.
+func remoteAddr(r *http.Request) string {
+	if addr, ok := r.Context().Value(remoteAddrKey{}).(string); ok {
+		return addr
+	}
+
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return ip
+}
+
+var _ sessions.Store = (*SessionStore)(nil)
@@ -0,0 +1,62 @@
+package identity
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestSessionCodecs(t *testing.T) {
+	codecs, err := testSessionOptions().Codecs(time.Minute, securecookie.JSONEncoder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := securecookie.EncodeMulti("herobrian", map[string]string{"user": "steve"}, codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]string
+	if err = securecookie.DecodeMulti("herobrian", value, &decoded, codecs...); err != nil || decoded["user"] != "steve" {
+		t.Errorf("decoded %v, %v", decoded, err)
+	}
+	if err = securecookie.DecodeMulti("other", value, &decoded, codecs...); err == nil {
+		t.Error("decoded a value under another name")
+	}
+}
+
+func TestSessionKeyLengths(t *testing.T) {
+	key := func(n int) string {
+		return base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", n)))
+	}
+
+	for name, opts := range map[string]*SessionOptions{
+		"short signing key":       {SigningKey: key(16), EncryptionKey: key(32)},
+		"short encryption key":    {SigningKey: key(64), EncryptionKey: key(16)},
+		"missing keys":            {},
+		"undecodable signing key": {SigningKey: "not base64!", EncryptionKey: key(32)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewSessionStore(opts, testCookie, nil); err == nil {
+				t.Error("session store accepted the keys")
+			}
+			if _, err := NewTOTPManager(TOTPParams{Options: &TOTPOptions{EncryptionKey: key(32)}, Session: opts, Cookie: testCookie}); err == nil {
+				t.Error("totp manager accepted the keys")
+			}
+			if _, err := NewOAuthManager(OAuthParams{Options: new(OAuthOptions), Session: opts, Cookie: testCookie}); err == nil {
+				t.Error("oauth manager accepted the keys")
+			}
+			if _, err := NewPasskeyManager(PasskeyParams{
+				Options: &PasskeyOptions{RPID: "herobrian.test", RPOrigins: []string{passkeyOrigin}},
+				Session: opts,
+				Cookie:  testCookie,
+			}); err == nil {
+				t.Error("passkey manager accepted the keys")
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/config"
+	"go.uber.org/fx"
+)
+
+// sweepInterval bounds how often idle entries are dropped.
+const sweepInterval = time.Minute
+
+var ErrLockedOut = errors.New("too many failed sign-in attempts")
+
+type (
+	ThrottleOptions struct {
+		// UserAttempts and IPAttempts are the failed sign-ins allowed per
+		// username and per address within Window before locking them out.
+		UserAttempts int           `yaml:"user_attempts"`
+		IPAttempts   int           `yaml:"ip_attempts"`
+		Window       time.Duration `yaml:"window"`
+		// Lockout is the first lockout, doubled by each further lockout up
+		// to MaxLockout. The count resets once MaxLockout passes without a
+		// failure.
+		Lockout    time.Duration `yaml:"lockout"`
+		MaxLockout time.Duration `yaml:"max_lockout"`
+	}
+
+	// LoginThrottle locks out usernames and addresses after repeated failed
+	// sign-ins. State is kept in memory, so a restart clears it.
+	LoginThrottle struct {
+		opts   *ThrottleOptions
+		logger *slog.Logger
+
+		mu        sync.Mutex
+		entries   map[string]*throttleEntry
+		lastSweep time.Time
+	}
+
+	ThrottleParams struct {
+		fx.In
+
+		Options *ThrottleOptions
+		Logger  *slog.Logger
+	}
+
+	throttleEntry struct {
+		failures    int
+		windowStart time.Time
+		lastFailure time.Time
+		lockouts    int
+		lockedUntil time.Time
+	}
+)
+
+// Allow reports whether a sign-in may be attempted, or how long until it
+// may be if the address or username is locked out.
+func (t *LoginThrottle) Allow(ip, username string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+
+	var wait time.Duration
+	for _, key := range throttleKeys(ip, username) {
+		if e, ok := t.entries[key]; ok && now.Before(e.lockedUntil) {
+			wait = max(wait, e.lockedUntil.Sub(now))
+		}
+	}
+
+	return wait, wait == 0
+}
+
+// Fail records a failed sign-in, locking out the address or username if it
+// has failed too often.
+func (t *LoginThrottle) Fail(ip, username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweep(now)
+
+	for _, key := range throttleKeys(ip, username) {
+		limit := t.opts.UserAttempts
+		if strings.HasPrefix(key, "ip:") {
+			limit = t.opts.IPAttempts
+		}
+
+		e, ok := t.entries[key]
+		if !ok {
+			e = new(throttleEntry)
+			t.entries[key] = e
+		}
+		if now.Sub(e.lastFailure) > t.opts.MaxLockout {
+			e.lockouts = 0
+		}
+		if now.Sub(e.windowStart) > t.opts.Window {
+			e.failures, e.windowStart = 0, now
+		}
+
+		e.failures++
+		e.lastFailure = now
+		if e.failures < limit {
+			continue
+		}
+
+		lockout := t.opts.MaxLockout
+		if e.lockouts < 32 {
+			lockout = min(t.opts.Lockout<<e.lockouts, t.opts.MaxLockout)
+		}
+
+		e.lockouts++
+		e.failures = 0
+		e.lockedUntil = now.Add(lockout)
+
+		t.logger.Warn("sign-in locked out",
+			slog.String("key", key),
+			slog.Int("lockouts", e.lockouts),
+			slog.Duration("duration", lockout),
+		)
+	}
+}
+
+// Reset clears failures for the username after a successful sign-in. The
+// address is not cleared, so signing in to one account does not allow more
+// guesses at others.
+func (t *LoginThrottle) Reset(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.entries, userThrottleKey(username))
+}
+
+// sweep drops entries that are no longer locked out and have not failed
+// recently enough to affect a later lockout.
+func (t *LoginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < sweepInterval {
+		return
+	}
+
+	t.lastSweep = now
+	for key, e := range t.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.lastFailure) > max(t.opts.Window, t.opts.MaxLockout) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+func throttleKeys(ip, username string) []string {
+	keys := make([]string, 0, 2)
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	if username != "" {
+		keys = append(keys, userThrottleKey(username))
+	}
+
+	return keys
+}
+
+func userThrottleKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ConfigureThrottle(provider config.Provider) (*ThrottleOptions, error) {
+	opts := &ThrottleOptions{
+		UserAttempts: 5,
+		IPAttempts:   20,
+		Window:       15 * time.Minute,
+		Lockout:      time.Minute,
+		MaxLockout:   time.Hour,
+	}
+	if err := provider.Get("throttle").Populate(opts); err != nil {
+		return nil, fmt.Errorf("failed to configure throttle options: %w", err)
+	}
+
+	return opts, nil
+}
+
+func NewLoginThrottle(p ThrottleParams) *LoginThrottle {
+	return &LoginThrottle{
+		opts:    p.Options,
+		logger:  p.Logger,
+		entries: make(map[string]*throttleEntry),
+	}
+}
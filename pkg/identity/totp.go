@@ -0,0 +1,491 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/labstack/echo/v4"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/config"
+	"go.uber.org/fx"
+
+	"github.com/bdreece/herobrian/pkg/database"
+)
+
+const (
+	totpPeriod        = 30
+	totpSkew          = 1
+	totpQRSize        = 256
+	recoveryCodeCount = 10
+	// challengeMaxAge bounds the time between the password and code steps
+	// of a sign-in.
+	challengeMaxAge = 5 * time.Minute
+)
+
+var (
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTOTPRequired    = errors.New("two-factor authentication is required for your role")
+	ErrInvalidTOTPCode = errors.New("invalid authentication code")
+	ErrNoChallenge     = errors.New("sign-in challenge is missing or has expired")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type (
+	TOTPOptions struct {
+		Issuer string `yaml:"issuer"`
+		// EncryptionKey is a base64 encoded AES-256 key used to encrypt
+		// TOTP secrets at rest.
+		EncryptionKey string `yaml:"encryption_key"`
+	}
+
+	// TOTPEnrollment is shown while the user adds the secret to their
+	// authenticator app. QRCode is a base64 encoded PNG of URL.
+	TOTPEnrollment struct {
+		Secret string
+		URL    string
+		QRCode string
+	}
+
+	TOTPStatus struct {
+		Enabled       bool
+		Required      bool
+		RecoveryCodes int64
+	}
+
+	// TOTPManager enrolls users in time-based one-time passwords and checks
+	// the second step of sign-in. Secrets are stored encrypted, and each
+	// code is accepted at most once.
+	TOTPManager struct {
+		db     database.Querier
+		issuer string
+		aead   cipher.AEAD
+		codecs []securecookie.Codec
+		cookie *CookieOptions
+	}
+
+	TOTPParams struct {
+		fx.In
+
+		Options *TOTPOptions
+		Session *SessionOptions
+		Cookie  *CookieOptions
+		Querier database.Querier
+	}
+)
+
+// Status reports whether the user has enabled TOTP and whether their role
+// requires it.
+func (m *TOTPManager) Status(ctx context.Context, claims *ClaimSet) (*TOTPStatus, error) {
+	status := new(TOTPStatus)
+
+	required, err := m.db.FindRoleRequiresTOTP(ctx, claims.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find role policy: %w", err)
+	}
+	status.Required = required
+
+	row, err := m.db.FindUserTOTP(ctx, claims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find totp: %w", err)
+	}
+	status.Enabled = row.ConfirmedAt != nil
+
+	if status.Enabled {
+		status.RecoveryCodes, err = m.db.CountRecoveryCodes(ctx, claims.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+		}
+	}
+
+	return status, nil
+}
+
+// Enabled reports whether the user must enter a code to sign in.
+func (m *TOTPManager) Enabled(ctx context.Context, userID int64) (bool, error) {
+	row, err := m.db.FindUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to find totp: %w", err)
+	}
+
+	return row.ConfirmedAt != nil, nil
+}
+
+// Enroll generates a new secret for the user, replacing any enrollment that
+// was not confirmed.
+func (m *TOTPManager) Enroll(ctx context.Context, claims *ClaimSet) (*TOTPEnrollment, error) {
+	enabled, err := m.Enabled(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTOTPEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      m.issuer,
+		AccountName: claims.Username,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	secret, err := m.seal(claims.ID, key.Secret())
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.db.UpsertUserTOTP(ctx, database.UpsertUserTOTPParams{
+		UserID:    claims.ID,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %w", err)
+	}
+
+	img, err := key.Image(totpQRSize, totpQRSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render qr code: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode qr code: %w", err)
+	}
+
+	return &TOTPEnrollment{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+		QRCode: base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// Confirm enables TOTP once the user proves their app produces valid codes,
+// returning a fresh set of recovery codes.
+func (m *TOTPManager) Confirm(ctx context.Context, userID int64, code string) ([]string, error) {
+	row, err := m.db.FindUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTOTPNotEnabled
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find totp: %w", err)
+	}
+	if row.ConfirmedAt != nil {
+		return nil, ErrTOTPEnabled
+	}
+
+	step, err := m.match(&row, code)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	n, err := m.db.ConfirmUserTOTP(ctx, database.ConfirmUserTOTPParams{
+		ConfirmedAt:  &now,
+		LastUsedStep: step,
+		UserID:       userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm totp: %w", err)
+	}
+	if n == 0 {
+		return nil, ErrTOTPEnabled
+	}
+
+	return m.generateRecoveryCodes(ctx, userID)
+}
+
+// Verify checks a code from the user's authenticator app, or one of their
+// unused recovery codes.
+func (m *TOTPManager) Verify(ctx context.Context, userID int64, code string) error {
+	row, err := m.db.FindUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTOTPNotEnabled
+	} else if err != nil {
+		return fmt.Errorf("failed to find totp: %w", err)
+	}
+	if row.ConfirmedAt == nil {
+		return ErrTOTPNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != int(otp.DigitsSix) {
+		return m.useRecoveryCode(ctx, userID, code)
+	}
+
+	step, err := m.match(&row, code)
+	if err != nil {
+		return err
+	}
+
+	// the update only succeeds for a step later than the last one used,
+	// so a code cannot be replayed
+	n, err := m.db.UseUserTOTPStep(ctx, database.UseUserTOTPStepParams{
+		LastUsedStep: step,
+		UserID:       userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record totp step: %w", err)
+	}
+	if n == 0 {
+		return ErrInvalidTOTPCode
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes.
+func (m *TOTPManager) RegenerateRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	enabled, err := m.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrTOTPNotEnabled
+	}
+
+	return m.generateRecoveryCodes(ctx, userID)
+}
+
+// Disable removes the user's secret and recovery codes.
+func (m *TOTPManager) Disable(ctx context.Context, userID int64) error {
+	if err := m.db.RemoveRecoveryCodes(ctx, userID); err != nil {
+		return fmt.Errorf("failed to remove recovery codes: %w", err)
+	}
+	if err := m.db.RemoveUserTOTP(ctx, userID); err != nil {
+		return fmt.Errorf("failed to remove totp: %w", err)
+	}
+
+	return nil
+}
+
+// Required reports whether the role must use TOTP.
+func (m *TOTPManager) Required(ctx context.Context, role int64) (bool, error) {
+	return m.db.FindRoleRequiresTOTP(ctx, role)
+}
+
+// Challenge records that the user passed the password step. The challenge
+// is kept in its own short-lived cookie until Verify succeeds.
+func (m *TOTPManager) Challenge(c echo.Context, userID int64) error {
+	value, err := securecookie.EncodeMulti(m.challengeName(), userID, m.codecs...)
+	if err != nil {
+		return fmt.Errorf("failed to encode challenge: %w", err)
+	}
+
+	c.SetCookie(m.challengeCookie(value, int(challengeMaxAge.Seconds())))
+	return nil
+}
+
+// Challenged returns the user who passed the password step.
+func (m *TOTPManager) Challenged(c echo.Context) (int64, error) {
+	cookie, err := c.Cookie(m.challengeName())
+	if err != nil {
+		return 0, ErrNoChallenge
+	}
+
+	var userID int64
+	if err = securecookie.DecodeMulti(m.challengeName(), cookie.Value, &userID, m.codecs...); err != nil {
+		return 0, ErrNoChallenge
+	}
+
+	return userID, nil
+}
+
+// ClearChallenge removes the challenge cookie.
+func (m *TOTPManager) ClearChallenge(c echo.Context) {
+	c.SetCookie(m.challengeCookie("", -1))
+}
+
+func (m *TOTPManager) challengeName() string {
+	return m.cookie.Name + "-challenge"
+}
+
+func (m *TOTPManager) challengeCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.challengeName(),
+		Value:    value,
+		Path:     m.cookie.Path,
+		Domain:   m.cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   m.cookie.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// match returns the time step of the code, checking one step either side of
+// the current one to allow for clock drift.
+func (m *TOTPManager) match(row *database.UserTotp, code string) (int64, error) {
+	secret, err := m.open(row.UserID, row.Secret)
+	if err != nil {
+		return 0, err
+	}
+
+	code = strings.TrimSpace(code)
+	current := time.Now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := hotp.GenerateCodeCustom(secret, uint64(step), hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to generate totp code: %w", err)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+
+	return 0, ErrInvalidTOTPCode
+}
+
+func (m *TOTPManager) useRecoveryCode(ctx context.Context, userID int64, code string) error {
+	now := time.Now().UTC()
+	n, err := m.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UsedAt:   &now,
+		UserID:   userID,
+		CodeHash: hashRecoveryCode(code),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if n == 0 {
+		return ErrInvalidTOTPCode
+	}
+
+	return nil
+}
+
+func (m *TOTPManager) generateRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	if err := m.db.RemoveRecoveryCodes(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to remove recovery codes: %w", err)
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+
+		err := m.db.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hashRecoveryCode(codes[i]),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode normalizes the code so it may be entered without the
+// dash or in any case. Codes are random, so an unsalted hash suffices.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// seal encrypts the secret, binding it to the user so a ciphertext cannot be
+// moved to another account.
+func (m *TOTPManager) seal(userID int64, secret string) (string, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := m.aead.Seal(nonce, nonce, []byte(secret), binary.BigEndian.AppendUint64(nil, uint64(userID)))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (m *TOTPManager) open(userID int64, secret string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || len(sealed) < m.aead.NonceSize() {
+		return "", fmt.Errorf("failed to decode totp secret: %w", err)
+	}
+
+	nonce, ciphertext := sealed[:m.aead.NonceSize()], sealed[m.aead.NonceSize():]
+	plaintext, err := m.aead.Open(nil, nonce, ciphertext, binary.BigEndian.AppendUint64(nil, uint64(userID)))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+func ConfigureTOTP(provider config.Provider) (*TOTPOptions, error) {
+	opts := new(TOTPOptions)
+	if err := provider.Get("totp").Populate(opts); err != nil {
+		return nil, fmt.Errorf("failed to configure totp options: %w", err)
+	}
+
+	return opts, nil
+}
+
+func NewTOTPManager(p TOTPParams) (*TOTPManager, error) {
+	key, err := base64.StdEncoding.DecodeString(p.Options.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode totp encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("totp encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	codecs, err := p.Session.Codecs(challengeMaxAge, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := p.Options.Issuer
+	if issuer == "" {
+		issuer = "herobrian"
+	}
+
+	return &TOTPManager{
+		db:     p.Querier,
+		issuer: issuer,
+		aead:   aead,
+		codecs: codecs,
+		cookie: p.Cookie,
+	}, nil
+}
@@ -4,6 +4,7 @@ package linode
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/bdreece/herobrian/pkg/event"
@@ -21,25 +22,28 @@ type emitter struct {
 }
 
 func (e *emitter) Close() error {
-	if err := e.Emitter.Close(); err != nil {
+	if err := e.worker.Stop(context.Background()); err != nil {
 		return err
 	}
 
-	if err := e.worker.Stop(context.Background()); err != nil {
+	if err := e.Emitter.Close(); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func NewEmitter(client Client) (Emitter, error) {
+func NewEmitter(client Client, registry *worker.Registry, logger *slog.Logger) (Emitter, error) {
 	e := event.NewEmitter[Topic, Status]()
 	wrk := newWorkerService(workerParams{
 		Client:   client,
 		Emitter:  e,
 		Interval: time.Second,
+		Logger:   logger,
 	})
 
+	registry.Register(wrk)
+
 	if err := wrk.Start(context.Background()); err != nil {
 		return nil, fmt.Errorf("failed to start linode worker: %w", err)
 	}
@@ -0,0 +1,20 @@
+package linode
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bdreece/herobrian/pkg/health"
+)
+
+// NewHealthCheck verifies that the Linode API accepts the configured
+// access token and that the configured instance exists.
+func NewHealthCheck(client Client) health.Check {
+	return health.NewCheck("linode", func(ctx context.Context) error {
+		if _, err := client.InstanceStatus(ctx); err != nil {
+			return fmt.Errorf("failed to query linode instance: %w", err)
+		}
+
+		return nil
+	})
+}
@@ -2,6 +2,8 @@ package linode
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/bdreece/herobrian/pkg/event"
@@ -16,29 +18,35 @@ type workerParams struct {
 	Client   Client
 	Emitter  event.Emitter[Topic, Status]
 	Interval time.Duration
+	Logger   *slog.Logger
 }
 
-func newWorkerService(p workerParams) worker.Service {
-	return worker.NewService(func(ctx context.Context) error {
-		ticker := time.NewTicker(p.Interval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-ticker.C:
-				if !p.Emitter.Ready() {
-					continue
+func newWorkerService(p workerParams) worker.Supervisor {
+	return worker.NewSupervisor(worker.SupervisorParams{
+		Name:   "linode",
+		Policy: worker.DefaultRestartPolicy,
+		Logger: p.Logger,
+		Run: func(ctx context.Context) error {
+			ticker := time.NewTicker(p.Interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-ticker.C:
+					if !p.Emitter.Ready() {
+						continue
+					}
+
+					status, err := p.Client.InstanceStatus(ctx)
+					if err != nil {
+						return fmt.Errorf("failed to refresh instance status: %w", err)
+					}
+
+					p.Emitter.Publish(TopicStatus, *status)
 				}
-
-				status, err := p.Client.InstanceStatus(ctx)
-				if err != nil {
-					return err
-				}
-
-				p.Emitter.Publish(TopicStatus, *status)
 			}
-		}
+		},
 	})
 }
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/bdreece/herobrian/pkg/minecraft"
+	"github.com/bdreece/herobrian/pkg/systemd"
+	"github.com/bdreece/herobrian/pkg/worker"
+)
+
+const pingTimeout = 2 * time.Second
+
+type (
+	workerCollector struct {
+		workers *worker.Registry
+		state   *prometheus.Desc
+		crashes *prometheus.Desc
+	}
+
+	playerCollector struct {
+		opts   *systemd.ClientOptions[systemd.SSH]
+		online *prometheus.Desc
+		max    *prometheus.Desc
+	}
+)
+
+func newWorkerCollector(workers *worker.Registry) *workerCollector {
+	return &workerCollector{
+		workers: workers,
+		state: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "worker", "state"),
+			"The current state of each supervised worker.",
+			[]string{"worker", "state"}, nil,
+		),
+		crashes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "worker", "crashes_total"),
+			"Crashes of each supervised worker.",
+			[]string{"worker"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *workerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	ch <- c.crashes
+}
+
+// Collect implements prometheus.Collector.
+func (c *workerCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, health := range c.workers.Health() {
+		for state := worker.StateStopped; state <= worker.StateBackoff; state++ {
+			ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue,
+				boolToFloat(health.State == state), health.Name, state.String())
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.crashes, prometheus.CounterValue,
+			float64(health.Crashes), health.Name)
+	}
+}
+
+func newPlayerCollector(opts *systemd.ClientOptions[systemd.SSH]) *playerCollector {
+	return &playerCollector{
+		opts: opts,
+		online: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "minecraft", "players_online"),
+			"Players currently online on each Minecraft instance.",
+			[]string{"instance"}, nil,
+		),
+		max: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "minecraft", "players_max"),
+			"Player capacity of each Minecraft instance.",
+			[]string{"instance"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *playerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.online
+	ch <- c.max
+}
+
+// Collect implements prometheus.Collector. Instances which are not
+// configured with a port, or which do not answer, are omitted.
+func (c *playerCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, unit := range c.opts.Units {
+		if unit.Port == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(unit systemd.Unit) {
+			defer wg.Done()
+
+			status, err := minecraft.Ping(ctx, c.opts.Transport.Address, unit.Port)
+			if err != nil {
+				return
+			}
+
+			ch <- prometheus.MustNewConstMetric(c.online, prometheus.GaugeValue,
+				float64(status.Players.Online), unit.Instance)
+			ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue,
+				float64(status.Players.Max), unit.Instance)
+		}(unit)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/bdreece/herobrian/pkg/linode"
+	"github.com/bdreece/herobrian/pkg/systemd"
+)
+
+type (
+	linodeClient struct {
+		linode.Client
+		m *Metrics
+	}
+
+	systemdClient struct {
+		systemd.Client
+		m *Metrics
+	}
+)
+
+// InstrumentLinode wraps a linode.Client to record API call metrics.
+func InstrumentLinode(client linode.Client, m *Metrics) linode.Client {
+	return &linodeClient{client, m}
+}
+
+// InstrumentSystemd registers a decorator which records SSH command metrics
+// for every client created by the factory.
+func InstrumentSystemd(services *systemd.ServiceFactory, m *Metrics) *systemd.ServiceFactory {
+	services.Use(func(client systemd.Client) systemd.Client {
+		return &systemdClient{client, m}
+	})
+
+	return services
+}
+
+func (c *linodeClient) InstanceStatus(ctx context.Context) (status *linode.Status, err error) {
+	defer c.m.observeLinode("status", time.Now(), &err)
+	return c.Client.InstanceStatus(ctx)
+}
+
+func (c *linodeClient) BootInstance(ctx context.Context) (err error) {
+	defer c.m.observeLinode("boot", time.Now(), &err)
+	return c.Client.BootInstance(ctx)
+}
+
+func (c *linodeClient) ShutdownInstance(ctx context.Context) (err error) {
+	defer c.m.observeLinode("shutdown", time.Now(), &err)
+	return c.Client.ShutdownInstance(ctx)
+}
+
+func (c *linodeClient) RebootInstance(ctx context.Context) (err error) {
+	defer c.m.observeLinode("reboot", time.Now(), &err)
+	return c.Client.RebootInstance(ctx)
+}
+
+func (c *systemdClient) Status(ctx context.Context, unit systemd.Unit) (status *systemd.Status, err error) {
+	defer c.m.observeSSH("status", time.Now(), &err)
+	return c.Client.Status(ctx, unit)
+}
+
+func (c *systemdClient) Enable(ctx context.Context, unit systemd.Unit) (err error) {
+	defer c.m.observeSSH("enable", time.Now(), &err)
+	return c.Client.Enable(ctx, unit)
+}
+
+func (c *systemdClient) Disable(ctx context.Context, unit systemd.Unit) (err error) {
+	defer c.m.observeSSH("disable", time.Now(), &err)
+	return c.Client.Disable(ctx, unit)
+}
+
+func (c *systemdClient) Start(ctx context.Context, unit systemd.Unit) (err error) {
+	defer c.m.observeSSH("start", time.Now(), &err)
+	return c.Client.Start(ctx, unit)
+}
+
+func (c *systemdClient) Stop(ctx context.Context, unit systemd.Unit) (err error) {
+	defer c.m.observeSSH("stop", time.Now(), &err)
+	return c.Client.Stop(ctx, unit)
+}
+
+func (c *systemdClient) Restart(ctx context.Context, unit systemd.Unit) (err error) {
+	defer c.m.observeSSH("restart", time.Now(), &err)
+	return c.Client.Restart(ctx, unit)
+}
+
+// Logs records only opening the journal, as it may be followed indefinitely.
+func (c *systemdClient) Logs(ctx context.Context, unit systemd.Unit, lines int, follow bool) (_ io.ReadCloser, err error) {
+	defer c.m.observeSSH("logs", time.Now(), &err)
+	return c.Client.Logs(ctx, unit, lines, follow)
+}
+
+func (m *Metrics) observeLinode(operation string, start time.Time, err *error) {
+	m.linodeRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	m.linodeRequests.WithLabelValues(operation, outcome(*err)).Inc()
+}
+
+func (m *Metrics) observeSSH(operation string, start time.Time, err *error) {
+	m.sshCommandDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	m.sshCommands.WithLabelValues(operation, outcome(*err)).Inc()
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return outcomeError
+	}
+
+	return outcomeSuccess
+}
+
+var (
+	_ linode.Client  = (*linodeClient)(nil)
+	_ systemd.Client = (*systemdClient)(nil)
+)
@@ -0,0 +1,172 @@
+// Package metrics exports herobrian's Prometheus metrics.
+//
+// Metric names and labels are a stable interface relied upon by dashboards
+// and alerts. Add new series rather than renaming or relabelling existing
+// ones:
+//
+//	herobrian_linode_status{status}                      gauge: 1 for the last observed instance status, 0 otherwise
+//	herobrian_linode_requests_total{operation,outcome}   counter: Linode API calls by operation and outcome (success|error)
+//	herobrian_linode_request_duration_seconds{operation} histogram: Linode API call latency
+//	herobrian_systemd_unit_status{instance,status}       gauge: 1 for the last observed unit status, 0 otherwise
+//	herobrian_ssh_commands_total{operation,outcome}      counter: systemctl commands run over SSH by outcome (success|error)
+//	herobrian_ssh_command_duration_seconds{operation}    histogram: SSH command latency
+//	herobrian_minecraft_players_online{instance}         gauge: players online, for units with a configured port
+//	herobrian_minecraft_players_max{instance}            gauge: player capacity, for units with a configured port
+//	herobrian_sse_subscribers{stream}                    gauge: open server-sent event streams (linode|systemd)
+//	herobrian_worker_state{worker,state}                 gauge: 1 for the supervisor's current state, 0 otherwise
+//	herobrian_worker_crashes_total{worker}               counter: worker crashes, each followed by a restart unless the policy gives up
+//	herobrian_http_requests_total{code,method,host,url}  counter: HTTP requests served by the router
+//	herobrian_http_request_duration_seconds{...}         histogram: HTTP request latency
+//	herobrian_http_request_size_bytes{...}               histogram: HTTP request size
+//	herobrian_http_response_size_bytes{...}              histogram: HTTP response size
+package metrics
+
+import (
+	"github.com/labstack/echo-contrib/echoprometheus"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.uber.org/fx"
+
+	"github.com/bdreece/herobrian/pkg/systemd"
+	"github.com/bdreece/herobrian/pkg/worker"
+)
+
+const namespace = "herobrian"
+
+const (
+	outcomeSuccess = "success"
+	outcomeError   = "error"
+)
+
+type (
+	Metrics struct {
+		registry *prometheus.Registry
+
+		linodeStatus          *prometheus.GaugeVec
+		linodeRequests        *prometheus.CounterVec
+		linodeRequestDuration *prometheus.HistogramVec
+		unitStatus            *prometheus.GaugeVec
+		sshCommands           *prometheus.CounterVec
+		sshCommandDuration    *prometheus.HistogramVec
+		sseSubscribers        *prometheus.GaugeVec
+	}
+
+	Params struct {
+		fx.In
+
+		Workers *worker.Registry
+		Options *systemd.ClientOptions[systemd.SSH]
+	}
+)
+
+func (m *Metrics) Registry() *prometheus.Registry { return m.registry }
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() echo.HandlerFunc {
+	return echoprometheus.NewHandlerWithConfig(echoprometheus.HandlerConfig{
+		Gatherer: m.registry,
+	})
+}
+
+// Middleware records HTTP request metrics for the router.
+func (m *Metrics) Middleware() (echo.MiddlewareFunc, error) {
+	return echoprometheus.MiddlewareConfig{
+		Namespace:                 namespace,
+		Subsystem:                 "http",
+		Registerer:                m.registry,
+		DoNotUseRequestPathFor404: true,
+	}.ToMiddleware()
+}
+
+// TrackStream counts the server-sent event streams open on a route.
+func (m *Metrics) TrackStream(stream string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			gauge := m.sseSubscribers.WithLabelValues(stream)
+			gauge.Inc()
+			defer gauge.Dec()
+
+			return next(c)
+		}
+	}
+}
+
+func New(p Params) (*Metrics, error) {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		linodeStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "linode",
+			Name:      "status",
+			Help:      "The last observed status of the Linode instance.",
+		}, []string{"status"}),
+		linodeRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "linode",
+			Name:      "requests_total",
+			Help:      "Linode API calls, partitioned by operation and outcome.",
+		}, []string{"operation", "outcome"}),
+		linodeRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "linode",
+			Name:      "request_duration_seconds",
+			Help:      "Linode API call latencies in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		unitStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "systemd",
+			Name:      "unit_status",
+			Help:      "The last observed status of each systemd unit.",
+		}, []string{"instance", "status"}),
+		sshCommands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ssh",
+			Name:      "commands_total",
+			Help:      "systemctl commands run over SSH, partitioned by operation and outcome.",
+		}, []string{"operation", "outcome"}),
+		sshCommandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "ssh",
+			Name:      "command_duration_seconds",
+			Help:      "SSH command latencies in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		sseSubscribers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "sse",
+			Name:      "subscribers",
+			Help:      "Open server-sent event streams.",
+		}, []string{"stream"}),
+	}
+
+	err := registerAll(m.registry,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.linodeStatus,
+		m.linodeRequests,
+		m.linodeRequestDuration,
+		m.unitStatus,
+		m.sshCommands,
+		m.sshCommandDuration,
+		m.sseSubscribers,
+		newWorkerCollector(p.Workers),
+		newPlayerCollector(p.Options),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func registerAll(registry prometheus.Registerer, cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
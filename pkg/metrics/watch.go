@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+
+	"go.uber.org/fx"
+
+	"github.com/bdreece/herobrian/pkg/linode"
+	"github.com/bdreece/herobrian/pkg/systemd"
+)
+
+// Watch subscribes to the linode and systemd emitters to keep the status
+// gauges current. Subscribing keeps the linode worker polling even when no
+// browser is watching, so that uptime can be graphed.
+func Watch(lc fx.Lifecycle, m *Metrics, linodeEmitter linode.Emitter, systemdEmitter systemd.Emitter, services *systemd.ServiceFactory) {
+	lc.Append(fx.StartHook(func(context.Context) {
+		ch := make(chan linode.Status)
+		linodeEmitter.Subscribe(linode.TopicStatus, ch)
+		go func() {
+			for status := range ch {
+				m.setLinodeStatus(status)
+			}
+		}()
+
+		for _, unit := range services.Units() {
+			ch := make(chan systemd.Status)
+			systemdEmitter.Subscribe(unit.Instance, ch)
+			go func(instance string) {
+				for status := range ch {
+					m.setUnitStatus(instance, status)
+				}
+			}(unit.Instance)
+		}
+	}))
+}
+
+func (m *Metrics) setLinodeStatus(current linode.Status) {
+	for status := linode.StatusRunning; status <= linode.StatusBillingSuspension; status++ {
+		m.linodeStatus.WithLabelValues(status.String()).Set(boolToFloat(status == current))
+	}
+}
+
+func (m *Metrics) setUnitStatus(instance string, current systemd.Status) {
+	for status := systemd.StatusActiveRunning; status <= systemd.StatusLinked; status++ {
+		m.unitStatus.WithLabelValues(instance, status.String()).Set(boolToFloat(status == current))
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,144 @@
+package minecraft
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// protocolVersion is sent in the handshake. Servers answer status requests
+// regardless of the client's protocol version.
+const protocolVersion = 767
+
+const maxResponseLength = 1 << 20
+
+type Status struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+}
+
+var ErrInvalidResponse = errors.New("invalid server list ping response")
+
+// Ping queries a Minecraft server's status using the server list ping
+// protocol.
+func Ping(ctx context.Context, host string, port int) (*Status, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial minecraft server: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, 0x00)
+	writeVarInt(&handshake, protocolVersion)
+	writeString(&handshake, host)
+	_ = binary.Write(&handshake, binary.BigEndian, uint16(port))
+	writeVarInt(&handshake, 1)
+
+	if err = writePacket(conn, handshake.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to send handshake: %w", err)
+	}
+
+	if err = writePacket(conn, []byte{0x00}); err != nil {
+		return nil, fmt.Errorf("failed to send status request: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err = readVarInt(r); err != nil {
+		return nil, fmt.Errorf("failed to read packet length: %w", err)
+	}
+
+	id, err := readVarInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read packet id: %w", err)
+	}
+	if id != 0x00 {
+		return nil, ErrInvalidResponse
+	}
+
+	n, err := readVarInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response length: %w", err)
+	}
+	if n < 0 || n > maxResponseLength {
+		return nil, ErrInvalidResponse
+	}
+
+	data := make([]byte, n)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	status := new(Status)
+	if err = json.Unmarshal(data, status); err != nil {
+		return nil, errors.Join(ErrInvalidResponse, err)
+	}
+
+	return status, nil
+}
+
+func writePacket(w io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	writeVarInt(&buf, int32(len(data)))
+	buf.Write(data)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeVarInt(buf, int32(len(s)))
+	buf.WriteString(s)
+}
+
+func writeVarInt(buf *bytes.Buffer, v int32) {
+	u := uint32(v)
+	for {
+		if u&^0x7f == 0 {
+			buf.WriteByte(byte(u))
+			return
+		}
+
+		buf.WriteByte(byte(u&0x7f | 0x80))
+		u >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		v |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(v), nil
+		}
+	}
+
+	return 0, ErrInvalidResponse
+}
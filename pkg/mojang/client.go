@@ -0,0 +1,153 @@
+// Package mojang looks up Minecraft accounts and their skins.
+package mojang
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	maxSkinBytes   = 1 << 20
+)
+
+var (
+	ErrProfileNotFound = errors.New("no minecraft account has this username")
+	ErrNoSkin          = errors.New("minecraft account has the default skin")
+)
+
+type (
+	Profile struct {
+		// ID is the UUID of the account, without dashes.
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	Client interface {
+		// Profile finds the account with the username, ignoring case.
+		Profile(ctx context.Context, username string) (*Profile, error)
+		// Skin downloads the skin of the account with the UUID.
+		Skin(ctx context.Context, id string) (image.Image, error)
+	}
+
+	httpClient struct {
+		http.Client
+
+		opts *Options
+	}
+)
+
+func (client *httpClient) Profile(ctx context.Context, username string) (*Profile, error) {
+	uri := strings.TrimSuffix(client.opts.APIURL, "/") + "/users/profiles/minecraft/" + url.PathEscape(username)
+
+	profile := new(Profile)
+	if err := client.get(ctx, uri, profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+func (client *httpClient) Skin(ctx context.Context, id string) (image.Image, error) {
+	uri := strings.TrimSuffix(client.opts.SessionURL, "/") + "/session/minecraft/profile/" + url.PathEscape(id)
+
+	var dto struct {
+		Properties []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"properties"`
+	}
+	if err := client.get(ctx, uri, &dto); err != nil {
+		return nil, err
+	}
+
+	var textures struct {
+		Textures struct {
+			Skin *struct {
+				URL string `json:"url"`
+			} `json:"SKIN"`
+		} `json:"textures"`
+	}
+	for _, p := range dto.Properties {
+		if p.Name != "textures" {
+			continue
+		}
+
+		b, err := base64.StdEncoding.DecodeString(p.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode textures: %w", err)
+		}
+		if err = json.Unmarshal(b, &textures); err != nil {
+			return nil, fmt.Errorf("failed to decode textures: %w", err)
+		}
+	}
+
+	if textures.Textures.Skin == nil {
+		return nil, ErrNoSkin
+	}
+
+	res, err := client.do(ctx, textures.Textures.Skin.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	skin, err := png.Decode(io.LimitReader(res.Body, maxSkinBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode skin: %w", err)
+	}
+
+	return skin, nil
+}
+
+// get decodes a JSON response. Mojang answers a missing account with either
+// 204 or 404.
+func (client *httpClient) get(ctx context.Context, uri string, out any) error {
+	res, err := client.do(ctx, uri)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (client *httpClient) do(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res, nil
+	case http.StatusNoContent, http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrProfileNotFound
+	default:
+		res.Body.Close()
+		return nil, fmt.Errorf("invalid status: %s", res.Status)
+	}
+}
+
+func NewHTTP(opts *Options) Client {
+	return &httpClient{
+		Client: http.Client{Timeout: requestTimeout},
+		opts:   opts,
+	}
+}
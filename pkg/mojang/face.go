@@ -0,0 +1,37 @@
+package mojang
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+)
+
+var ErrInvalidSkin = errors.New("skin is not a 64x64 or 64x32 image")
+
+var (
+	// the front of the head, and the hat layer drawn over it
+	headRect = image.Rect(8, 8, 16, 16)
+	hatRect  = image.Rect(40, 8, 48, 16)
+)
+
+// Face renders the front of a skin's head, with its hat, as a square image
+// of the given size. The pixels are scaled up without smoothing.
+func Face(skin image.Image, size int) (*image.NRGBA, error) {
+	b := skin.Bounds()
+	if b.Dx() != 64 || (b.Dy() != 64 && b.Dy() != 32) {
+		return nil, ErrInvalidSkin
+	}
+
+	face := image.NewNRGBA(image.Rect(0, 0, headRect.Dx(), headRect.Dy()))
+	draw.Draw(face, face.Bounds(), skin, b.Min.Add(headRect.Min), draw.Src)
+	draw.Draw(face, face.Bounds(), skin, b.Min.Add(hatRect.Min), draw.Over)
+
+	out := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			out.Set(x, y, face.At(x*headRect.Dx()/size, y*headRect.Dy()/size))
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,24 @@
+package mojang
+
+import (
+	"fmt"
+
+	"go.uber.org/config"
+)
+
+type Options struct {
+	APIURL     string `yaml:"api_url"`
+	SessionURL string `yaml:"session_url"`
+}
+
+func Configure(provider config.Provider) (*Options, error) {
+	opts := &Options{
+		APIURL:     "https://api.mojang.com",
+		SessionURL: "https://sessionserver.mojang.com",
+	}
+	if err := provider.Get("mojang").Populate(opts); err != nil {
+		return nil, fmt.Errorf("failed to bind mojang options: %w", err)
+	}
+
+	return opts, nil
+}
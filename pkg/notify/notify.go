@@ -0,0 +1,467 @@
+// Package notify posts messages about server events to chat webhooks, HTTP
+// endpoints and email.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/email"
+	"github.com/bdreece/herobrian/pkg/linode"
+	"github.com/bdreece/herobrian/pkg/systemd"
+	"github.com/bdreece/herobrian/pkg/worker"
+	"go.uber.org/fx"
+)
+
+// Events published from status changes. Linode events are named after the
+// new instance status, e.g. "linode.running" or "linode.shutting_down".
+const (
+	EventUnitStarted = "unit.started"
+	EventUnitStopped = "unit.stopped"
+	EventUnitFailed  = "unit.failed"
+)
+
+const (
+	queueSize   = 64
+	sendTimeout = 10 * time.Second
+)
+
+var (
+	ErrUnknownTarget = errors.New("unknown notification target type")
+	ErrInvalidTarget = errors.New("invalid notification target")
+)
+
+// defaultTemplates are used for events without a template on the target.
+var defaultTemplates = map[string]string{
+	"linode." + linode.StatusRunning.String():      "Server is up",
+	"linode." + linode.StatusOffline.String():      "Server is down",
+	"linode." + linode.StatusBooting.String():      "Server is booting",
+	"linode." + linode.StatusRebooting.String():    "Server is rebooting",
+	"linode." + linode.StatusShuttingDown.String(): "Server is shutting down",
+	EventUnitStarted: "{{ .Instance }} started",
+	EventUnitStopped: "{{ .Instance }} stopped",
+	EventUnitFailed:  "{{ .Instance }} crashed",
+}
+
+const fallbackTemplate = "{{ with .Message }}{{ . }}{{ else }}{{ .Name }}{{ with .Instance }} ({{ . }}){{ end }}{{ end }}"
+
+type (
+	// Event is the data passed to message templates.
+	Event struct {
+		Name     string
+		Instance string
+		Status   string
+		Previous string
+		Message  string
+		Time     time.Time
+	}
+
+	// Notifier fans events out to every matching target. Each target has
+	// its own queue, so a slow or failing target does not delay the
+	// others. Events are also delivered to users who subscribed to them.
+	Notifier struct {
+		worker.Supervisor
+
+		targets   []*target
+		query     database.Querier
+		email     email.Client
+		pusher    *Pusher
+		templates map[string]*template.Template
+		debounce  time.Duration
+		users     chan Event
+		logger    *slog.Logger
+
+		mu          sync.Mutex
+		linodeState *linode.Status
+		unitState   map[string]systemd.Status
+		pending     map[string]*pendingEvent
+	}
+
+	Params struct {
+		fx.In
+
+		Options     *Options
+		Querier     database.Querier
+		EmailClient email.Client
+		Registry    *worker.Registry
+		Logger      *slog.Logger
+	}
+
+	target struct {
+		opts      TargetOptions
+		sender    Sender
+		templates map[string]*template.Template
+		queue     chan Event
+	}
+)
+
+// Notify queues the event for every target whose filter matches. Events are
+// dropped if a target's queue is full. Subsystems may publish their own
+// events, such as a warning before an idle shutdown, by setting Message.
+func (n *Notifier) Notify(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	for _, t := range n.targets {
+		if !t.matches(e.Name) {
+			continue
+		}
+
+		select {
+		case t.queue <- e:
+		default:
+			n.logger.Warn("notification queue full, dropping event",
+				slog.String("target", t.opts.Name),
+				slog.String("event", e.Name))
+		}
+	}
+
+	n.schedule(e)
+}
+
+// ObserveLinode publishes an event when the instance status changes. The
+// first observation only records the status.
+func (n *Notifier) ObserveLinode(status linode.Status) {
+	n.mu.Lock()
+	prev := n.linodeState
+	n.linodeState = &status
+	n.mu.Unlock()
+
+	if prev == nil || *prev == status {
+		return
+	}
+
+	n.Notify(Event{
+		Name:     "linode." + status.String(),
+		Status:   status.String(),
+		Previous: prev.String(),
+	})
+}
+
+// ObserveUnit publishes an event when a unit starts, stops or fails. The
+// first observation only records the status.
+func (n *Notifier) ObserveUnit(instance string, status systemd.Status) {
+	n.mu.Lock()
+	prev, seen := n.unitState[instance]
+	n.unitState[instance] = status
+	n.mu.Unlock()
+
+	if !seen || prev == status {
+		return
+	}
+
+	var name string
+	switch status {
+	case systemd.StatusActiveRunning:
+		name = EventUnitStarted
+	case systemd.StatusInactive:
+		name = EventUnitStopped
+	case systemd.StatusFailed:
+		name = EventUnitFailed
+	default:
+		return
+	}
+
+	n.Notify(Event{
+		Name:     name,
+		Instance: instance,
+		Status:   status.String(),
+		Previous: prev.String(),
+	})
+}
+
+func (n *Notifier) run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, t := range n.targets {
+		wg.Add(1)
+		go func(t *target) {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e := <-t.queue:
+					n.deliver(ctx, t, e)
+				}
+			}
+		}(t)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-n.users:
+				n.deliverUsers(ctx, e)
+			}
+		}
+	}()
+
+	<-ctx.Done()
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func (n *Notifier) deliver(ctx context.Context, t *target, e Event) {
+	text, err := t.render(e)
+	if err != nil {
+		n.logger.Error("failed to render notification",
+			slog.String("target", t.opts.Name),
+			slog.String("event", e.Name),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	retry := t.opts.Retry
+	backoff := retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err = t.sender.Send(sendCtx, &Notification{e, text})
+		cancel()
+
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		if attempt >= retry.Attempts {
+			n.logger.Error("notification failed, giving up",
+				slog.String("target", t.opts.Name),
+				slog.String("event", e.Name),
+				slog.Int("attempts", attempt),
+				slog.String("error", err.Error()))
+			return
+		}
+
+		n.logger.Warn("notification failed, retrying",
+			slog.String("target", t.opts.Name),
+			slog.String("event", e.Name),
+			slog.Int("attempts", attempt),
+			slog.Duration("backoff", backoff),
+			slog.String("error", err.Error()))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		backoff = min(2*backoff, retry.MaxBackoff)
+	}
+}
+
+func (t *target) matches(name string) bool {
+	if len(t.opts.Events) == 0 {
+		return true
+	}
+
+	for _, pattern := range t.opts.Events {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *target) render(e Event) (string, error) {
+	return render(t.templates, e)
+}
+
+func render(templates map[string]*template.Template, e Event) (string, error) {
+	tmpl, ok := templates[e.Name]
+	if !ok {
+		tmpl = templates[""]
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, e); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// parseTemplates parses the default templates with the given overrides
+// applied. The fallback template is stored under the empty name.
+func parseTemplates(overrides map[string]string) (map[string]*template.Template, error) {
+	sources := map[string]string{"": fallbackTemplate}
+	for name, text := range defaultTemplates {
+		sources[name] = text
+	}
+	for name, text := range overrides {
+		sources[name] = text
+	}
+
+	templates := make(map[string]*template.Template, len(sources))
+	for name, text := range sources {
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %q: %w", name, err)
+		}
+		templates[name] = tmpl
+	}
+
+	return templates, nil
+}
+
+func newTarget(opts TargetOptions, client *http.Client, emailClient email.Client) (*target, error) {
+	if opts.Name == "" {
+		opts.Name = string(opts.Type)
+	}
+
+	var sender Sender
+	switch opts.Type {
+	case TargetDiscord, TargetSlack, TargetWebhook:
+		if opts.URL == "" {
+			return nil, fmt.Errorf("%w %q: missing url", ErrInvalidTarget, opts.Name)
+		}
+	}
+
+	switch opts.Type {
+	case TargetDiscord:
+		sender = &discordSender{client, opts.URL}
+	case TargetSlack:
+		sender = &slackSender{client, opts.URL}
+	case TargetWebhook:
+		sender = &webhookSender{client, opts.URL, []byte(opts.Secret)}
+	case TargetEmail:
+		if len(opts.To) == 0 {
+			return nil, fmt.Errorf("%w %q: missing recipients", ErrInvalidTarget, opts.Name)
+		}
+
+		to := make([]email.Address, len(opts.To))
+		for i, addr := range opts.To {
+			to[i] = email.Address{Email: addr}
+		}
+		sender = &emailSender{emailClient, to}
+	default:
+		return nil, fmt.Errorf("%w %q for %q", ErrUnknownTarget, opts.Type, opts.Name)
+	}
+
+	for _, pattern := range opts.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w %q: invalid event filter %q", ErrInvalidTarget, opts.Name, pattern)
+		}
+	}
+
+	templates, err := parseTemplates(opts.Templates)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %w", ErrInvalidTarget, opts.Name, err)
+	}
+
+	if opts.Retry.Attempts <= 0 {
+		opts.Retry.Attempts = DefaultRetryOptions.Attempts
+	}
+	if opts.Retry.InitialBackoff <= 0 {
+		opts.Retry.InitialBackoff = DefaultRetryOptions.InitialBackoff
+	}
+	if opts.Retry.MaxBackoff < opts.Retry.InitialBackoff {
+		opts.Retry.MaxBackoff = max(DefaultRetryOptions.MaxBackoff, opts.Retry.InitialBackoff)
+	}
+
+	return &target{
+		opts:      opts,
+		sender:    sender,
+		templates: templates,
+		queue:     make(chan Event, queueSize),
+	}, nil
+}
+
+func New(p Params) (*Notifier, error) {
+	logger := p.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	client := &http.Client{Timeout: sendTimeout}
+	targets := make([]*target, 0, len(p.Options.Targets))
+	for _, opts := range p.Options.Targets {
+		t, err := newTarget(opts, client, p.EmailClient)
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, t)
+	}
+
+	pusher, err := NewPusher(p.Options.VAPID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := parseTemplates(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	debounce := p.Options.Debounce
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+
+	n := &Notifier{
+		targets:   targets,
+		query:     p.Querier,
+		email:     p.EmailClient,
+		pusher:    pusher,
+		templates: templates,
+		debounce:  debounce,
+		users:     make(chan Event, queueSize),
+		logger:    logger,
+		unitState: make(map[string]systemd.Status),
+		pending:   make(map[string]*pendingEvent),
+	}
+
+	n.Supervisor = worker.NewSupervisor(worker.SupervisorParams{
+		Name:   "notify",
+		Policy: worker.DefaultRestartPolicy,
+		Logger: logger,
+		Run:    n.run,
+	})
+	p.Registry.Register(n.Supervisor)
+
+	return n, nil
+}
+
+// Watch feeds emitter status updates to the notifier and starts delivery.
+func Watch(lc fx.Lifecycle, n *Notifier, linodeEmitter linode.Emitter, systemdEmitter systemd.Emitter, services *systemd.ServiceFactory) {
+	lc.Append(fx.StartStopHook(func() error {
+		ch := make(chan linode.Status)
+		linodeEmitter.Subscribe(linode.TopicStatus, ch)
+		go func() {
+			for status := range ch {
+				n.ObserveLinode(status)
+			}
+		}()
+
+		for _, unit := range services.Units() {
+			ch := make(chan systemd.Status)
+			systemdEmitter.Subscribe(unit.Instance, ch)
+			go func(instance string) {
+				for status := range ch {
+					n.ObserveUnit(instance, status)
+				}
+			}(unit.Instance)
+		}
+
+		return n.Start(context.Background())
+	}, n.Stop))
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/config"
+)
+
+const (
+	TargetDiscord TargetType = "discord"
+	TargetSlack   TargetType = "slack"
+	TargetWebhook TargetType = "webhook"
+	TargetEmail   TargetType = "email"
+)
+
+// Channels a user may choose to receive their own notifications on.
+const (
+	ChannelEmail = "email"
+	ChannelPush  = "push"
+)
+
+// DefaultDebounce is how long a user notification waits for the subject to
+// settle before it is delivered.
+const DefaultDebounce = time.Minute
+
+var DefaultRetryOptions = RetryOptions{
+	Attempts:       5,
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     time.Minute,
+}
+
+type (
+	TargetType string
+
+	// Options configures shared targets and per-user delivery. Debounce
+	// delays user notifications so that a flapping unit results in at most
+	// one message once it settles.
+	Options struct {
+		Targets  []TargetOptions `yaml:"targets"`
+		Debounce time.Duration   `yaml:"debounce"`
+		VAPID    VAPIDOptions    `yaml:"vapid"`
+	}
+
+	// VAPIDOptions identifies the server to browser push services. Keys are
+	// base64url encoded; Web Push is disabled without a private key.
+	VAPIDOptions struct {
+		Subject    string `yaml:"subject"`
+		PublicKey  string `yaml:"public_key"`
+		PrivateKey string `yaml:"private_key"`
+	}
+
+	// TargetOptions configures a single notification target. Events are
+	// matched with path.Match, so "unit.*" selects every unit event, and an
+	// empty list selects all events. Templates override the default message
+	// for individual events.
+	TargetOptions struct {
+		Name      string            `yaml:"name"`
+		Type      TargetType        `yaml:"type"`
+		URL       string            `yaml:"url"`
+		Secret    string            `yaml:"secret"`
+		To        []string          `yaml:"to"`
+		Events    []string          `yaml:"events"`
+		Templates map[string]string `yaml:"templates"`
+		Retry     RetryOptions      `yaml:"retry"`
+	}
+
+	RetryOptions struct {
+		Attempts       int           `yaml:"attempts"`
+		InitialBackoff time.Duration `yaml:"initial_backoff"`
+		MaxBackoff     time.Duration `yaml:"max_backoff"`
+	}
+)
+
+func Configure(provider config.Provider) (*Options, error) {
+	opts := new(Options)
+	if err := provider.Get("notify").Populate(opts); err != nil {
+		return nil, fmt.Errorf("failed to configure notify options: %w", err)
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bdreece/herobrian/pkg/email"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of a webhook body,
+// keyed with the target's secret and prefixed with "sha256=".
+const SignatureHeader = "X-Herobrian-Signature"
+
+type (
+	// Sender delivers a rendered notification to a single target.
+	Sender interface {
+		Send(context.Context, *Notification) error
+	}
+
+	Notification struct {
+		Event Event
+		Text  string
+	}
+
+	discordSender struct {
+		client *http.Client
+		url    string
+	}
+
+	slackSender struct {
+		client *http.Client
+		url    string
+	}
+
+	webhookSender struct {
+		client *http.Client
+		url    string
+		secret []byte
+	}
+
+	emailSender struct {
+		client email.Client
+		to     []email.Address
+	}
+
+	webhookPayload struct {
+		Event    string    `json:"event"`
+		Instance string    `json:"instance,omitempty"`
+		Status   string    `json:"status,omitempty"`
+		Previous string    `json:"previous,omitempty"`
+		Message  string    `json:"message"`
+		Time     time.Time `json:"time"`
+	}
+)
+
+// Send implements Sender.
+func (s *discordSender) Send(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, s.client, s.url, map[string]string{"content": n.Text}, nil)
+}
+
+// Send implements Sender.
+func (s *slackSender) Send(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, s.client, s.url, map[string]string{"text": n.Text}, nil)
+}
+
+// Send implements Sender.
+func (s *webhookSender) Send(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(&webhookPayload{
+		Event:    n.Event.Name,
+		Instance: n.Event.Instance,
+		Status:   n.Event.Status,
+		Previous: n.Event.Previous,
+		Message:  n.Text,
+		Time:     n.Event.Time,
+	})
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{"X-Herobrian-Event": {n.Event.Name}}
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	return post(ctx, s.client, s.url, body, header)
+}
+
+// Send implements Sender.
+func (s *emailSender) Send(ctx context.Context, n *Notification) error {
+	subject, _, _ := strings.Cut(n.Text, "\n")
+
+	return s.client.Send(ctx, &email.Message{
+		To:      s.to,
+		Subject: "herobrian: " + subject,
+		Text:    n.Text,
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v any, header http.Header) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return post(ctx, client, url, body, header)
+}
+
+func post(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("received invalid status code %d: %s", res.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
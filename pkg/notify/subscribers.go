@@ -0,0 +1,247 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bdreece/herobrian/pkg/database"
+	"github.com/bdreece/herobrian/pkg/email"
+)
+
+type (
+	// pendingEvent holds the latest event for a subject while it settles.
+	// from is the status before the first event in the window, so a unit
+	// that stops and starts again before the timer fires is not reported.
+	pendingEvent struct {
+		event Event
+		from  string
+		timer *time.Timer
+	}
+
+	pushPayload struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+		Tag   string `json:"tag"`
+		URL   string `json:"url"`
+	}
+)
+
+// PushKey returns the VAPID public key, or an empty string if Web Push is
+// disabled.
+func (n *Notifier) PushKey() string {
+	if n.pusher == nil {
+		return ""
+	}
+
+	return n.pusher.PublicKey()
+}
+
+// pushServices are the domains of the browser vendors' push services.
+// Endpoints elsewhere are refused so a subscription cannot make the server
+// post to arbitrary hosts.
+var pushServices = []string{
+	"fcm.googleapis.com",
+	"push.services.mozilla.com",
+	"push.apple.com",
+	"notify.windows.com",
+}
+
+// Validate checks the subscription can be encrypted to before it is stored.
+func (s *PushSubscription) Validate() error {
+	if _, err := parseEndpoint(s.Endpoint); err != nil {
+		return err
+	}
+
+	_, err := encryptPush(s, nil)
+	return err
+}
+
+// parseEndpoint parses a push endpoint, refusing any not served by one of
+// the pushServices.
+func parseEndpoint(s string) (*url.URL, error) {
+	endpoint, err := url.Parse(s)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: endpoint must be an https url", ErrInvalidPushKeys)
+	}
+	if endpoint.User != nil || endpoint.Port() != "" || !isPushService(endpoint.Hostname()) {
+		return nil, fmt.Errorf("%w: endpoint is not a known push service", ErrInvalidPushKeys)
+	}
+
+	return endpoint, nil
+}
+
+func isPushService(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range pushServices {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schedule debounces status changes per subject before they are delivered
+// to subscribed users. Events without a status are delivered immediately.
+func (n *Notifier) schedule(e Event) {
+	if e.Status == "" {
+		n.enqueueUsers(e)
+		return
+	}
+
+	key := subject(e)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if p, ok := n.pending[key]; ok {
+		p.event = e
+		p.timer.Reset(n.debounce)
+		return
+	}
+
+	p := &pendingEvent{event: e, from: e.Previous}
+	p.timer = time.AfterFunc(n.debounce, func() { n.flush(key) })
+	n.pending[key] = p
+}
+
+func (n *Notifier) flush(key string) {
+	n.mu.Lock()
+	p, ok := n.pending[key]
+	delete(n.pending, key)
+	n.mu.Unlock()
+
+	if !ok || p.event.Status == p.from {
+		return
+	}
+
+	n.enqueueUsers(p.event)
+}
+
+func (n *Notifier) enqueueUsers(e Event) {
+	select {
+	case n.users <- e:
+	default:
+		n.logger.Warn("user notification queue full, dropping event",
+			slog.String("event", e.Name))
+	}
+}
+
+func (n *Notifier) deliverUsers(ctx context.Context, e Event) {
+	subscribers, err := n.query.ListNotificationSubscribers(ctx, database.ListNotificationSubscribersParams{
+		Event:    e.Name,
+		Instance: e.Instance,
+	})
+	if err != nil {
+		n.logger.Error("failed to list notification subscribers",
+			slog.String("event", e.Name),
+			slog.String("error", err.Error()))
+		return
+	}
+	if len(subscribers) == 0 {
+		return
+	}
+
+	text, err := render(n.templates, e)
+	if err != nil {
+		n.logger.Error("failed to render notification",
+			slog.String("event", e.Name),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	for _, sub := range subscribers {
+		switch sub.Channel {
+		case ChannelEmail:
+			err = n.emailUser(ctx, &sub, e, text)
+		case ChannelPush:
+			err = n.pushUser(ctx, &sub, e, text)
+		default:
+			err = fmt.Errorf("unknown channel %q", sub.Channel)
+		}
+
+		if err != nil {
+			n.logger.Error("failed to notify user",
+				slog.String("user", sub.Username),
+				slog.String("channel", sub.Channel),
+				slog.String("event", e.Name),
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+// emailUser queues the notification for users with a verified address.
+// Retries are left to the email client.
+func (n *Notifier) emailUser(ctx context.Context, sub *database.ListNotificationSubscribersRow, e Event, text string) error {
+	if sub.Email == nil || !sub.EmailVerified {
+		return nil
+	}
+
+	sender := &emailSender{n.email, []email.Address{{Name: sub.Username, Email: *sub.Email}}}
+	return sender.Send(ctx, &Notification{e, text})
+}
+
+// pushUser sends the notification to every browser the user subscribed,
+// removing subscriptions the push service no longer recognises.
+func (n *Notifier) pushUser(ctx context.Context, sub *database.ListNotificationSubscribersRow, e Event, text string) error {
+	if n.pusher == nil {
+		return nil
+	}
+
+	subscriptions, err := n.query.ListPushSubscriptions(ctx, sub.ID)
+	if err != nil {
+		return err
+	}
+
+	title, body, ok := strings.Cut(text, "\n")
+	if !ok {
+		title, body = "herobrian", text
+	}
+
+	payload, err := json.Marshal(&pushPayload{
+		Title: title,
+		Body:  body,
+		Tag:   subject(e),
+		URL:   "/",
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, s := range subscriptions {
+		target := &PushSubscription{Endpoint: s.Endpoint}
+		target.Keys.P256dh = s.P256dh
+		target.Keys.Auth = s.Auth
+
+		pushCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := n.pusher.Push(pushCtx, target, payload)
+		cancel()
+
+		if errors.Is(err, ErrPushSubscriptionGone) {
+			err = n.query.RemovePushSubscriptionByEndpoint(ctx, s.Endpoint)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// subject groups events that describe the same thing, e.g. every status of
+// the linode or of a single unit.
+func subject(e Event) string {
+	kind, _, _ := strings.Cut(e.Name, ".")
+	if e.Instance == "" {
+		return kind
+	}
+
+	return kind + ":" + e.Instance
+}
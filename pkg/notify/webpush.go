@@ -0,0 +1,275 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	pushRecordSize = 4096
+	pushTTL        = 24 * time.Hour
+	vapidLifetime  = 12 * time.Hour
+)
+
+var (
+	ErrPushSubscriptionGone = errors.New("push subscription is no longer valid")
+	ErrInvalidPushKeys      = errors.New("invalid push subscription keys")
+	ErrInvalidVAPIDKey      = errors.New("invalid VAPID key")
+)
+
+type (
+	// PushSubscription is the browser's subscription as returned by
+	// PushManager.subscribe. Keys are base64url encoded.
+	PushSubscription struct {
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			P256dh string `json:"p256dh"`
+			Auth   string `json:"auth"`
+		} `json:"keys"`
+	}
+
+	// Pusher sends encrypted Web Push messages (RFC 8291) identified to
+	// the push service with VAPID (RFC 8292).
+	Pusher struct {
+		client    *http.Client
+		subject   string
+		publicKey string
+		key       *ecdsa.PrivateKey
+	}
+)
+
+// PublicKey returns the base64url encoded application server key passed to
+// PushManager.subscribe.
+func (p *Pusher) PublicKey() string {
+	return p.publicKey
+}
+
+// Push encrypts the payload for the subscription and posts it to the push
+// service. ErrPushSubscriptionGone is returned when the service reports
+// the subscription expired or was removed.
+func (p *Pusher) Push(ctx context.Context, sub *PushSubscription, payload []byte) error {
+	body, err := encryptPush(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := parseEndpoint(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": time.Now().Add(vapidLifetime).Unix(),
+		"sub": p.subject,
+	}).SignedString(p.key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", token, p.publicKey))
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(pushTTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound, res.StatusCode == http.StatusGone:
+		return ErrPushSubscriptionGone
+	case res.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("received invalid status code %d: %s", res.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// encryptPush encodes the payload as a single aes128gcm record keyed from
+// an ephemeral ECDH exchange with the subscription's public key.
+func encryptPush(sub *PushSubscription, payload []byte) ([]byte, error) {
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return sealPush(sub, payload, asKey, salt)
+}
+
+// sealPush encrypts the payload with the given application server key and
+// salt.
+func sealPush(sub *PushSubscription, payload []byte, asKey *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaPublic, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPushKeys, err)
+	}
+	authSecret, err := decodeBase64URL(sub.Keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPushKeys, err)
+	}
+
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPushKeys, err)
+	}
+
+	asPublic := asKey.PublicKey().Bytes()
+
+	shared, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info := append([]byte("WebPush: info\x00"), uaPublic...)
+	info = append(info, asPublic...)
+	ikm, err := expand(shared, authSecret, info, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	cek, err := expand(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := expand(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single record is terminated by the 0x02 padding delimiter.
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	if len(plaintext)+gcm.Overhead() > pushRecordSize {
+		return nil, fmt.Errorf("push payload of %d bytes is too large", len(payload))
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, pushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+func expand(secret, salt, info []byte, n int) ([]byte, error) {
+	out := make([]byte, n)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(trimPadding(s))
+}
+
+func trimPadding(s string) string {
+	for len(s) > 0 && s[len(s)-1] == '=' {
+		s = s[:len(s)-1]
+	}
+
+	return s
+}
+
+// GenerateVAPIDKeys returns a new base64url encoded VAPID key pair.
+func GenerateVAPIDKeys() (publicKey, privateKey string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.Bytes()), nil
+}
+
+// NewPusher returns nil if no VAPID key is configured, which disables Web
+// Push delivery.
+func NewPusher(opts VAPIDOptions, client *http.Client) (*Pusher, error) {
+	if opts.PrivateKey == "" {
+		return nil, nil
+	}
+	if opts.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidVAPIDKey)
+	}
+
+	d, err := decodeBase64URL(opts.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidVAPIDKey, err)
+	}
+
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidVAPIDKey, err)
+	}
+
+	public := key.PublicKey().Bytes()
+	publicKey := base64.RawURLEncoding.EncodeToString(public)
+	if opts.PublicKey != "" && trimPadding(opts.PublicKey) != publicKey {
+		return nil, fmt.Errorf("%w: public key does not match private key", ErrInvalidVAPIDKey)
+	}
+
+	// Push services answer directly; following a redirect would let an
+	// endpoint send the request somewhere else.
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &Pusher{
+		client:    &noRedirect,
+		subject:   opts.Subject,
+		publicKey: publicKey,
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: new(big.Int).SetBytes(d),
+		},
+	}, nil
+}
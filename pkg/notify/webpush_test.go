@@ -0,0 +1,265 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Keys and expected output from RFC 8291 Appendix A.
+const (
+	rfcPlaintext = "When I grow up, I want to be a watermelon"
+	rfcASPrivate = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+	rfcUAPublic  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	rfcUAPrivate = "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"
+	rfcSalt      = "DGv6ra1nlYgDCS1FRnbzlw"
+	rfcAuth      = "BTBZMqHH6r4Tts7J_aSIgg"
+	rfcMessage   = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func rfcSubscription() *PushSubscription {
+	sub := &PushSubscription{Endpoint: "https://fcm.googleapis.com/fcm/send/rfc8291"}
+	sub.Keys.P256dh = rfcUAPublic
+	sub.Keys.Auth = rfcAuth
+
+	return sub
+}
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := decodeBase64URL(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// decryptPush reverses encryptPush with the user agent's private key.
+func decryptPush(t *testing.T, uaPrivate, authSecret, body []byte) []byte {
+	t.Helper()
+
+	if len(body) < 21 || len(body) < 21+int(body[20]) {
+		t.Fatalf("message of %d bytes is too short", len(body))
+	}
+	salt, idlen := body[:16], int(body[20])
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != pushRecordSize {
+		t.Errorf("record size is %d, want %d", rs, pushRecordSize)
+	}
+
+	uaKey, err := ecdh.P256().NewPrivateKey(uaPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asKey, err := ecdh.P256().NewPublicKey(body[21 : 21+idlen])
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := uaKey.ECDH(asKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := append([]byte("WebPush: info\x00"), uaKey.PublicKey().Bytes()...)
+	info = append(info, asKey.Bytes()...)
+	ikm, err := expand(shared, authSecret, info, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cek, err := expand(ikm, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := expand(ikm, salt, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, body[21+idlen:], nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatalf("record is missing the padding delimiter")
+	}
+
+	return plaintext[:len(plaintext)-1]
+}
+
+func TestSealPushKnownAnswer(t *testing.T) {
+	asKey, err := ecdh.P256().NewPrivateKey(mustDecode(t, rfcASPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := sealPush(rfcSubscription(), []byte(rfcPlaintext), asKey, mustDecode(t, rfcSalt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := base64.RawURLEncoding.EncodeToString(body); got != rfcMessage {
+		t.Errorf("got message\n%s\nwant\n%s", got, rfcMessage)
+	}
+}
+
+func TestEncryptPushRoundTrip(t *testing.T) {
+	body, err := encryptPush(rfcSubscription(), []byte(rfcPlaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.HasPrefix(body, mustDecode(t, rfcSalt)) {
+		t.Error("salt is not random")
+	}
+	got := decryptPush(t, mustDecode(t, rfcUAPrivate), mustDecode(t, rfcAuth), body)
+	if string(got) != rfcPlaintext {
+		t.Errorf("got %q, want %q", got, rfcPlaintext)
+	}
+}
+
+func TestPushSignsVAPID(t *testing.T) {
+	publicKey, privateKey, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req *http.Request
+	var body []byte
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+		return &http.Response{StatusCode: http.StatusCreated, Body: http.NoBody, Request: r}, nil
+	})}
+
+	pusher, err := NewPusher(VAPIDOptions{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Subject:    "mailto:admin@example.com",
+	}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pusher.PublicKey() != publicKey {
+		t.Errorf("public key is %s, want %s", pusher.PublicKey(), publicKey)
+	}
+
+	if err = pusher.Push(context.Background(), rfcSubscription(), []byte(rfcPlaintext)); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, ok := strings.CutPrefix(req.Header.Get("Authorization"), "vapid t=")
+	if !ok {
+		t.Fatalf("unexpected authorization header %q", req.Header.Get("Authorization"))
+	}
+	token, k, ok := strings.Cut(auth, ", k=")
+	if !ok || k != publicKey {
+		t.Fatalf("authorization header has key %q, want %q", k, publicKey)
+	}
+
+	public := mustDecode(t, publicKey)
+	verifyKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(public[1:33]),
+		Y:     new(big.Int).SetBytes(public[33:]),
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return verifyKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		t.Fatalf("VAPID token does not verify: %v", err)
+	}
+	if claims["aud"] != "https://fcm.googleapis.com" {
+		t.Errorf("aud is %v", claims["aud"])
+	}
+	if claims["sub"] != "mailto:admin@example.com" {
+		t.Errorf("sub is %v", claims["sub"])
+	}
+
+	if req.Header.Get("Content-Encoding") != "aes128gcm" {
+		t.Errorf("content encoding is %q", req.Header.Get("Content-Encoding"))
+	}
+	got := decryptPush(t, mustDecode(t, rfcUAPrivate), mustDecode(t, rfcAuth), body)
+	if string(got) != rfcPlaintext {
+		t.Errorf("got %q, want %q", got, rfcPlaintext)
+	}
+}
+
+func TestPushRefusesUnknownServices(t *testing.T) {
+	publicKey, privateKey, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected request to %s", r.URL)
+		return &http.Response{StatusCode: http.StatusCreated, Body: http.NoBody, Request: r}, nil
+	})}
+	pusher, err := NewPusher(VAPIDOptions{PublicKey: publicKey, PrivateKey: privateKey, Subject: "mailto:admin@example.com"}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, endpoint := range []string{
+		"http://fcm.googleapis.com/fcm/send/x",
+		"https://169.254.169.254/latest/meta-data",
+		"https://localhost/push",
+		"https://fcm.googleapis.com.example.com/x",
+		"https://evilfcm.googleapis.com.attacker.net/x",
+		"https://fcm.googleapis.com:8443/x",
+		"https://user@fcm.googleapis.com/x",
+	} {
+		sub := rfcSubscription()
+		sub.Endpoint = endpoint
+		if err := sub.Validate(); !errors.Is(err, ErrInvalidPushKeys) {
+			t.Errorf("Validate(%s) = %v, want ErrInvalidPushKeys", endpoint, err)
+		}
+		if err := pusher.Push(context.Background(), sub, nil); !errors.Is(err, ErrInvalidPushKeys) {
+			t.Errorf("Push(%s) = %v, want ErrInvalidPushKeys", endpoint, err)
+		}
+	}
+
+	for _, endpoint := range []string{
+		"https://fcm.googleapis.com/fcm/send/x",
+		"https://updates.push.services.mozilla.com/wpush/v2/x",
+		"https://web.push.apple.com/x",
+		"https://wns2-par02p.notify.windows.com/w/?token=x",
+	} {
+		sub := rfcSubscription()
+		sub.Endpoint = endpoint
+		if err := sub.Validate(); err != nil {
+			t.Errorf("Validate(%s) = %v", endpoint, err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+// Package openapi builds OpenAPI 3.1 documents from registered routes, with
+// schemas reflected from the request and response types.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const problemSchema = "Problem"
+
+type (
+	Document struct {
+		OpenAPI    string                `json:"openapi"`
+		Info       Info                  `json:"info"`
+		Servers    []Server              `json:"servers,omitempty"`
+		Paths      map[string]*PathItem  `json:"paths"`
+		Components Components            `json:"components"`
+		Security   []SecurityRequirement `json:"security"`
+
+		prefix string
+	}
+
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+
+	Server struct {
+		URL string `json:"url"`
+	}
+
+	// PathItem maps lowercase methods to their operations.
+	PathItem map[string]*operation
+
+	Components struct {
+		Schemas         map[string]*Schema         `json:"schemas"`
+		SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+	}
+
+	SecurityScheme struct {
+		Type   string `json:"type"`
+		Scheme string `json:"scheme"`
+	}
+
+	SecurityRequirement map[string][]string
+
+	Schema struct {
+		Ref                  string             `json:"$ref,omitempty"`
+		Type                 any                `json:"type,omitempty"`
+		Format               string             `json:"format,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+		AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	}
+
+	// Operation describes a route. Request and Response are zero values of
+	// the body types, or nil if there is no body. Params gives the schema of
+	// path parameters that are not strings, and Query of optional query
+	// parameters. Responses are JSON unless another ContentType is given.
+	Operation struct {
+		ID          string
+		Summary     string
+		Tag         string
+		Params      map[string]*Schema
+		Query       map[string]*Schema
+		Request     any
+		Response    any
+		ContentType string
+		Status      int
+		// Public operations need no token.
+		Public bool
+	}
+
+	operation struct {
+		OperationID string                `json:"operationId"`
+		Summary     string                `json:"summary,omitempty"`
+		Tags        []string              `json:"tags,omitempty"`
+		Parameters  []parameter           `json:"parameters,omitempty"`
+		RequestBody *requestBody          `json:"requestBody,omitempty"`
+		Responses   map[string]*response  `json:"responses"`
+		Security    []SecurityRequirement `json:"security,omitempty"`
+	}
+
+	parameter struct {
+		Name     string  `json:"name"`
+		In       string  `json:"in"`
+		Required bool    `json:"required"`
+		Schema   *Schema `json:"schema"`
+	}
+
+	requestBody struct {
+		Required bool                  `json:"required"`
+		Content  map[string]*mediaType `json:"content"`
+	}
+
+	response struct {
+		Description string                `json:"description"`
+		Content     map[string]*mediaType `json:"content,omitempty"`
+	}
+
+	mediaType struct {
+		Schema *Schema `json:"schema"`
+	}
+)
+
+var (
+	// Integer is the schema of integer path parameters.
+	Integer = &Schema{Type: "integer", Format: "int64"}
+	// UUID is the schema of UUID path parameters.
+	UUID = &Schema{Type: "string", Format: "uuid"}
+
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// New creates a document for the routes under prefix, which are
+// authenticated by bearer token unless marked public.
+func New(title, version, prefix string) *Document {
+	return &Document{
+		OpenAPI: "3.1.0",
+		Info:    Info{title, version},
+		Servers: []Server{{prefix}},
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas: map[string]*Schema{
+				problemSchema: {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"type":   {Type: "string"},
+						"title":  {Type: "string"},
+						"status": {Type: "integer"},
+						"detail": {Type: "string"},
+					},
+					Required: []string{"type", "title", "status"},
+				},
+			},
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer"},
+			},
+		},
+		Security: []SecurityRequirement{{"bearer": {}}},
+		prefix:   prefix,
+	}
+}
+
+// Add documents the route. The path is given as registered with echo,
+// relative to the document's prefix.
+func (d *Document) Add(method, path string, op Operation) {
+	item, ok := d.Paths[specPath(path)]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[specPath(path)] = item
+	}
+
+	out := &operation{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Responses: map[string]*response{
+			"default": {
+				Description: "Problem details describing the error",
+				Content: map[string]*mediaType{
+					"application/problem+json": {&Schema{Ref: ref(problemSchema)}},
+				},
+			},
+		},
+	}
+	if op.Tag != "" {
+		out.Tags = []string{op.Tag}
+	}
+	if op.Public {
+		out.Security = []SecurityRequirement{{}}
+	}
+
+	for _, name := range pathParams(path) {
+		schema, ok := op.Params[name]
+		if !ok {
+			schema = &Schema{Type: "string"}
+		}
+		out.Parameters = append(out.Parameters, parameter{name, "path", true, schema})
+	}
+	query := make([]string, 0, len(op.Query))
+	for name := range op.Query {
+		query = append(query, name)
+	}
+	slices.Sort(query)
+	for _, name := range query {
+		out.Parameters = append(out.Parameters, parameter{name, "query", false, op.Query[name]})
+	}
+
+	if op.Request != nil {
+		out.RequestBody = &requestBody{
+			Required: true,
+			Content: map[string]*mediaType{
+				echo.MIMEApplicationJSON: {d.schemaOf(reflect.TypeOf(op.Request))},
+			},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	res := &response{Description: http.StatusText(status)}
+	if op.Response != nil {
+		contentType := op.ContentType
+		if contentType == "" {
+			contentType = echo.MIMEApplicationJSON
+		}
+		res.Content = map[string]*mediaType{
+			contentType: {d.schemaOf(reflect.TypeOf(op.Response))},
+		}
+	}
+	out.Responses[fmt.Sprint(status)] = res
+
+	(*item)[strings.ToLower(method)] = out
+}
+
+// Missing lists the routes under the document's prefix that it does not
+// describe.
+func (d *Document) Missing(routes []*echo.Route) []string {
+	missing := make([]string, 0)
+	for _, route := range routes {
+		path, ok := strings.CutPrefix(route.Path, d.prefix)
+		if !ok || route.Method == echo.RouteNotFound {
+			continue
+		}
+
+		item, ok := d.Paths[specPath(path)]
+		if !ok || (*item)[strings.ToLower(route.Method)] == nil {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+
+	slices.Sort(missing)
+	return missing
+}
+
+// schemaOf reflects the JSON schema of the type, adding named structs to the
+// document's components.
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := d.schemaOf(t.Elem())
+		if schema.Ref != "" {
+			return schema
+		}
+		return &Schema{Type: []any{schema.Type, "null"}, Format: schema.Format}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// reserve the name first, in case the type refers to itself
+			d.Components.Schemas[t.Name()] = &Schema{}
+			*d.Components.Schemas[t.Name()] = *d.structSchema(t)
+		}
+		return &Schema{Ref: ref(t.Name())}
+	default:
+		return &Schema{}
+	}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || name == "" {
+			continue
+		}
+
+		schema.Properties[name] = d.schemaOf(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// specPath converts echo's :param segments to OpenAPI's {param}.
+func specPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if name, ok := strings.CutPrefix(s, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func pathParams(path string) []string {
+	params := make([]string, 0)
+	for _, s := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(s, ":"); ok {
+			params = append(params, name)
+		}
+	}
+
+	return params
+}
+
+func ref(name string) string {
+	return "#/components/schemas/" + name
+}
@@ -2,6 +2,7 @@ package systemd
 
 import (
 	"context"
+	"io"
 )
 
 type Client interface {
@@ -11,6 +12,9 @@ type Client interface {
 	Start(context.Context, Unit) error
 	Stop(context.Context, Unit) error
 	Restart(context.Context, Unit) error
+	// Logs streams the unit's journal, starting with the last lines, until
+	// the context ends or, unless following, the journal is read.
+	Logs(ctx context.Context, unit Unit, lines int, follow bool) (io.ReadCloser, error)
 }
 
 type ClientOptions[T any] struct {
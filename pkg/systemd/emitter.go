@@ -32,7 +32,7 @@ func (se *emitter) Close() error {
 	return nil
 }
 
-func NewEmitter(services *ServiceFactory, logger *slog.Logger) (Emitter, error) {
+func NewEmitter(services *ServiceFactory, registry *worker.Registry, logger *slog.Logger) (Emitter, error) {
 	e := event.NewEmitter[string, Status]()
 
 	errs := make([]error, 0)
@@ -51,6 +51,7 @@ func NewEmitter(services *ServiceFactory, logger *slog.Logger) (Emitter, error)
 			continue
 		}
 
+		registry.Register(wrk)
 		wrks = append(wrks, wrk)
 	}
 
@@ -3,17 +3,27 @@ package systemd
 import "fmt"
 
 type ServiceFactory struct {
-	opts *ClientOptions[SSH]
+	opts       *ClientOptions[SSH]
+	decorators []func(Client) Client
 }
 
 func (f ServiceFactory) Units() []Unit { return f.opts.Units }
 
+// Use registers decorators which wrap every client created by the factory.
+func (f *ServiceFactory) Use(decorators ...func(Client) Client) {
+	f.decorators = append(f.decorators, decorators...)
+}
+
 func (f *ServiceFactory) Create(instance string) (*Service, error) {
 	client, err := NewSSH(f.opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SSH systemd client: %w", err)
 	}
 
+	for _, decorate := range f.decorators {
+		client = decorate(client)
+	}
+
 	for _, unit := range f.opts.Units {
 		if unit.Instance == instance {
 			return &Service{
@@ -27,5 +37,5 @@ func (f *ServiceFactory) Create(instance string) (*Service, error) {
 }
 
 func NewServiceFactory(opts *ClientOptions[SSH]) *ServiceFactory {
-	return &ServiceFactory{opts}
+	return &ServiceFactory{opts: opts}
 }
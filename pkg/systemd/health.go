@@ -0,0 +1,33 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bdreece/herobrian/pkg/health"
+)
+
+// NewHealthCheck verifies that the systemd host is reachable over SSH with
+// the configured credentials.
+func NewHealthCheck(opts *ClientOptions[SSH]) health.Check {
+	name := fmt.Sprintf("systemd/%s", opts.Transport.Address)
+	return health.NewCheck(name, func(ctx context.Context) error {
+		errch := make(chan error, 1)
+		go func() {
+			client, err := NewSSH(opts)
+			if err != nil {
+				errch <- err
+				return
+			}
+
+			errch <- client.(*sshClient).Close()
+		}()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errch:
+			return err
+		}
+	})
+}
@@ -3,12 +3,16 @@ package systemd
 import (
 	"context"
 	"fmt"
+	"io"
 )
 
 type Unit struct {
 	Name        string `yaml:"name"`
 	Description string `yaml:"description"`
 	Instance    string `yaml:"instance"`
+	// Port is the Minecraft server port of this instance, if it should be
+	// queried for player counts.
+	Port int `yaml:"port"`
 }
 
 type Service struct {
@@ -43,3 +47,7 @@ func (svc Service) Stop(ctx context.Context) error {
 func (svc Service) Restart(ctx context.Context) error {
 	return svc.client.Restart(ctx, svc.unit)
 }
+
+func (svc Service) Logs(ctx context.Context, lines int, follow bool) (io.ReadCloser, error) {
+	return svc.client.Logs(ctx, svc.unit, lines, follow)
+}
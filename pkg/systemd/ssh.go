@@ -3,6 +3,7 @@ package systemd
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 
 	"github.com/melbahja/goph"
@@ -75,7 +76,7 @@ func (c *sshClient) Disable(ctx context.Context, unit Unit) error {
 func (c *sshClient) Start(ctx context.Context, unit Unit) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	_, err := c.Run(fmt.Sprintf("sudo systemctl stop %s", unit))
+	_, err := c.Run(fmt.Sprintf("sudo systemctl start %s", unit))
 	if err != nil {
 		return fmt.Errorf("failed to start systemd service %q: %w", unit, err)
 	}
@@ -105,6 +106,46 @@ func (c *sshClient) Restart(ctx context.Context, unit Unit) error {
 	return nil
 }
 
+// Logs runs journalctl in its own session, without holding the lock, as
+// following may last indefinitely. The remote user must be able to read the
+// system journal, such as through the systemd-journal group.
+func (c *sshClient) Logs(ctx context.Context, unit Unit, lines int, follow bool) (io.ReadCloser, error) {
+	sess, err := c.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ssh session: %w", err)
+	}
+
+	out, err := sess.StdoutPipe()
+	if err != nil {
+		sess.Close()
+		return nil, fmt.Errorf("failed to pipe journal output: %w", err)
+	}
+
+	cmd := fmt.Sprintf("journalctl --unit %s --lines %d --no-pager --output short-iso", unit, lines)
+	if follow {
+		cmd += " --follow"
+	}
+	if err = sess.Start(cmd); err != nil {
+		sess.Close()
+		return nil, fmt.Errorf("failed to read journal of systemd service %q: %w", unit, err)
+	}
+
+	stop := context.AfterFunc(ctx, func() { sess.Close() })
+	return &journal{out, sess, stop}, nil
+}
+
+// journal closes the session once the logs have been read.
+type journal struct {
+	io.Reader
+	sess io.Closer
+	stop func() bool
+}
+
+func (j *journal) Close() error {
+	j.stop()
+	return j.sess.Close()
+}
+
 func NewSSH(opts *ClientOptions[SSH]) (Client, error) {
 	key, err := opts.Transport.Key()
 	if err != nil {
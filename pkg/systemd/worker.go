@@ -18,30 +18,38 @@ type workerParams struct {
 	Logger   *slog.Logger
 }
 
-func newWorkerService(p workerParams) (worker.Service, error) {
-	return worker.NewService(func(ctx context.Context) error {
-		ticker := time.NewTicker(p.Interval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-ticker.C:
-				service, err := p.Factory.Create(p.Instance)
-				if err != nil {
-					p.Logger.Error("something bad happened", slog.String("error", err.Error()))
-					continue
-				}
-
-				status, err := service.Status(ctx)
-				if err != nil {
-					p.Logger.Error("something bad happened", slog.String("error", err.Error()))
-					return fmt.Errorf("failed to refresh service status: %w", err)
-				}
-
-				p.Emitter.Publish(p.Instance, *status)
+func newWorkerService(p workerParams) (worker.Supervisor, error) {
+	return worker.NewSupervisor(worker.SupervisorParams{
+		Name:   fmt.Sprintf("systemd/%s", p.Instance),
+		Run:    p.run,
+		Policy: worker.DefaultRestartPolicy,
+		Logger: p.Logger,
+	}), nil
+}
+
+func (p workerParams) run(ctx context.Context) error {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			service, err := p.Factory.Create(p.Instance)
+			if err != nil {
+				p.Logger.Error("failed to create systemd service",
+					slog.String("instance", p.Instance),
+					slog.String("error", err.Error()))
+				continue
 			}
+
+			status, err := service.Status(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to refresh service status: %w", err)
+			}
+
+			p.Emitter.Publish(p.Instance, *status)
 		}
-	}), nil
+	}
 }
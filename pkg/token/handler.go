@@ -13,10 +13,24 @@ import (
 type (
 	PasswordResetClaims struct {
 		UserID int `mapstructure:"sub"`
+		// Version is the user's session version when the token was signed.
+		// Resetting the password bumps it, so each token is single-use.
+		Version int64 `mapstructure:"ver"`
+	}
+
+	EmailVerificationClaims struct {
+		UserID int    `mapstructure:"sub"`
+		Email  string `mapstructure:"email"`
 	}
 
 	UserInviteClaims struct {
-		RoleID int `mapstructure:"role"`
+		// ID overrides the generated token ID, so that the invite can be
+		// persisted before it is signed.
+		ID string `mapstructure:"jti,omitempty"`
+		// ExpiresAt overrides the configured validity, in seconds since the
+		// Unix epoch.
+		ExpiresAt int64 `mapstructure:"exp,omitempty"`
+		RoleID    int   `mapstructure:"role"`
 	}
 
 	Handler[C any] interface {
@@ -0,0 +1,33 @@
+package worker
+
+import "sync"
+
+// Registry tracks every Supervisor in the application so that their
+// health can be reported in one place.
+type Registry struct {
+	mu          sync.RWMutex
+	supervisors []Supervisor
+}
+
+func (r *Registry) Register(supervisors ...Supervisor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.supervisors = append(r.supervisors, supervisors...)
+}
+
+func (r *Registry) Health() []Health {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	health := make([]Health, 0, len(r.supervisors))
+	for _, s := range r.supervisors {
+		health = append(health, s.Health())
+	}
+
+	return health
+}
+
+func NewRegistry() *Registry {
+	return new(Registry)
+}
@@ -7,8 +7,10 @@ import (
 )
 
 var (
-	ErrWorkerStopped = errors.New("worker stopped")
-	ErrWorkerTimeout = errors.New("worker failed to shutdown before timeout")
+	ErrWorkerStarted  = errors.New("worker already started")
+	ErrWorkerStopped  = errors.New("worker stopped")
+	ErrWorkerTimeout  = errors.New("worker failed to shutdown before timeout")
+	ErrWorkerPanicked = errors.New("worker panicked")
 )
 
 type RunFunc func(context.Context) error
@@ -16,51 +18,16 @@ type RunFunc func(context.Context) error
 type Service interface {
 	// Start launches the routine's Run method on a new goroutine.
 	Start(context.Context) error
-	// Stop cancels the previously started goroutine.
+	// Stop cancels the previously started goroutine and waits for it to exit.
 	Stop(context.Context) error
 }
 
-type service struct {
-	run    RunFunc
-	cancel context.CancelCauseFunc
-	err    error
-}
-
-func (ws *service) Start(ctx context.Context) error {
-	if ctx.Err() != nil {
-		return ctx.Err()
-	}
-
-	ctx, cancel := context.WithCancelCause(ctx)
-	ws.cancel = cancel
-
-	go func() {
-		ws.err = ws.run(ctx)
-	}()
-
-	return nil
-}
-
-func (ws *service) Stop(ctx context.Context) error {
-	ctx, cancel := context.WithTimeoutCause(ctx, 5*time.Second, ErrWorkerTimeout)
-	defer cancel()
-
-	ch := make(chan struct{}, 1)
-	go func() {
-		ws.cancel(ErrWorkerStopped)
-		ch <- struct{}{}
-	}()
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-ch:
-		return ws.err
-	}
-}
-
+// NewService creates a Service which runs once and is never restarted.
 func NewService(run RunFunc) Service {
-	return &service{run: run}
+	return NewSupervisor(SupervisorParams{
+		Run:    run,
+		Policy: RestartPolicy{MaxRestarts: -1},
+	})
 }
 
 func Start(ctx context.Context, services ...Service) error {
@@ -104,3 +71,7 @@ func Stop(ctx context.Context, services ...Service) error {
 
 	return errors.Join(errs...)
 }
+
+func stopTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ctx, 5*time.Second, ErrWorkerTimeout)
+}
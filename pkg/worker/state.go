@@ -0,0 +1,14 @@
+//go:generate go run golang.org/x/tools/cmd/stringer@latest -type State -trimprefix State
+package worker
+
+type State int
+
+const (
+	StateStopped State = iota
+	StateRunning
+	StateBackoff
+)
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
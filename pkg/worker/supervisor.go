@@ -0,0 +1,249 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type (
+	// RestartPolicy controls how a Supervisor restarts a crashed worker.
+	// A negative MaxRestarts disables restarts, and zero allows unlimited
+	// restarts.
+	RestartPolicy struct {
+		InitialBackoff time.Duration `yaml:"initial_backoff"`
+		MaxBackoff     time.Duration `yaml:"max_backoff"`
+		MaxRestarts    int           `yaml:"max_restarts"`
+	}
+
+	Health struct {
+		Name      string    `json:"name"`
+		State     State     `json:"state"`
+		Crashes   int       `json:"crashes"`
+		LastError string    `json:"last_error,omitempty"`
+		Since     time.Time `json:"since"`
+	}
+
+	Supervisor interface {
+		Service
+
+		Name() string
+		Health() Health
+	}
+
+	SupervisorParams struct {
+		Name   string
+		Run    RunFunc
+		Policy RestartPolicy
+		Logger *slog.Logger
+	}
+
+	supervisor struct {
+		name   string
+		run    RunFunc
+		policy RestartPolicy
+		logger *slog.Logger
+
+		mu      sync.RWMutex
+		state   State
+		crashes int
+		err     error
+		since   time.Time
+		cancel  context.CancelCauseFunc
+		done    chan struct{}
+	}
+)
+
+var DefaultRestartPolicy = RestartPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+}
+
+func (s *supervisor) Name() string { return s.name }
+
+func (s *supervisor) Health() Health {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h := Health{
+		Name:    s.name,
+		State:   s.state,
+		Crashes: s.crashes,
+		Since:   s.since,
+	}
+
+	if s.err != nil {
+		h.LastError = s.err.Error()
+	}
+
+	return h
+}
+
+// Start implements Service.
+func (s *supervisor) Start(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done != nil {
+		return ErrWorkerStarted
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go s.supervise(ctx, cancel, s.done)
+
+	return nil
+}
+
+// Stop implements Service. The supervisor cannot be started again until the
+// worker has returned, even if ctx expires first.
+func (s *supervisor) Stop(ctx context.Context) error {
+	s.mu.RLock()
+	cancel, done := s.cancel, s.done
+	s.mu.RUnlock()
+
+	if done == nil {
+		return nil
+	}
+
+	ctx, stop := stopTimeout(ctx)
+	defer stop()
+
+	cancel(ErrWorkerStopped)
+
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-done:
+		return nil
+	}
+}
+
+func (s *supervisor) supervise(ctx context.Context, cancel context.CancelCauseFunc, done chan struct{}) {
+	defer func() {
+		cancel(ErrWorkerStopped)
+
+		s.mu.Lock()
+		if s.done == done {
+			s.cancel, s.done = nil, nil
+		}
+		s.mu.Unlock()
+
+		close(done)
+	}()
+
+	backoff := s.policy.InitialBackoff
+	for {
+		s.transition(StateRunning)
+
+		started := time.Now()
+		err := s.call(ctx)
+		if ctx.Err() != nil || err == nil {
+			s.transition(StateStopped)
+			return
+		}
+
+		crashes := s.crash(err)
+		if s.policy.MaxRestarts < 0 || (s.policy.MaxRestarts > 0 && crashes > s.policy.MaxRestarts) {
+			s.logger.Error("worker crashed, giving up",
+				slog.String("worker", s.name),
+				slog.Int("crashes", crashes),
+				slog.String("error", err.Error()))
+
+			s.transition(StateStopped)
+			return
+		}
+
+		// a worker which stayed up longer than the maximum backoff is
+		// considered to have recovered
+		if time.Since(started) > s.policy.MaxBackoff {
+			backoff = s.policy.InitialBackoff
+		}
+
+		s.logger.Warn("worker crashed, restarting",
+			slog.String("worker", s.name),
+			slog.Int("crashes", crashes),
+			slog.Duration("backoff", backoff),
+			slog.String("error", err.Error()))
+
+		s.transition(StateBackoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.transition(StateStopped)
+			return
+		case <-timer.C:
+		}
+
+		backoff = min(2*backoff, s.policy.MaxBackoff)
+	}
+}
+
+// call runs the worker, returning a panic as an error so that it is
+// restarted like any other crash.
+func (s *supervisor) call(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("worker panicked",
+				slog.String("worker", s.name),
+				slog.Any("panic", r),
+				slog.String("stack", string(debug.Stack())))
+
+			err = fmt.Errorf("%w: %v", ErrWorkerPanicked, r)
+		}
+	}()
+
+	return s.run(ctx)
+}
+
+func (s *supervisor) transition(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = state
+	s.since = time.Now()
+}
+
+func (s *supervisor) crash(err error) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.crashes++
+	s.err = err
+
+	return s.crashes
+}
+
+func NewSupervisor(p SupervisorParams) Supervisor {
+	policy := p.Policy
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultRestartPolicy.InitialBackoff
+	}
+	if policy.MaxBackoff < policy.InitialBackoff {
+		policy.MaxBackoff = max(DefaultRestartPolicy.MaxBackoff, policy.InitialBackoff)
+	}
+
+	logger := p.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &supervisor{
+		name:   p.Name,
+		run:    p.Run,
+		policy: policy,
+		logger: logger,
+		since:  time.Now(),
+	}
+}
@@ -0,0 +1,236 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testPolicy = RestartPolicy{
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     4 * time.Millisecond,
+}
+
+// failing returns a RunFunc which fails n times, then runs until it is
+// cancelled.
+func failing(n int32, calls *atomic.Int32) RunFunc {
+	return func(ctx context.Context) error {
+		if call := calls.Add(1); call <= n {
+			return fmt.Errorf("crash %d", call)
+		}
+
+		<-ctx.Done()
+		return ctx.Err()
+	}
+}
+
+// waitFor polls the supervisor's health until cond holds.
+func waitFor(t *testing.T, s Supervisor, cond func(Health) bool) Health {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h := s.Health()
+		if cond(h) {
+			return h
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for health, last %+v", h)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSupervisorRestarts(t *testing.T) {
+	var calls atomic.Int32
+	s := NewSupervisor(SupervisorParams{Name: "test", Run: failing(3, &calls), Policy: testPolicy})
+
+	if h := s.Health(); h.State != StateStopped || h.Crashes != 0 {
+		t.Errorf("unexpected health before start: %+v", h)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); !errors.Is(err, ErrWorkerStarted) {
+		t.Errorf("starting twice returned %v, want ErrWorkerStarted", err)
+	}
+
+	h := waitFor(t, s, func(h Health) bool { return h.State == StateRunning && calls.Load() == 4 })
+	if h.Name != "test" || h.Crashes != 3 || h.LastError != "crash 3" {
+		t.Errorf("unexpected health after recovering: %+v", h)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if h = s.Health(); h.State != StateStopped || h.Crashes != 3 {
+		t.Errorf("unexpected health after stop: %+v", h)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("run was called %d times, want 4", calls.Load())
+	}
+
+	// a stopped supervisor can be started again
+	if err := s.Start(context.Background()); err != nil {
+		t.Errorf("failed to restart: %v", err)
+	}
+	waitFor(t, s, func(h Health) bool { return h.State == StateRunning && calls.Load() == 5 })
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	policy := testPolicy
+	policy.MaxRestarts = 2
+	s := NewSupervisor(SupervisorParams{Name: "test", Run: failing(100, &calls), Policy: policy})
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Stop(context.Background()) })
+
+	h := waitFor(t, s, func(h Health) bool { return h.State == StateStopped && h.Crashes > 0 })
+	if h.Crashes != 3 || h.LastError != "crash 3" || calls.Load() != 3 {
+		t.Errorf("gave up with %+v after %d calls, want 3 crashes", h, calls.Load())
+	}
+
+	// a service is never restarted
+	calls.Store(0)
+	service := NewService(failing(100, &calls)).(Supervisor)
+	if err := service.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Stop(context.Background()) })
+
+	h = waitFor(t, service, func(h Health) bool { return h.State == StateStopped && h.Crashes > 0 })
+	if h.Crashes != 1 || calls.Load() != 1 {
+		t.Errorf("service stopped with %+v after %d calls, want 1 crash", h, calls.Load())
+	}
+}
+
+func TestSupervisorStopWaitsForRun(t *testing.T) {
+	var (
+		cancelled = make(chan struct{})
+		release   = make(chan struct{})
+		returned  atomic.Bool
+	)
+	s := NewSupervisor(SupervisorParams{
+		Name:   "test",
+		Policy: testPolicy,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			close(cancelled)
+
+			<-release
+			returned.Store(true)
+			return ctx.Err()
+		},
+	})
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, func(h Health) bool { return h.State == StateRunning })
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Stop(context.Background()) }()
+
+	<-cancelled
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop returned %v before run did", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("failed to stop: %v", err)
+	}
+	if !returned.Load() {
+		t.Error("Stop returned before run")
+	}
+	if h := s.Health(); h.State != StateStopped || h.Crashes != 0 {
+		t.Errorf("unexpected health after stop: %+v", h)
+	}
+}
+
+func TestSupervisorStopTimeout(t *testing.T) {
+	var (
+		release = make(chan struct{})
+		calls   atomic.Int32
+	)
+	s := NewSupervisor(SupervisorParams{
+		Name:   "test",
+		Policy: testPolicy,
+		Run: func(context.Context) error {
+			calls.Add(1)
+			<-release
+			return nil
+		},
+	})
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, func(h Health) bool { return h.State == StateRunning })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("stopping a stuck worker returned %v, want DeadlineExceeded", err)
+	}
+
+	// the worker is still running, so a second may not start beside it
+	if err := s.Start(context.Background()); !errors.Is(err, ErrWorkerStarted) {
+		t.Errorf("starting a stopping worker returned %v, want ErrWorkerStarted", err)
+	}
+
+	close(release)
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("failed to stop: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("run was called %d times, want 1", calls.Load())
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Errorf("failed to start after stopping: %v", err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSupervisorRecoversPanics(t *testing.T) {
+	var calls atomic.Int32
+	s := NewSupervisor(SupervisorParams{
+		Name:   "test",
+		Policy: testPolicy,
+		Run: func(ctx context.Context) error {
+			if calls.Add(1) <= 2 {
+				panic("creeper")
+			}
+
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Stop(context.Background()) })
+
+	h := waitFor(t, s, func(h Health) bool { return h.State == StateRunning && calls.Load() == 3 })
+	if h.Crashes != 2 || h.LastError != ErrWorkerPanicked.Error()+": creeper" {
+		t.Errorf("unexpected health after panics: %+v", h)
+	}
+}
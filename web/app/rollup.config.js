@@ -8,7 +8,7 @@ import tailwindcss from 'tailwindcss';
 
 /** @type {import('rollup').RollupOptions} */
 export default {
-    input: 'src/index.ts',
+    input: ['src/index.ts', 'src/sw.ts'],
     output: {
         dir: 'dist',
         format: 'es',
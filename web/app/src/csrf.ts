@@ -0,0 +1,10 @@
+// csrfToken reads the token the server sets in the _csrf cookie, which it
+// expects back in the X-CSRF-Token header.
+export function csrfToken(): string {
+    const cookie = document.cookie
+        .split(';')
+        .map(v => v.trim().split('='))
+        .find(([name]) => name === '_csrf');
+
+    return cookie ? decodeURIComponent(cookie[1]) : '';
+}
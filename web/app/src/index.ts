@@ -4,6 +4,9 @@ import 'htmx.org/dist/ext/sse';
 
 import './index.css';
 export { default as InviteLink } from './invite-link';
+export { default as PushSubscribe } from './push-subscribe';
+export { default as PasskeyLogin } from './passkey-login';
+export { default as PasskeyRegister } from './passkey-register';
 
 const cookies = document.cookie
     .split(';')
@@ -0,0 +1,38 @@
+import { decodeRequest, encodeCredential, post, showError, supported } from './webauthn';
+
+export default class PasskeyLogin extends HTMLButtonElement {
+    connectedCallback() {
+        if (!supported()) {
+            this.hidden = true;
+            return;
+        }
+
+        this.addEventListener('click', () => {
+            this.disabled = true;
+            this.login()
+                .then(location => window.location.assign(location))
+                .catch(err => {
+                    this.disabled = false;
+                    showError(this.dataset.result, err);
+                });
+        });
+    }
+
+    private async login(): Promise<string> {
+        const options = await post(this.dataset.begin ?? '/login/passkey/begin')
+            .then(res => res.json());
+
+        const credential = await navigator.credentials.get(decodeRequest(options));
+        if (!credential) {
+            throw new Error('No passkey was selected');
+        }
+
+        // the server answers as it does for HTMX, naming the next page
+        const res = await post(this.dataset.action ?? '/login/passkey',
+            encodeCredential(credential as PublicKeyCredential));
+
+        return res.headers.get('HX-Location') ?? '/';
+    }
+}
+
+customElements.define('passkey-login', PasskeyLogin, { extends: 'button' });
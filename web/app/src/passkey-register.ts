@@ -0,0 +1,44 @@
+import { decodeCreation, encodeCredential, post, showError, supported } from './webauthn';
+
+export default class PasskeyRegister extends HTMLButtonElement {
+    connectedCallback() {
+        if (!supported()) {
+            this.disabled = true;
+            this.title = 'This browser does not support passkeys';
+            return;
+        }
+
+        this.addEventListener('click', () => {
+            this.disabled = true;
+            this.register()
+                .then(() => location.reload())
+                .catch(err => {
+                    this.disabled = false;
+                    showError(this.dataset.result, err);
+                });
+        });
+    }
+
+    private async register() {
+        const input = document.querySelector<HTMLInputElement>(this.dataset.name ?? '#passkey-name');
+        const name = input?.value.trim() ?? '';
+        if (!name) {
+            input?.reportValidity();
+            throw new Error('Enter a name for the passkey');
+        }
+
+        const options = await post(this.dataset.begin ?? '/account/passkeys/begin')
+            .then(res => res.json());
+
+        const credential = await navigator.credentials.create(decodeCreation(options));
+        if (!credential) {
+            throw new Error('No passkey was created');
+        }
+
+        const action = this.dataset.action ?? '/account/passkeys';
+        await post(`${action}?name=${encodeURIComponent(name)}`,
+            encodeCredential(credential as PublicKeyCredential));
+    }
+}
+
+customElements.define('passkey-register', PasskeyRegister, { extends: 'button' });
@@ -0,0 +1,57 @@
+import { csrfToken } from './csrf';
+
+export default class PushSubscribe extends HTMLButtonElement {
+    connectedCallback() {
+        if (!('serviceWorker' in navigator) || !('PushManager' in window)) {
+            this.disabled = true;
+            this.title = 'This browser does not support push notifications';
+            return;
+        }
+
+        this.addEventListener('click', () => {
+            this.disabled = true;
+            this.subscribe()
+                .then(() => location.reload())
+                .catch(err => {
+                    this.disabled = false;
+                    this.title = String(err);
+                });
+        });
+    }
+
+    private async subscribe() {
+        if (await Notification.requestPermission() !== 'granted') {
+            throw new Error('Notification permission was denied');
+        }
+
+        const registration = await navigator.serviceWorker.register('/sw.js');
+        await navigator.serviceWorker.ready;
+
+        const subscription = await registration.pushManager.subscribe({
+            userVisibleOnly: true,
+            applicationServerKey: decodeKey(this.dataset.key ?? ''),
+        });
+
+        const res = await fetch(this.dataset.action ?? '/account/notifications/push', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
+            },
+            body: JSON.stringify(subscription),
+        });
+        if (!res.ok) {
+            throw new Error(await res.text());
+        }
+    }
+}
+
+function decodeKey(key: string): Uint8Array {
+    const base64 = (key + '='.repeat((4 - key.length % 4) % 4))
+        .replace(/-/g, '+')
+        .replace(/_/g, '/');
+
+    return Uint8Array.from(atob(base64), c => c.charCodeAt(0));
+}
+
+customElements.define('push-subscribe', PushSubscribe, { extends: 'button' });
@@ -0,0 +1,61 @@
+// Service worker showing Web Push notifications. The DOM lib is used for
+// the rest of the app, so the worker types needed here are declared below.
+
+interface PushMessage {
+    title: string;
+    body: string;
+    tag: string;
+    url: string;
+}
+
+interface ExtendableEvent extends Event {
+    waitUntil(promise: Promise<unknown>): void;
+}
+
+interface PushEvent extends ExtendableEvent {
+    data: { json(): PushMessage } | null;
+}
+
+interface NotificationEvent extends ExtendableEvent {
+    notification: Notification;
+}
+
+interface WindowClient {
+    url: string;
+    focus(): Promise<WindowClient>;
+}
+
+const worker = self as unknown as {
+    registration: ServiceWorkerRegistration;
+    clients: {
+        matchAll(options: { type: 'window' }): Promise<WindowClient[]>;
+        openWindow(url: string): Promise<WindowClient | null>;
+    };
+    addEventListener(type: 'push', listener: (e: PushEvent) => void): void;
+    addEventListener(type: 'notificationclick', listener: (e: NotificationEvent) => void): void;
+};
+
+worker.addEventListener('push', e => {
+    const message = e.data?.json();
+    if (!message) {
+        return;
+    }
+
+    e.waitUntil(worker.registration.showNotification(message.title, {
+        body: message.body,
+        tag: message.tag,
+        data: { url: message.url },
+    }));
+});
+
+worker.addEventListener('notificationclick', e => {
+    e.notification.close();
+
+    const url = new URL(e.notification.data?.url ?? '/', location.origin).href;
+    e.waitUntil(worker.clients.matchAll({ type: 'window' }).then(clients => {
+        const client = clients.find(c => c.url === url);
+        return client ? client.focus() : worker.clients.openWindow(url);
+    }));
+});
+
+export { }
@@ -0,0 +1,108 @@
+// Helpers for passing WebAuthn options and credentials as JSON, where
+// binary fields are base64url encoded.
+
+import { csrfToken } from './csrf';
+
+type Descriptor = { id: string };
+
+export function decodeCreation(options: any): CredentialCreationOptions {
+    const publicKey = options.publicKey;
+
+    return {
+        publicKey: {
+            ...publicKey,
+            challenge: decode(publicKey.challenge),
+            user: { ...publicKey.user, id: decode(publicKey.user.id) },
+            excludeCredentials: (publicKey.excludeCredentials ?? [])
+                .map((c: Descriptor) => ({ ...c, id: decode(c.id) })),
+        },
+    };
+}
+
+export function decodeRequest(options: any): CredentialRequestOptions {
+    const publicKey = options.publicKey;
+
+    return {
+        publicKey: {
+            ...publicKey,
+            challenge: decode(publicKey.challenge),
+            allowCredentials: (publicKey.allowCredentials ?? [])
+                .map((c: Descriptor) => ({ ...c, id: decode(c.id) })),
+        },
+    };
+}
+
+export function encodeCredential(credential: PublicKeyCredential): object {
+    const response = credential.response as AuthenticatorAttestationResponse & AuthenticatorAssertionResponse;
+    const encoded: Record<string, unknown> = {
+        clientDataJSON: encode(response.clientDataJSON),
+    };
+
+    if ('attestationObject' in response) {
+        encoded.attestationObject = encode(response.attestationObject);
+        encoded.transports = response.getTransports?.() ?? [];
+    } else {
+        encoded.authenticatorData = encode(response.authenticatorData);
+        encoded.signature = encode(response.signature);
+        if (response.userHandle) {
+            encoded.userHandle = encode(response.userHandle);
+        }
+    }
+
+    return {
+        id: credential.id,
+        rawId: encode(credential.rawId),
+        type: credential.type,
+        authenticatorAttachment: credential.authenticatorAttachment,
+        clientExtensionResults: credential.getClientExtensionResults(),
+        response: encoded,
+    };
+}
+
+// post sends the JSON body with the CSRF token, throwing on an error status.
+export async function post(url: string, body?: object): Promise<Response> {
+    const res = await fetch(url, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'X-CSRF-Token': csrfToken(),
+        },
+        body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (!res.ok) {
+        throw new Error(res.status === 400 ? 'The passkey could not be verified' : res.statusText);
+    }
+
+    return res;
+}
+
+export function showError(selector: string | undefined, err: unknown) {
+    const target = selector ? document.querySelector(selector) : null;
+    if (!target) {
+        return;
+    }
+
+    const p = document.createElement('p');
+    p.className = 'text-red-600';
+    p.textContent = err instanceof Error ? err.message : String(err);
+    target.replaceChildren(p);
+}
+
+export function supported(): boolean {
+    return 'PublicKeyCredential' in window;
+}
+
+function decode(value: string): ArrayBuffer {
+    const base64 = (value + '='.repeat((4 - value.length % 4) % 4))
+        .replace(/-/g, '+')
+        .replace(/_/g, '/');
+
+    return Uint8Array.from(atob(base64), c => c.charCodeAt(0)).buffer;
+}
+
+function encode(value: ArrayBuffer): string {
+    return btoa(String.fromCharCode(...new Uint8Array(value)))
+        .replace(/\+/g, '-')
+        .replace(/\//g, '_')
+        .replace(/=+$/, '');
+}
@@ -9,4 +9,6 @@ var (
 	//go:embed templates/*
 	fsys         embed.FS
 	Templates, _ = fs.Sub(fsys, "templates")
+	// EmailTemplates are rendered by email.Templates rather than the router.
+	EmailTemplates, _ = fs.Sub(fsys, "templates/email")
 )